@@ -0,0 +1,326 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Visibility 聊天记录可见范围
+type Visibility string
+
+const (
+	// VisibilityPrivate 仅上传者和管理员可见
+	VisibilityPrivate Visibility = "private"
+	// VisibilityMembers 来源群的成员可见，引入可见范围之前的记录默认为此值
+	// 私聊中上传或没有记录来源群的记录只有上传者和管理员可见
+	VisibilityMembers Visibility = "members"
+	// VisibilityPublic 登录用户可见，并且可以通过分享链接匿名访问
+	VisibilityPublic Visibility = "public"
+
+	// visibilityLegacyGroup VisibilityMembers 的旧名称，含义相同，由 MigrateVisibility 迁移
+	visibilityLegacyGroup Visibility = "group"
+)
+
+// Normalize 将旧名称和空值转换为对应的可见范围
+func (v Visibility) Normalize() Visibility {
+	if v == "" || v == visibilityLegacyGroup {
+		return VisibilityMembers
+	}
+	return v
+}
+
+// Valid 是否为已定义的可见范围
+func (v Visibility) Valid() bool {
+	return v == VisibilityPrivate || v == VisibilityMembers || v == VisibilityPublic
+}
+
+var (
+	// ErrForwardViewNotFound 聊天记录不存在或当前用户不可见
+	ErrForwardViewNotFound = errors.New("聊天记录不存在")
+	// ErrForbidden 当前用户无权修改
+	ErrForbidden = errors.New("权限不足")
+)
+
+// AccessFilter 用户可见的聊天记录过滤条件，user 为空时不限制
+// 管理员可以查看全部记录，其他用户可以查看公开的记录、所在群的群成员可见记录和自己上传的记录
+// 上传者和群成员按QQ号识别，用户的QQ号只能由拥有 PermManageUsers 权限的用户修改，且不能与其他用户重复
+// 用户所在的群需要事先读取到 user.Groups
+func AccessFilter(user *User) bson.M {
+	if user == nil || user.GetRole() == RoleAdmin {
+		return bson.M{}
+	}
+	or := []bson.M{{"visibility": VisibilityPublic}}
+	if len(user.Groups) > 0 {
+		// 引入可见范围之前的记录没有 visibility 字段或使用旧名称
+		or = append(or, bson.M{
+			"visibility": bson.M{"$in": []interface{}{VisibilityMembers, visibilityLegacyGroup, nil}},
+			"group_id":   bson.M{"$in": user.Groups},
+		})
+	}
+	if user.QQ != "" {
+		or = append(or, bson.M{"owner": user.QQ})
+	}
+	return bson.M{"$or": or}
+}
+
+// ForwardViewQuery 聊天记录列表查询条件
+// 记录按 _id 排序，ObjectID 中包含创建时间，因此等同于按创建时间排序
+type ForwardViewQuery struct {
+	Cursor   string     // 上一页最后一条记录的ID，为空时从头开始
+	Limit    int64      // 每页数量
+	Asc      bool       // true 按创建时间升序，默认降序
+	Sender   string     // 上传者
+	From     *time.Time // 创建时间下限（包含）
+	To       *time.Time // 创建时间上限（不包含）
+	MinCount *int64     // 消息数量下限（包含）
+	MaxCount *int64     // 消息数量上限（包含）
+	Viewer   *User      // 当前用户，只返回其可见的记录
+}
+
+// ForwardViewService 聊天记录服务
+type ForwardViewService struct {
+	collection *mongo.Collection
+}
+
+// NewForwardViewService 创建聊天记录服务
+func NewForwardViewService() *ForwardViewService {
+	return &ForwardViewService{
+		collection: Collection("message_db", "forward_views"),
+	}
+}
+
+// filter 根据查询条件构造过滤器（不含分页游标）
+func (q *ForwardViewQuery) filter() bson.M {
+	filter := bson.M{}
+	if q.Sender != "" {
+		filter["sender"] = q.Sender
+	}
+
+	idRange := bson.M{}
+	if q.From != nil {
+		idRange["$gte"] = primitive.NewObjectIDFromTimestamp(*q.From)
+	}
+	if q.To != nil {
+		idRange["$lt"] = primitive.NewObjectIDFromTimestamp(*q.To)
+	}
+	if len(idRange) > 0 {
+		filter["_id"] = idRange
+	}
+
+	countRange := bson.M{}
+	if q.MinCount != nil {
+		countRange["$gte"] = *q.MinCount
+	}
+	if q.MaxCount != nil {
+		countRange["$lte"] = *q.MaxCount
+	}
+	if len(countRange) > 0 {
+		filter["count"] = countRange
+	}
+	for key, value := range AccessFilter(q.Viewer) {
+		filter[key] = value
+	}
+	return filter
+}
+
+// List 按游标分页获取聊天记录，返回当前页、下一页游标（没有更多时为空）和符合条件的总数
+func (s *ForwardViewService) List(ctx context.Context, query ForwardViewQuery, projection bson.M) ([]bson.M, string, int64, error) {
+	filter := query.filter()
+
+	// 获取总数
+	total, err := s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	sortOrder := -1
+	if query.Asc {
+		sortOrder = 1
+	}
+
+	if query.Cursor != "" {
+		cursorID, err := primitive.ObjectIDFromHex(query.Cursor)
+		if err != nil {
+			return nil, "", 0, errors.New("无效的游标")
+		}
+		idRange, ok := filter["_id"].(bson.M)
+		if !ok {
+			idRange = bson.M{}
+		}
+		if query.Asc {
+			idRange["$gt"] = cursorID
+		} else {
+			idRange["$lt"] = cursorID
+		}
+		filter["_id"] = idRange
+	}
+
+	// 多取一条用于判断是否还有下一页
+	findOptions := options.Find().
+		SetLimit(query.Limit + 1).
+		SetSort(bson.M{"_id": sortOrder})
+	if projection != nil {
+		findOptions.SetProjection(projection)
+	}
+
+	cursor, err := s.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer cursor.Close(ctx)
+
+	views := make([]bson.M, 0)
+	if err := cursor.All(ctx, &views); err != nil {
+		return nil, "", 0, err
+	}
+
+	nextCursor := ""
+	if int64(len(views)) > query.Limit {
+		views = views[:query.Limit]
+		if id, ok := views[len(views)-1]["_id"].(primitive.ObjectID); ok {
+			nextCursor = id.Hex()
+		}
+	}
+
+	return views, nextCursor, total, nil
+}
+
+// forwardViewAccess 权限判断需要的字段
+type forwardViewAccess struct {
+	Owner      string     `bson:"owner"`
+	Visibility Visibility `bson:"visibility"`
+}
+
+// Authorize 检查用户能否查看指定记录，manage 为 true 时检查能否修改可见范围和分享链接
+// 不可见的记录返回 ErrForwardViewNotFound，避免泄露记录是否存在
+func (s *ForwardViewService) Authorize(ctx context.Context, id string, user *User, manage bool) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("无效的ID格式")
+	}
+
+	filter := AccessFilter(user)
+	filter["_id"] = objectID
+	var access forwardViewAccess
+	err = s.collection.FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"owner": 1, "visibility": 1})).Decode(&access)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrForwardViewNotFound
+		}
+		return err
+	}
+
+	if manage && user != nil && user.GetRole() != RoleAdmin && (user.QQ == "" || access.Owner != user.QQ) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AuthorizeMedia 检查用户能否查看媒体文件：引用该文件的记录中有公开的或用户可见的记录
+// names 为同一文件的存储key和QQ文件名，public 表示文件出现在公开的记录中，可以匿名访问；
+// user 为空时只检查公开的记录，没有可见的记录时返回 ErrForwardViewNotFound
+func (s *ForwardViewService) AuthorizeMedia(ctx context.Context, names []string, user *User) (public bool, err error) {
+	refs := bson.M{"$in": names}
+	findOptions := options.FindOne().SetProjection(bson.M{"_id": 1})
+
+	filter := bson.M{"media_refs": refs, "visibility": VisibilityPublic}
+	err = s.collection.FindOne(ctx, filter, findOptions).Err()
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return false, err
+	}
+	if user == nil {
+		return false, ErrForwardViewNotFound
+	}
+
+	filter = AccessFilter(user)
+	filter["media_refs"] = refs
+	if err := s.collection.FindOne(ctx, filter, findOptions).Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, ErrForwardViewNotFound
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// GetVisibility 获取记录的可见范围
+func (s *ForwardViewService) GetVisibility(ctx context.Context, id string) (Visibility, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return "", errors.New("无效的ID格式")
+	}
+	var access forwardViewAccess
+	err = s.collection.FindOne(ctx, bson.M{"_id": objectID}, options.FindOne().SetProjection(bson.M{"visibility": 1})).Decode(&access)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", ErrForwardViewNotFound
+		}
+		return "", err
+	}
+	return access.Visibility.Normalize(), nil
+}
+
+// SetVisibility 修改记录的可见范围
+func (s *ForwardViewService) SetVisibility(ctx context.Context, id string, visibility Visibility) error {
+	visibility = visibility.Normalize()
+	if !visibility.Valid() {
+		return errors.New("无效的可见范围")
+	}
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("无效的ID格式")
+	}
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{"visibility": visibility}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrForwardViewNotFound
+	}
+	return nil
+}
+
+// MigrateVisibility 将使用旧名称 group 的记录改为 members，返回迁移数量
+func (s *ForwardViewService) MigrateVisibility(ctx context.Context) (int64, error) {
+	result, err := s.collection.UpdateMany(ctx,
+		bson.M{"visibility": visibilityLegacyGroup},
+		bson.M{"$set": bson.M{"visibility": VisibilityMembers}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// CreateIndexes 创建索引
+func (s *ForwardViewService) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "sender", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.M{"count": 1},
+		},
+		{
+			Keys: bson.D{{Key: "owner", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "group_id", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.M{"media_refs": 1},
+		},
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestVisibilityNormalize(t *testing.T) {
+	tests := []struct {
+		in, want Visibility
+		valid    bool
+	}{
+		{"", VisibilityMembers, true},
+		{"group", VisibilityMembers, true},
+		{"members", VisibilityMembers, true},
+		{"private", VisibilityPrivate, true},
+		{"public", VisibilityPublic, true},
+		{"everyone", "everyone", false},
+	}
+	for _, tt := range tests {
+		got := tt.in.Normalize()
+		if got != tt.want || got.Valid() != tt.valid {
+			t.Errorf("Visibility(%q).Normalize() = %q, valid %v", tt.in, got, got.Valid())
+		}
+	}
+}
+
+func TestAccessFilter(t *testing.T) {
+	if len(AccessFilter(nil)) != 0 || len(AccessFilter(&User{Role: RoleAdmin})) != 0 {
+		t.Error("AccessFilter() should not restrict anonymous callers or admins")
+	}
+
+	// 不在任何群的用户只能看到公开的记录和自己上传的记录
+	or := AccessFilter(&User{QQ: "10001"})["$or"].([]bson.M)
+	if len(or) != 2 || or[0]["visibility"] != VisibilityPublic || or[1]["owner"] != "10001" {
+		t.Errorf("AccessFilter() = %v", or)
+	}
+
+	or = AccessFilter(&User{QQ: "10001", Groups: []int64{111, 222}})["$or"].([]bson.M)
+	if len(or) != 3 {
+		t.Fatalf("AccessFilter() = %v", or)
+	}
+	groups := or[1]["group_id"].(bson.M)["$in"].([]int64)
+	if len(groups) != 2 || groups[0] != 111 {
+		t.Errorf("members filter = %v", or[1])
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GroupMember QQ群成员关系，用于判断用户能否查看群内归档的聊天记录
+type GroupMember struct {
+	GroupId   int64     `bson:"group_id" json:"group_id"`
+	QQ        string    `bson:"qq" json:"qq"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"` // 最后一次同步或在群内上传的时间
+}
+
+// GroupMemberService 群成员关系服务，成员列表由 bot 定期从 NapCat 同步
+type GroupMemberService struct {
+	collection *mongo.Collection
+}
+
+// NewGroupMemberService 创建群成员关系服务
+func NewGroupMemberService() *GroupMemberService {
+	return &GroupMemberService{
+		collection: Collection("message_db", "group_members"),
+	}
+}
+
+// Add 记录用户是群成员，如在群内上传聊天记录的用户
+func (s *GroupMemberService) Add(ctx context.Context, groupId int64, qq string) error {
+	if groupId == 0 || qq == "" {
+		return nil
+	}
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"group_id": groupId, "qq": qq},
+		bson.M{"$set": bson.M{"updated_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// ReplaceGroup 用完整的成员列表替换群成员，已退群的成员被删除
+func (s *GroupMemberService) ReplaceGroup(ctx context.Context, groupId int64, qqs []string) error {
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, len(qqs)+1)
+	for _, qq := range qqs {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"group_id": groupId, "qq": qq}).
+			SetUpdate(bson.M{"$set": bson.M{"updated_at": now}}).
+			SetUpsert(true))
+	}
+	models = append(models, mongo.NewDeleteManyModel().
+		SetFilter(bson.M{"group_id": groupId, "updated_at": bson.M{"$lt": now}}))
+	_, err := s.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(true))
+	return err
+}
+
+// Groups 返回用户所在的群
+func (s *GroupMemberService) Groups(ctx context.Context, qq string) ([]int64, error) {
+	if qq == "" {
+		return nil, nil
+	}
+	cursor, err := s.collection.Find(ctx, bson.M{"qq": qq}, options.Find().SetProjection(bson.M{"group_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var members []GroupMember
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+	groups := make([]int64, 0, len(members))
+	for _, member := range members {
+		groups = append(groups, member.GroupId)
+	}
+	return groups, nil
+}
+
+// CreateIndexes 创建索引
+func (s *GroupMemberService) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "group_id", Value: 1}, {Key: "qq", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.M{"qq": 1},
+		},
+	}
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TestGroupMemberService 需要 MongoDB，通过 MONGO_TEST_URI 指定
+func TestGroupMemberService(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI 未设置")
+	}
+	if err := Init(uri); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	s := NewGroupMemberService()
+	group := time.Now().UnixNano()
+	t.Cleanup(func() { s.collection.DeleteMany(context.Background(), bson.M{"group_id": group}) })
+
+	if err := s.ReplaceGroup(ctx, group, []string{"1", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(ctx, group, "3"); err != nil {
+		t.Fatal(err)
+	}
+	if groups, _ := s.Groups(ctx, "3"); !slices.Contains(groups, group) {
+		t.Errorf("Groups() = %v after Add()", groups)
+	}
+
+	// 再次同步时删除已退群的成员
+	time.Sleep(time.Millisecond)
+	if err := s.ReplaceGroup(ctx, group, []string{"2"}); err != nil {
+		t.Fatal(err)
+	}
+	for qq, want := range map[string]bool{"1": false, "2": true, "3": false} {
+		groups, err := s.Groups(ctx, qq)
+		if err != nil || slices.Contains(groups, group) != want {
+			t.Errorf("Groups(%s) = %v, %v", qq, groups, err)
+		}
+	}
+}
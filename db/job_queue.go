@@ -0,0 +1,484 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// JobState 任务状态
+type JobState string
+
+const (
+	JobPending   JobState = "pending"   // 等待执行（包括等待重试）
+	JobRunning   JobState = "running"   // 执行中
+	JobSucceeded JobState = "succeeded" // 执行成功
+	JobFailed    JobState = "failed"    // 重试次数用尽后失败
+)
+
+const (
+	// 默认最大尝试次数
+	defaultJobMaxAttempts = 5
+	// 重试退避的初始间隔和最大间隔
+	jobRetryBaseDelay = 30 * time.Second
+	jobRetryMaxDelay  = 30 * time.Minute
+	// 任务租约，执行超过该时间未结束的任务会被其他worker重新领取
+	jobLease = 10 * time.Minute
+	// 没有任务时的轮询间隔
+	jobPollInterval = 5 * time.Second
+)
+
+// Job 持久化任务
+type Job struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type        string             `bson:"type" json:"type"`
+	Key         string             `bson:"key,omitempty" json:"key,omitempty"` // 去重键，同一键同时只有一个未完成任务
+	Active      bool               `bson:"active" json:"-"`                    // 未完成时为true，用于去重键的唯一索引
+	Payload     map[string]string  `bson:"payload" json:"payload"`
+	State       JobState           `bson:"state" json:"state"`
+	Attempts    int                `bson:"attempts" json:"attempts"`
+	MaxAttempts int                `bson:"max_attempts" json:"max_attempts"`
+	LastError   string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	Result      string             `bson:"result,omitempty" json:"result,omitempty"`
+	RunAt       time.Time          `bson:"run_at" json:"run_at"`             // 最早执行时间
+	LockedUntil time.Time          `bson:"locked_until" json:"locked_until"` // 执行租约到期时间
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	FinishedAt  *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// JobHandler 任务处理函数，返回值会作为任务结果保存
+type JobHandler func(ctx context.Context, job *Job) (string, error)
+
+// JobQueue 基于MongoDB的任务队列
+type JobQueue struct {
+	collection *mongo.Collection
+	mu         sync.RWMutex
+	handlers   map[string]JobHandler
+
+	wake    chan struct{}      // 新任务入队时唤醒worker
+	stop    chan struct{}      // 停止领取新任务
+	cancel  context.CancelFunc // 取消执行中的任务
+	wg      sync.WaitGroup
+	started bool
+}
+
+var (
+	jobQueueInstance *JobQueue
+	jobQueueOnce     sync.Once
+)
+
+// GetJobQueue 返回全局唯一的任务队列
+func GetJobQueue() *JobQueue {
+	jobQueueOnce.Do(func() {
+		jobQueueInstance = &JobQueue{
+			collection: Collection("message_db", "jobs"),
+			handlers:   make(map[string]JobHandler),
+			wake:       make(chan struct{}, 1),
+			stop:       make(chan struct{}),
+		}
+	})
+	return jobQueueInstance
+}
+
+// Register 注册任务类型的处理函数，需在Start之前调用
+func (q *JobQueue) Register(jobType string, handler JobHandler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// Enqueue 添加任务
+// key 不为空时，若已有相同key的未完成任务则不重复添加，返回已有任务且created为false
+func (q *JobQueue) Enqueue(ctx context.Context, jobType, key string, payload map[string]string) (*Job, bool, error) {
+	now := time.Now()
+	job := &Job{
+		Type:        jobType,
+		Key:         key,
+		Payload:     payload,
+		State:       JobPending,
+		Active:      true,
+		MaxAttempts: defaultJobMaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if key == "" {
+		result, err := q.collection.InsertOne(ctx, job)
+		if err != nil {
+			return nil, false, err
+		}
+		job.ID = result.InsertedID.(primitive.ObjectID)
+		q.notify()
+		return job, true, nil
+	}
+
+	// 仅当不存在相同key的未完成任务时插入
+	// 并发插入时由唯一索引保证只有一个成功，其余视为已存在
+	filter := bson.M{
+		"type":  jobType,
+		"key":   key,
+		"state": bson.M{"$in": []JobState{JobPending, JobRunning}},
+	}
+	update := bson.M{"$setOnInsert": job}
+	result, err := q.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return nil, false, err
+	}
+	if err != nil || result.UpsertedID == nil {
+		var existing Job
+		if err := q.collection.FindOne(ctx, filter).Decode(&existing); err != nil {
+			return nil, false, err
+		}
+		return &existing, false, nil
+	}
+	job.ID = result.UpsertedID.(primitive.ObjectID)
+	q.notify()
+	return job, true, nil
+}
+
+// notify 唤醒空闲的worker
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start 启动指定数量的worker
+func (q *JobQueue) Start(workers int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.started {
+		return
+	}
+	q.started = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+	fmt.Printf("任务队列已启动，worker数量: %d\n", workers)
+}
+
+// Stop 停止领取新任务并等待执行中的任务结束
+// ctx 到期后取消仍在执行的任务，这些任务回到待执行状态，下次启动时重新领取
+func (q *JobQueue) Stop(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.started {
+		q.mu.Unlock()
+		return nil
+	}
+	q.started = false
+	close(q.stop)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// work worker主循环
+func (q *JobQueue) work(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		job, err := q.claim(ctx)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			fmt.Printf("领取任务失败: %v\n", err)
+		}
+		if job != nil {
+			q.run(ctx, job)
+			continue
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// registeredTypes 已注册处理函数的任务类型
+func (q *JobQueue) registeredTypes() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	types := make([]string, 0, len(q.handlers))
+	for jobType := range q.handlers {
+		types = append(types, jobType)
+	}
+	return types
+}
+
+// claim 原子地领取一个到期任务，包括租约已过期的执行中任务（进程重启前未完成的任务）
+func (q *JobQueue) claim(ctx context.Context) (*Job, error) {
+	now := time.Now()
+	filter := bson.M{
+		"type": bson.M{"$in": q.registeredTypes()},
+		"$or": []bson.M{
+			{"state": JobPending, "run_at": bson.M{"$lte": now}},
+			{"state": JobRunning, "locked_until": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"state":        JobRunning,
+			"locked_until": now.Add(jobLease),
+			"updated_at":   now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	findOptions := options.FindOneAndUpdate().
+		SetSort(bson.M{"run_at": 1}).
+		SetReturnDocument(options.After)
+
+	var job Job
+	if err := q.collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// run 执行任务并记录结果，失败时按指数退避安排重试
+func (q *JobQueue) run(ctx context.Context, job *Job) {
+	q.mu.RLock()
+	handler := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	jobCtx, cancel := context.WithTimeout(ctx, jobLease)
+	result, err := safeRun(jobCtx, handler, job)
+	cancel()
+
+	update := jobResultUpdate(job, result, err, ctx.Err() != nil, time.Now())
+
+	// 只更新本次领取的任务：租约到期后任务可能已被其他worker重新领取，此时放弃本次结果
+	filter := bson.M{"_id": job.ID, "state": JobRunning, "locked_until": job.LockedUntil}
+
+	// 使用独立的上下文，确保结果一定被写回
+	updateCtx, updateCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer updateCancel()
+	res, updateErr := q.collection.UpdateOne(updateCtx, filter, update)
+	if updateErr != nil {
+		fmt.Printf("更新任务 %s 状态失败: %v\n", job.ID.Hex(), updateErr)
+		return
+	}
+	if res.MatchedCount == 0 {
+		fmt.Printf("任务 %s(%s) 的租约已失效，忽略本次执行结果\n", job.ID.Hex(), job.Type)
+		return
+	}
+
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		fmt.Printf("任务 %s(%s) 因停止而中断，已放回队列\n", job.ID.Hex(), job.Type)
+	case job.Attempts >= job.MaxAttempts:
+		fmt.Printf("任务 %s(%s) 重试 %d 次后失败: %v\n", job.ID.Hex(), job.Type, job.Attempts, err)
+	default:
+		fmt.Printf("任务 %s(%s) 第 %d 次执行失败，稍后重试: %v\n", job.ID.Hex(), job.Type, job.Attempts, err)
+	}
+}
+
+// jobResultUpdate 根据执行结果构造任务的更新
+// shutdown 为 true 表示执行被 Stop 取消，未完成的任务立即回到待执行状态，且不计入尝试次数
+func jobResultUpdate(job *Job, result string, err error, shutdown bool, now time.Time) bson.M {
+	set := bson.M{"updated_at": now, "locked_until": now}
+	switch {
+	case err == nil:
+		set["state"] = JobSucceeded
+		set["active"] = false
+		set["result"] = result
+		set["finished_at"] = now
+	case shutdown:
+		set["state"] = JobPending
+		set["run_at"] = now
+		return bson.M{"$set": set, "$inc": bson.M{"attempts": -1}}
+	case job.Attempts >= job.MaxAttempts:
+		set["state"] = JobFailed
+		set["active"] = false
+		set["last_error"] = err.Error()
+		set["finished_at"] = now
+	default:
+		set["state"] = JobPending
+		set["last_error"] = err.Error()
+		set["run_at"] = now.Add(jobRetryDelay(job.Attempts))
+	}
+	return bson.M{"$set": set}
+}
+
+// safeRun 执行处理函数，处理函数panic时视为失败
+func safeRun(ctx context.Context, handler JobHandler, job *Job) (result string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	if handler == nil {
+		return "", fmt.Errorf("no handler for job type %s", job.Type)
+	}
+	return handler(ctx, job)
+}
+
+// jobRetryDelay 第 attempts 次失败后的重试间隔
+func jobRetryDelay(attempts int) time.Duration {
+	delay := jobRetryBaseDelay
+	for i := 1; i < attempts && delay < jobRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > jobRetryMaxDelay {
+		delay = jobRetryMaxDelay
+	}
+	return delay
+}
+
+// GetJob 根据ID获取任务
+func (q *JobQueue) GetJob(ctx context.Context, id string) (*Job, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("无效的ID格式")
+	}
+
+	var job Job
+	if err := q.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&job); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.New("任务不存在")
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs 按状态和类型筛选任务，按创建时间倒序
+func (q *JobQueue) ListJobs(ctx context.Context, state JobState, jobType string, limit int64) ([]Job, error) {
+	filter := bson.M{}
+	if state != "" {
+		filter["state"] = state
+	}
+	if jobType != "" {
+		filter["type"] = jobType
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.M{"_id": -1}).
+		SetLimit(limit)
+	cursor, err := q.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	jobs := make([]Job, 0)
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// CountJobs 按状态统计任务数量
+func (q *JobQueue) CountJobs(ctx context.Context) (map[JobState]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$state", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := q.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		State JobState `bson:"_id"`
+		Count int64    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[JobState]int64)
+	for _, row := range rows {
+		counts[row.State] = row.Count
+	}
+	return counts, nil
+}
+
+// RetryJob 将失败的任务重新置为待执行
+func (q *JobQueue) RetryJob(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("无效的ID格式")
+	}
+
+	now := time.Now()
+	filter := bson.M{"_id": objectID, "state": JobFailed}
+	update := bson.M{
+		"$set": bson.M{
+			"state":      JobPending,
+			"active":     true,
+			"attempts":   0,
+			"run_at":     now,
+			"updated_at": now,
+		},
+		"$unset": bson.M{"finished_at": ""},
+	}
+	result, err := q.collection.UpdateOne(ctx, filter, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return errors.New("已有相同的未完成任务")
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("任务不存在或不是失败状态")
+	}
+	q.notify()
+	return nil
+}
+
+// CreateIndexes 创建索引
+func (q *JobQueue) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "state", Value: 1}, {Key: "run_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "type", Value: 1}, {Key: "key", Value: 1}, {Key: "state", Value: 1}},
+		},
+		{
+			// 同一去重键同时只能有一个未完成任务
+			Keys: bson.D{{Key: "type", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"active": true,
+				"key":    bson.M{"$exists": true},
+			}),
+		},
+	}
+
+	_, err := q.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestJobResultUpdate(t *testing.T) {
+	now := time.Now()
+	job := &Job{Attempts: 2, MaxAttempts: 3}
+	failure := errors.New("boom")
+
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		shutdown bool
+		state    JobState
+		runAt    time.Time
+		inc      bool
+	}{
+		{"succeeded", 2, nil, false, JobSucceeded, time.Time{}, false},
+		// 停止时已经完成的任务照常记录结果
+		{"succeeded during shutdown", 2, nil, true, JobSucceeded, time.Time{}, false},
+		{"retry", 2, failure, false, JobPending, now.Add(jobRetryDelay(2)), false},
+		{"exhausted", 3, failure, false, JobFailed, time.Time{}, false},
+		// 被停止中断的任务立即放回队列，退回本次领取增加的尝试次数
+		{"shutdown", 3, failure, true, JobPending, now, true},
+	}
+	for _, tt := range tests {
+		job.Attempts = tt.attempts
+		update := jobResultUpdate(job, "ok", tt.err, tt.shutdown, now)
+		set := update["$set"].(bson.M)
+		if set["state"] != tt.state {
+			t.Errorf("%s: state = %v, want %v", tt.name, set["state"], tt.state)
+		}
+		if runAt, _ := set["run_at"].(time.Time); !runAt.Equal(tt.runAt) {
+			t.Errorf("%s: run_at = %v, want %v", tt.name, runAt, tt.runAt)
+		}
+		if _, ok := update["$inc"]; ok != tt.inc {
+			t.Errorf("%s: $inc = %v", tt.name, update["$inc"])
+		}
+		if tt.shutdown && tt.err != nil && set["last_error"] != nil {
+			t.Errorf("%s: last_error = %v", tt.name, set["last_error"])
+		}
+	}
+}
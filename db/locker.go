@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"snail.local/snailllllll/utils"
+)
+
+// MongoLocker 基于MongoDB的锁，多个实例共享
+//
+// 每个锁是 locks 集合中以锁名为 _id 的文档。上锁时只匹配已过期的文档并 upsert：
+// 文档不存在时插入，已过期时覆盖，未过期时插入会因 _id 重复而失败，因此检查和设置是原子的。
+// 每次上锁生成随机 token 保存在 owner 中，续期和释放都要求 token 一致，
+// 避免锁过期后被他人获取时误删他人的锁。TTL 索引只用于清理，是否过期以 expires_at 字段为准。
+type MongoLocker struct {
+	collection *mongo.Collection
+	host       string
+}
+
+// NewMongoLocker 创建MongoDB锁
+func NewMongoLocker() *MongoLocker {
+	host, _ := os.Hostname()
+	return &MongoLocker{
+		collection: Collection("message_db", "locks"),
+		host:       host,
+	}
+}
+
+// TryLock 锁不存在或已过期时上锁并返回 token，否则返回 utils.ErrLocked
+func (l *MongoLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	token := utils.NewLockToken()
+	filter := bson.M{"_id": key, "expires_at": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{
+		"expires_at": now.Add(ttl),
+		"owner":      token,
+		"host":       l.host,
+		"locked_at":  now,
+	}}
+	_, err := l.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return "", utils.ErrLocked
+	}
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Exists 锁是否存在且未过期
+func (l *MongoLocker) Exists(ctx context.Context, key string) (bool, error) {
+	count, err := l.collection.CountDocuments(ctx, bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Extend 延长 token 持有且未过期的锁
+func (l *MongoLocker) Extend(ctx context.Context, key, token string, ttl time.Duration) error {
+	now := time.Now()
+	filter := bson.M{"_id": key, "owner": token, "expires_at": bson.M{"$gt": now}}
+	result, err := l.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"expires_at": now.Add(ttl)}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrLockLost
+	}
+	return nil
+}
+
+// Unlock 删除 token 持有的锁
+func (l *MongoLocker) Unlock(ctx context.Context, key, token string) error {
+	_, err := l.collection.DeleteOne(ctx, bson.M{"_id": key, "owner": token})
+	return err
+}
+
+// CreateIndexes 创建TTL索引，自动删除过期的锁
+func (l *MongoLocker) CreateIndexes(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	_, err := l.collection.Indexes().CreateOne(ctx, index)
+	return err
+}
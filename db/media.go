@@ -0,0 +1,227 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"snail.local/snailllllll/utils"
+)
+
+// Media 媒体文件元数据，同一内容只保存一份
+type Media struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	SHA256    string             `bson:"sha256" json:"sha256"` // 内容哈希
+	Key       string             `bson:"key" json:"key"`       // 存储key
+	Store     string             `bson:"store" json:"store"`   // 存储名称
+	MimeType  string             `bson:"mime" json:"mime"`     // MIME类型
+	Size      int64              `bson:"size" json:"size"`     // 字节数
+	Width     int                `bson:"width,omitempty" json:"width,omitempty"`
+	Height    int                `bson:"height,omitempty" json:"height,omitempty"`
+	Filenames []string           `bson:"filenames" json:"filenames"` // QQ 提供的文件名
+	Sources   []MediaSource      `bson:"sources" json:"sources"`     // 来源消息
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// MediaSource 媒体文件的来源消息
+type MediaSource struct {
+	MessageId int64     `bson:"message_id,omitempty" json:"message_id,omitempty"`
+	SenderId  int64     `bson:"sender_id,omitempty" json:"sender_id,omitempty"`
+	GroupId   int64     `bson:"group_id,omitempty" json:"group_id,omitempty"`
+	Filename  string    `bson:"filename,omitempty" json:"filename,omitempty"`
+	URL       string    `bson:"url,omitempty" json:"url,omitempty"`
+	SavedAt   time.Time `bson:"saved_at" json:"saved_at"`
+}
+
+// MediaService 媒体文件服务：按SHA-256去重保存文件并在MongoDB中记录元数据
+type MediaService struct {
+	collection *mongo.Collection
+	store      utils.MediaStore
+}
+
+var (
+	mediaServiceInstance *MediaService
+	mediaServiceOnce     sync.Once
+)
+
+// NewMediaService 创建媒体文件服务
+func NewMediaService(store utils.MediaStore) *MediaService {
+	return &MediaService{
+		collection: Collection("message_db", "media"),
+		store:      store,
+	}
+}
+
+// GetMediaService 返回使用配置中存储的全局媒体文件服务
+// 存储配置错误时退回本地存储
+func GetMediaService() *MediaService {
+	mediaServiceOnce.Do(func() {
+		store, err := utils.NewMediaStoreFromConfig()
+		if err != nil {
+			fmt.Printf("创建媒体存储失败，使用本地存储: %v\n", err)
+			store = &utils.LocalMediaStore{Dir: utils.Config.Media.Dir}
+		}
+		mediaServiceInstance = NewMediaService(store)
+	})
+	return mediaServiceInstance
+}
+
+// mediaExtensions 常见MIME类型对应的扩展名
+var mediaExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/bmp":       ".bmp",
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+	"audio/amr":       ".amr",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"application/pdf": ".pdf",
+	"application/zip": ".zip",
+}
+
+// mediaExtension 根据MIME类型确定扩展名，未知类型时使用原文件名的扩展名
+func mediaExtension(mimeType, filename string) string {
+	if ext, ok := mediaExtensions[mimeType]; ok {
+		return ext
+	}
+	if ext := strings.ToLower(filepath.Ext(filename)); ext != "" && len(ext) <= 8 {
+		return ext
+	}
+	return ".bin"
+}
+
+// Save 保存文件，内容已存在时只追加文件名和来源
+func (s *MediaService) Save(ctx context.Context, data []byte, filename string, source MediaSource) (*Media, error) {
+	hash, key, mimeType, err := s.put(ctx, data, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	source.Filename = filename
+	source.SavedAt = now
+	onInsert := bson.M{
+		"key":        key,
+		"store":      s.store.Name(),
+		"mime":       mimeType,
+		"size":       int64(len(data)),
+		"created_at": now,
+	}
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		onInsert["width"] = config.Width
+		onInsert["height"] = config.Height
+	}
+	update := bson.M{
+		"$setOnInsert": onInsert,
+		"$set":         bson.M{"updated_at": now},
+		"$push":        bson.M{"sources": source},
+	}
+	if filename != "" {
+		update["$addToSet"] = bson.M{"filenames": filename}
+	}
+
+	findOptions := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+	var media Media
+	err = s.collection.FindOneAndUpdate(ctx, bson.M{"sha256": hash}, update, findOptions).Decode(&media)
+	if err != nil {
+		return nil, fmt.Errorf("保存媒体元数据失败: %v", err)
+	}
+	return &media, nil
+}
+
+// put 按内容哈希写入存储，内容已存在时不重复写入
+func (s *MediaService) put(ctx context.Context, data []byte, filename string) (hash, key, mimeType string, err error) {
+	if len(data) == 0 {
+		return "", "", "", errors.New("文件内容为空")
+	}
+
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+	mimeType = http.DetectContentType(data)
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	key = hash + mediaExtension(mimeType, filename)
+
+	exists, err := s.store.Exists(ctx, key)
+	if err != nil {
+		return "", "", "", fmt.Errorf("查询媒体文件失败: %v", err)
+	}
+	if !exists {
+		if err := s.store.Put(ctx, key, data, mimeType); err != nil {
+			return "", "", "", fmt.Errorf("保存媒体文件失败: %v", err)
+		}
+	}
+	return hash, key, mimeType, nil
+}
+
+// Find 根据文件名或存储key查找媒体文件
+func (s *MediaService) Find(ctx context.Context, name string) (*Media, error) {
+	filter := bson.M{"$or": []bson.M{
+		{"filenames": name},
+		{"key": name},
+	}}
+	var media Media
+	if err := s.collection.FindOne(ctx, filter).Decode(&media); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, utils.ErrMediaNotFound
+		}
+		return nil, err
+	}
+	return &media, nil
+}
+
+// Open 根据文件名或存储key读取媒体文件
+func (s *MediaService) Open(ctx context.Context, name string) (io.ReadCloser, *Media, error) {
+	media, err := s.Find(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := s.store.Get(ctx, media.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, media, nil
+}
+
+// CreateIndexes 创建索引
+func (s *MediaService) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"sha256": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.M{"filenames": 1},
+		},
+		{
+			Keys: bson.M{"key": 1},
+		},
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
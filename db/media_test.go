@@ -0,0 +1,153 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"snail.local/snailllllll/utils"
+)
+
+// memoryMediaStore 内存中的媒体存储，记录写入次数
+type memoryMediaStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int
+}
+
+func newMemoryMediaStore() *memoryMediaStore {
+	return &memoryMediaStore{objects: make(map[string][]byte)}
+}
+
+func (s *memoryMediaStore) Name() string {
+	return "memory"
+}
+
+func (s *memoryMediaStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = append([]byte(nil), data...)
+	s.puts++
+	return nil
+}
+
+func (s *memoryMediaStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, utils.ErrMediaNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryMediaStore) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objects[key]
+	return ok, nil
+}
+
+// pngHeader 足以被识别为 image/png 的内容
+var pngHeader = []byte("\x89PNG\r\n\x1a\n0000")
+
+func TestMediaServicePutDeduplicates(t *testing.T) {
+	store := newMemoryMediaStore()
+	service := &MediaService{store: store}
+	ctx := context.Background()
+
+	hash, key, mimeType, err := service.put(ctx, pngHeader, "a.image")
+	if err != nil {
+		t.Fatalf("put() error = %v", err)
+	}
+	if mimeType != "image/png" || key != hash+".png" {
+		t.Errorf("put() key = %q, mime = %q", key, mimeType)
+	}
+
+	// 相同内容、不同文件名只写入一次
+	_, key2, _, err := service.put(ctx, pngHeader, "b.image")
+	if err != nil {
+		t.Fatalf("put() error = %v", err)
+	}
+	if key2 != key || store.puts != 1 {
+		t.Errorf("second put() key = %q, puts = %d", key2, store.puts)
+	}
+
+	_, other, _, err := service.put(ctx, []byte("plain text"), "note.txt")
+	if err != nil {
+		t.Fatalf("put() error = %v", err)
+	}
+	if other == key || store.puts != 2 {
+		t.Errorf("different content key = %q, puts = %d", other, store.puts)
+	}
+
+	if _, _, _, err := service.put(ctx, nil, "empty"); err == nil {
+		t.Error("put() with empty content should fail")
+	}
+}
+
+func TestMediaExtension(t *testing.T) {
+	tests := []struct {
+		mimeType, filename, want string
+	}{
+		{"image/jpeg", "x.png", ".jpg"},
+		{"application/octet-stream", "voice.SILK", ".silk"},
+		{"application/octet-stream", "noext", ".bin"},
+		{"application/octet-stream", "x.verylongext", ".bin"},
+	}
+	for _, tt := range tests {
+		if got := mediaExtension(tt.mimeType, tt.filename); got != tt.want {
+			t.Errorf("mediaExtension(%q, %q) = %q, want %q", tt.mimeType, tt.filename, got, tt.want)
+		}
+	}
+}
+
+// TestMediaServiceSaveOpen 需要 MongoDB，通过 MONGO_TEST_URI 指定
+func TestMediaServiceSaveOpen(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI 未设置")
+	}
+	if err := Init(uri); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	store := newMemoryMediaStore()
+	service := NewMediaService(store)
+
+	data := append(append([]byte(nil), pngHeader...), primitive.NewObjectID().Hex()...)
+	first, err := service.Save(ctx, data, "first.image", MediaSource{MessageId: 1})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	t.Cleanup(func() {
+		service.collection.DeleteOne(context.Background(), bson.M{"_id": first.ID})
+	})
+	second, err := service.Save(ctx, data, "second.image", MediaSource{MessageId: 2})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if second.ID != first.ID || store.puts != 1 {
+		t.Errorf("duplicate Save() id = %v, want %v, puts = %d", second.ID, first.ID, store.puts)
+	}
+	if len(second.Filenames) != 2 || len(second.Sources) != 2 {
+		t.Errorf("duplicate Save() filenames = %v, sources = %d", second.Filenames, len(second.Sources))
+	}
+
+	for _, name := range []string{"second.image", first.Key} {
+		reader, media, err := service.Open(ctx, name)
+		if err != nil {
+			t.Fatalf("Open(%q) error = %v", name, err)
+		}
+		got, _ := io.ReadAll(reader)
+		reader.Close()
+		if !bytes.Equal(got, data) || media.Key != first.Key {
+			t.Errorf("Open(%q) returned wrong content", name)
+		}
+	}
+}
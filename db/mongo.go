@@ -36,3 +36,19 @@ func Init(uri string) error {
 func Collection(dbName, colName string) *mongo.Collection {
 	return Client.Database(dbName).Collection(colName)
 }
+
+// Close 断开MongoDB连接
+func Close(ctx context.Context) error {
+	if Client == nil {
+		return nil
+	}
+	return Client.Disconnect(ctx)
+}
+
+// Ping 检查MongoDB连接是否可用
+func Ping(ctx context.Context) error {
+	if Client == nil {
+		return fmt.Errorf("MongoDB未连接")
+	}
+	return Client.Ping(ctx, nil)
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"snail.local/snailllllll/utils"
+)
+
+// MongoRateLimitStore 基于MongoDB的令牌桶，多个实例共享
+//
+// 每个桶是 rate_limits 集合中以键为 _id 的文档。补充和扣减令牌在一次管道更新中完成，
+// 并发请求不会重复使用同一个令牌。需要 MongoDB 4.2 及以上版本。
+type MongoRateLimitStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRateLimitStore 创建MongoDB令牌桶存储
+func NewMongoRateLimitStore() *MongoRateLimitStore {
+	return &MongoRateLimitStore{
+		collection: Collection("message_db", "rate_limits"),
+	}
+}
+
+// Take 从桶中取一个令牌
+func (s *MongoRateLimitStore) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	now := time.Now()
+	// 桶补满后文档即可删除，满桶和不存在的桶等价
+	expiresAt := now.Add(time.Duration(float64(burst) / rate * float64(time.Second)))
+
+	pipeline := mongo.Pipeline{
+		// 按经过的时间补充令牌，新建的桶为满桶
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": bson.A{
+				burst,
+				bson.M{"$add": bson.A{
+					bson.M{"$ifNull": bson.A{"$tokens", burst}},
+					bson.M{"$multiply": bson.A{
+						bson.M{"$divide": bson.A{
+							bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}},
+							1000,
+						}},
+						rate,
+					}},
+				}},
+			}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"allowed": bson.M{"$gte": bson.A{"$tokens", 1}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":     bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"updated_at": now,
+			"expires_at": expiresAt,
+		}}},
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+	if mongo.IsDuplicateKeyError(err) {
+		// 并发创建同一个桶时，其中一个upsert会失败，此时文档已存在，重试即可
+		err = s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return bucket.Allowed, utils.RetryAfter(bucket.Tokens, rate), nil
+}
+
+// CreateIndexes 创建TTL索引，自动删除已补满的桶
+func (s *MongoRateLimitStore) CreateIndexes(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	_, err := s.collection.Indexes().CreateOne(ctx, index)
+	return err
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Role 用户角色
+type Role string
+
+const (
+	// RoleAdmin 管理员，可以管理用户和后台任务
+	RoleAdmin Role = "admin"
+	// RoleMember 普通成员，可以查看、导出聊天记录，重新生成标题和推送到QQ
+	RoleMember Role = "member"
+	// RoleViewer 只读成员，只能查看聊天记录
+	RoleViewer Role = "viewer"
+)
+
+// Permission 接口权限
+type Permission string
+
+const (
+	PermReadMessages  Permission = "messages:read"  // 查看、检索、导出聊天记录
+	PermWriteMessages Permission = "messages:write" // 重新生成标题、推送到QQ
+	PermManageJobs    Permission = "jobs:manage"    // 查看和重试后台任务
+	PermManageUsers   Permission = "users:manage"   // 创建、修改、删除用户和设置角色
+)
+
+// rolePermissions 各角色拥有的权限
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin:  {PermReadMessages, PermWriteMessages, PermManageJobs, PermManageUsers},
+	RoleMember: {PermReadMessages, PermWriteMessages},
+	RoleViewer: {PermReadMessages},
+}
+
+// Valid 是否为已定义的角色
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can 角色是否拥有指定权限
+func (r Role) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions 角色拥有的全部权限
+func (r Role) Permissions() []Permission {
+	return append([]Permission(nil), rolePermissions[r]...)
+}
+
+// GetRole 用户角色，引入角色之前创建的用户视为普通成员
+func (u *User) GetRole() Role {
+	if u.Role == "" {
+		return RoleMember
+	}
+	return u.Role
+}
+
+// SetRole 设置用户角色
+func (s *UserService) SetRole(ctx context.Context, id string, role Role) error {
+	if !role.Valid() {
+		return errors.New("无效的角色")
+	}
+	return s.UpdateUser(ctx, id, &UserUpdate{Role: &role})
+}
+
+// EnsureAdmin 确保至少存在一个管理员
+// 没有管理员时，把QQ号为 qq 的用户设为管理员，该用户不存在时以QQ号为用户名创建
+func (s *UserService) EnsureAdmin(ctx context.Context, qq string) error {
+	count, err := s.collection.CountDocuments(ctx, bson.M{"role": RoleAdmin})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if qq == "" {
+		return errors.New("没有管理员且未配置ADMIN_UIN")
+	}
+
+	update := bson.M{"$set": bson.M{"role": RoleAdmin, "updated_at": time.Now()}}
+	result, err := s.collection.UpdateOne(ctx, bson.M{"qq": qq}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	return s.CreateUser(ctx, &User{Name: qq, QQ: qq, Role: RoleAdmin})
+}
@@ -0,0 +1,450 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"snail.local/snailllllll/utils"
+)
+
+const (
+	// 单条查询最多使用的词元数量，避免超长查询拖慢检索
+	maxQueryTokens = 32
+	// 每个结果最多返回的片段数量
+	maxSnippets = 3
+	// 片段中命中位置前后保留的字符数
+	snippetRadius = 24
+	// search_text 和 media_refs 的生成规则版本，规则变化后递增，启动时重建旧版本的索引
+	searchTextVersion = 3
+)
+
+// SearchSnippet 命中的消息片段
+type SearchSnippet struct {
+	Nickname  string `json:"nickname"`
+	Time      int64  `json:"time"`
+	Text      string `json:"text"`      // 纯文本片段
+	Highlight string `json:"highlight"` // 已转义的HTML片段，命中部分使用<mark>包裹
+}
+
+// SearchResult 搜索结果
+type SearchResult struct {
+	ID       string          `json:"id"`
+	Title    string          `json:"title"`
+	Sender   string          `json:"sender"`
+	Score    float64         `json:"score"`
+	Snippets []SearchSnippet `json:"snippets"`
+}
+
+// searchDoc 检索时从forward_views解码的字段
+type searchDoc struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Title    string             `bson:"title"`
+	Sender   string             `bson:"sender"`
+	Score    float64            `bson:"score"`
+	Messages []searchMessage    `bson:"messages"`
+}
+
+// searchMessage 检索时使用的消息字段，嵌套的合并转发保存在消息段中
+type searchMessage struct {
+	Time   int64 `bson:"time"`
+	Sender struct {
+		Nickname string `bson:"nickname"`
+		Card     string `bson:"card"`
+	} `bson:"sender"`
+	RawMessage string `bson:"rawmessage"`
+	Segments   []struct {
+		Media   string          `bson:"media"`
+		File    string          `bson:"file"`
+		Forward []searchMessage `bson:"forward"`
+	} `bson:"segments"`
+}
+
+// SearchService 聊天记录全文检索服务
+//
+// MongoDB 自带的文本索引不能切分中文，因此入库时先把标题、昵称和消息文本
+// 切分为词元（中日韩文字使用单字和二元组，其余按单词），以空格拼接后写入
+// search_text 字段，再对该字段建立 language=none 的文本索引。
+// 查询时单字按单字匹配，多字按二元组匹配。
+type SearchService struct {
+	collection *mongo.Collection
+}
+
+// NewSearchService 创建检索服务
+func NewSearchService() *SearchService {
+	return &SearchService{
+		collection: Collection("message_db", "forward_views"),
+	}
+}
+
+// CreateIndexes 创建文本索引
+func (s *SearchService) CreateIndexes(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys: bson.D{{Key: "search_text", Value: "text"}},
+		Options: options.Index().
+			SetName("search_text_text").
+			SetDefaultLanguage("none"),
+	}
+	_, err := s.collection.Indexes().CreateOne(ctx, index)
+	return err
+}
+
+// IndexForwardView 重新计算指定forward_view的search_text和media_refs
+func (s *SearchService) IndexForwardView(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("无效的ID格式")
+	}
+
+	var doc searchDoc
+	if err := s.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&doc); err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": searchTextUpdate(&doc)}
+	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	return err
+}
+
+// searchTextUpdate 写入search_text、引用的媒体文件及其生成规则版本
+func searchTextUpdate(doc *searchDoc) bson.M {
+	return bson.M{
+		"search_text":    buildSearchText(doc),
+		"media_refs":     appendMediaRefs([]string{}, doc.Messages),
+		"search_version": searchTextVersion,
+	}
+}
+
+// BackfillSearchText 为缺少search_text或切分规则已过时的数据重建索引，返回处理数量
+func (s *SearchService) BackfillSearchText(ctx context.Context) (int, error) {
+	filter := bson.M{"search_version": bson.M{"$ne": searchTextVersion}}
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var doc searchDoc
+		if err := cursor.Decode(&doc); err != nil {
+			fmt.Printf("解析forward_view失败: %v\n", err)
+			continue
+		}
+		update := bson.M{"$set": searchTextUpdate(&doc)}
+		if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": doc.ID}, update); err != nil {
+			fmt.Printf("更新search_text失败 %s: %v\n", doc.ID.Hex(), err)
+			continue
+		}
+		count++
+	}
+	return count, cursor.Err()
+}
+
+// Search 检索 viewer 可见的、包含查询内容的聊天记录，按相关度排序
+func (s *SearchService) Search(ctx context.Context, query string, limit int64, viewer *User) ([]SearchResult, error) {
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return []SearchResult{}, nil
+	}
+	if len(tokens) > maxQueryTokens {
+		tokens = tokens[:maxQueryTokens]
+	}
+
+	// 每个词元作为短语查询，多个短语之间为"且"的关系
+	phrases := make([]string, len(tokens))
+	for i, token := range tokens {
+		phrases[i] = fmt.Sprintf("%q", token)
+	}
+	filter := AccessFilter(viewer)
+	filter["$text"] = bson.M{"$search": strings.Join(phrases, " ")}
+	findOptions := options.Find().
+		SetProjection(bson.M{
+			"title":    1,
+			"sender":   1,
+			"messages": 1,
+			"score":    bson.M{"$meta": "textScore"},
+		}).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetLimit(limit)
+
+	cursor, err := s.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	terms := queryTerms(query)
+	results := make([]SearchResult, 0)
+	for cursor.Next(ctx) {
+		var doc searchDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		results = append(results, SearchResult{
+			ID:       doc.ID.Hex(),
+			Title:    doc.Title,
+			Sender:   doc.Sender,
+			Score:    doc.Score,
+			Snippets: buildSnippets(&doc, terms, tokens),
+		})
+	}
+	return results, cursor.Err()
+}
+
+// buildSearchText 拼接标题、昵称和消息文本的词元
+func buildSearchText(doc *searchDoc) string {
+	parts := appendMessageText([]string{doc.Title, doc.Sender}, doc.Messages)
+
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, part := range parts {
+		for _, token := range tokenize(part, true) {
+			if !seen[token] {
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// appendMessageText 收集消息（包括嵌套转发）的昵称和文本
+func appendMessageText(parts []string, messages []searchMessage) []string {
+	for _, msg := range messages {
+		parts = append(parts, msg.Sender.Nickname, msg.Sender.Card, utils.StripCQCode(msg.RawMessage))
+		for _, segment := range msg.Segments {
+			parts = appendMessageText(parts, segment.Forward)
+		}
+	}
+	return parts
+}
+
+// appendMediaRefs 收集消息（包括嵌套转发）引用的媒体存储key和QQ文件名，用于判断媒体文件的访问权限
+// 引入结构化消息段之前的记录从CQ码中读取文件名
+func appendMediaRefs(refs []string, messages []searchMessage) []string {
+	add := func(name string) {
+		if name != "" && !slices.Contains(refs, name) {
+			refs = append(refs, name)
+		}
+	}
+	for _, msg := range messages {
+		for _, segment := range msg.Segments {
+			add(segment.Media)
+			add(segment.File)
+			refs = appendMediaRefs(refs, segment.Forward)
+		}
+		if len(msg.Segments) == 0 {
+			for _, cq := range utils.ParseCQCode(msg.RawMessage) {
+				switch cq.Type {
+				case "image", "record", "video", "file":
+					add(cq.Data["file"])
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// flattenMessages 按对话顺序展开消息，嵌套转发中的消息紧跟在所在消息之后
+func flattenMessages(flat []searchMessage, messages []searchMessage) []searchMessage {
+	for _, msg := range messages {
+		flat = append(flat, msg)
+		for _, segment := range msg.Segments {
+			flat = flattenMessages(flat, segment.Forward)
+		}
+	}
+	return flat
+}
+
+// isCJK 判断字符是否为中日韩文字
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// Tokenize 将查询切分为检索词元
+// 连续的中日韩文字切分为相邻二元组（单字时保留单字），字母数字按单词切分并转为小写
+func Tokenize(text string) []string {
+	return tokenize(text, false)
+}
+
+// tokenize 切分文本，unigrams 为 true 时中日韩文字额外输出每个单字，用于建立索引，
+// 这样单字查询也能命中多字词中的字
+func tokenize(text string, unigrams bool) []string {
+	var tokens []string
+	var cjkRun, wordRun []rune
+
+	flushCJK := func() {
+		if len(cjkRun) == 1 || (unigrams && len(cjkRun) > 0) {
+			for _, r := range cjkRun {
+				tokens = append(tokens, string(r))
+			}
+		}
+		for i := 0; i+1 < len(cjkRun); i++ {
+			tokens = append(tokens, string(cjkRun[i:i+2]))
+		}
+		cjkRun = cjkRun[:0]
+	}
+	flushWord := func() {
+		if len(wordRun) > 0 {
+			tokens = append(tokens, string(wordRun))
+		}
+		wordRun = wordRun[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjkRun = append(cjkRun, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			wordRun = append(wordRun, unicode.ToLower(r))
+		default:
+			flushCJK()
+			flushWord()
+		}
+	}
+	flushCJK()
+	flushWord()
+	return tokens
+}
+
+// queryTerms 按空白切分查询，用于在片段中高亮原始查询词
+func queryTerms(query string) []string {
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		terms = append(terms, strings.ToLower(term))
+	}
+	return terms
+}
+
+// span 命中区间（按rune计）
+type span struct {
+	start, end int
+}
+
+// findSpans 查找text中所有命中区间，优先匹配完整查询词，找不到时退回匹配词元
+func findSpans(text []rune, terms, tokens []string) []span {
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	var spans []span
+	collect := func(needles []string) {
+		for _, needle := range needles {
+			n := []rune(needle)
+			if len(n) == 0 {
+				continue
+			}
+			for i := 0; i+len(n) <= len(lower); i++ {
+				if string(lower[i:i+len(n)]) == needle {
+					spans = append(spans, span{i, i + len(n)})
+				}
+			}
+		}
+	}
+	collect(terms)
+	if len(spans) == 0 {
+		collect(tokens)
+	}
+	return mergeSpans(spans)
+}
+
+// mergeSpans 合并重叠的区间
+func mergeSpans(spans []span) []span {
+	if len(spans) == 0 {
+		return spans
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	merged := []span{spans[0]}
+	for _, sp := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if sp.start <= last.end {
+			if sp.end > last.end {
+				last.end = sp.end
+			}
+			continue
+		}
+		merged = append(merged, sp)
+	}
+	return merged
+}
+
+// buildSnippets 选出命中最多的几条消息并生成高亮片段
+func buildSnippets(doc *searchDoc, terms, tokens []string) []SearchSnippet {
+	type candidate struct {
+		index int
+		text  []rune
+		spans []span
+	}
+
+	// 嵌套转发中的消息同样可以生成片段
+	messages := flattenMessages(nil, doc.Messages)
+	var candidates []candidate
+	for i, msg := range messages {
+		text := []rune(utils.StripCQCode(msg.RawMessage))
+		if spans := findSpans(text, terms, tokens); len(spans) > 0 {
+			candidates = append(candidates, candidate{i, text, spans})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].spans) > len(candidates[j].spans)
+	})
+	if len(candidates) > maxSnippets {
+		candidates = candidates[:maxSnippets]
+	}
+	// 恢复为对话中的先后顺序
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].index < candidates[j].index })
+
+	snippets := make([]SearchSnippet, 0, len(candidates))
+	for _, c := range candidates {
+		msg := messages[c.index]
+		start := c.spans[0].start - snippetRadius
+		if start < 0 {
+			start = 0
+		}
+		end := c.spans[0].end + snippetRadius
+		if end > len(c.text) {
+			end = len(c.text)
+		}
+
+		var highlight strings.Builder
+		if start > 0 {
+			highlight.WriteString("…")
+		}
+		pos := start
+		for _, sp := range c.spans {
+			if sp.start < start || sp.end > end {
+				continue
+			}
+			highlight.WriteString(html.EscapeString(string(c.text[pos:sp.start])))
+			highlight.WriteString("<mark>")
+			highlight.WriteString(html.EscapeString(string(c.text[sp.start:sp.end])))
+			highlight.WriteString("</mark>")
+			pos = sp.end
+		}
+		highlight.WriteString(html.EscapeString(string(c.text[pos:end])))
+		if end < len(c.text) {
+			highlight.WriteString("…")
+		}
+
+		snippets = append(snippets, SearchSnippet{
+			Nickname:  msg.Sender.Nickname,
+			Time:      msg.Time,
+			Text:      string(c.text[start:end]),
+			Highlight: highlight.String(),
+		})
+	}
+	return snippets
+}
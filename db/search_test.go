@@ -0,0 +1,90 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"聊天记录", []string{"聊天", "天记", "记录"}},
+		{"猫", []string{"猫"}},
+		{"Hello, World", []string{"hello", "world"}},
+		{"用Go写的bot", []string{"用", "go", "写的", "bot"}},
+		{"v2 版本", []string{"v2", "版本"}},
+		{"ひらがなカナ", []string{"ひら", "らが", "がな", "なカ", "カナ"}},
+		{"한국어", []string{"한국", "국어"}},
+		{"！？ …", nil},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizeUnigrams(t *testing.T) {
+	// 建立索引时额外输出单字，单字查询也能命中
+	got := tokenize("聊天 ok", true)
+	want := []string{"聊", "天", "聊天", "ok"}
+	if !slices.Equal(got, want) {
+		t.Errorf("tokenize() = %q, want %q", got, want)
+	}
+	for _, token := range Tokenize("天") {
+		if !slices.Contains(got, token) {
+			t.Errorf("query token %q not indexed", token)
+		}
+	}
+}
+
+func TestFindSpans(t *testing.T) {
+	text := []rune("今天聊天记录很多，聊天很开心")
+	// 完整的查询词优先
+	spans := findSpans(text, queryTerms("聊天记录"), Tokenize("聊天记录"))
+	if len(spans) != 1 || spans[0] != (span{2, 6}) {
+		t.Errorf("findSpans() = %v, want [{2 6}]", spans)
+	}
+	// 找不到完整查询词时按词元匹配，重叠的区间合并
+	spans = findSpans(text, queryTerms("聊天开心"), Tokenize("聊天开心"))
+	want := []span{{2, 4}, {9, 11}, {12, 14}}
+	if !slices.Equal(spans, want) {
+		t.Errorf("findSpans() = %v, want %v", spans, want)
+	}
+}
+
+func TestMergeSpans(t *testing.T) {
+	got := mergeSpans([]span{{5, 8}, {0, 2}, {1, 3}, {7, 9}, {10, 11}})
+	want := []span{{0, 3}, {5, 9}, {10, 11}}
+	if !slices.Equal(got, want) {
+		t.Errorf("mergeSpans() = %v, want %v", got, want)
+	}
+}
+
+func TestAppendMediaRefs(t *testing.T) {
+	var nested searchMessage
+	nested.Segments = append(nested.Segments, struct {
+		Media   string          `bson:"media"`
+		File    string          `bson:"file"`
+		Forward []searchMessage `bson:"forward"`
+	}{Media: "ab/abc.jpg", File: "abc.jpg"})
+
+	var outer searchMessage
+	outer.Segments = append(outer.Segments, struct {
+		Media   string          `bson:"media"`
+		File    string          `bson:"file"`
+		Forward []searchMessage `bson:"forward"`
+	}{Forward: []searchMessage{nested, nested}})
+
+	// 没有消息段的历史记录从CQ码读取文件名
+	var legacy searchMessage
+	legacy.RawMessage = "看图[CQ:image,file=old.jpg,url=http://x][CQ:face,id=1]"
+
+	got := appendMediaRefs([]string{}, []searchMessage{outer, legacy})
+	want := []string{"ab/abc.jpg", "abc.jpg", "old.jpg"}
+	if !slices.Equal(got, want) {
+		t.Errorf("appendMediaRefs() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"snail.local/snailllllll/utils"
+)
+
+const (
+	// 分享链接默认有效期
+	DefaultShareTTL = 7 * 24 * time.Hour
+	// 分享链接最长有效期
+	MaxShareTTL = 30 * 24 * time.Hour
+)
+
+// ErrShareLinkInvalid 分享链接不存在、已撤销、已过期或记录已不再公开
+var ErrShareLinkInvalid = errors.New("分享链接无效或已过期")
+
+// ShareLink 聊天记录的公开分享链接
+type ShareLink struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Token     string             `bson:"-" json:"token,omitempty"`     // 链接中的随机令牌，只在创建时返回，不保存
+	TokenHash string             `bson:"token_hash" json:"-"`          // 令牌的HMAC
+	ForwardId string             `bson:"forward_id" json:"forward_id"` // 分享的forward_view
+	CreatedBy string             `bson:"created_by" json:"created_by"` // 创建者用户名
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	RevokedAt *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// ShareLinkService 分享链接服务
+type ShareLinkService struct {
+	collection *mongo.Collection
+}
+
+// NewShareLinkService 创建分享链接服务
+func NewShareLinkService() *ShareLinkService {
+	return &ShareLinkService{
+		collection: Collection("message_db", "share_links"),
+	}
+}
+
+// Create 为聊天记录创建分享链接，ttl 为0时使用默认有效期
+func (s *ShareLinkService) Create(ctx context.Context, forwardId, createdBy string, ttl time.Duration) (*ShareLink, error) {
+	if ttl <= 0 {
+		ttl = DefaultShareTTL
+	}
+	if ttl > MaxShareTTL {
+		return nil, errors.New("有效期过长")
+	}
+
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, err
+	}
+
+	token := hex.EncodeToString(bytes)
+	now := time.Now()
+	link := &ShareLink{
+		Token:     token,
+		TokenHash: utils.HashSecret(token),
+		ForwardId: forwardId,
+		CreatedBy: createdBy,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	result, err := s.collection.InsertOne(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
+		link.ID = oid
+	}
+	return link, nil
+}
+
+// List 获取聊天记录的分享链接
+func (s *ShareLinkService) List(ctx context.Context, forwardId string) ([]ShareLink, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"forward_id": forwardId}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	links := make([]ShareLink, 0)
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// Revoke 撤销分享链接
+func (s *ShareLinkService) Revoke(ctx context.Context, forwardId, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("无效的ID格式")
+	}
+
+	filter := bson.M{"_id": objectID, "forward_id": forwardId, "revoked_at": bson.M{"$exists": false}}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("分享链接不存在或已撤销")
+	}
+	return nil
+}
+
+// Resolve 校验分享令牌，返回对应的forward_view ID
+// 记录的可见范围改为非公开后，已有的链接同时失效
+func (s *ShareLinkService) Resolve(ctx context.Context, token string) (string, error) {
+	filter := bson.M{
+		"token_hash": utils.HashSecret(token),
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	var link ShareLink
+	if err := s.collection.FindOne(ctx, filter).Decode(&link); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", ErrShareLinkInvalid
+		}
+		return "", err
+	}
+
+	visibility, err := NewForwardViewService().GetVisibility(ctx, link.ForwardId)
+	if err != nil {
+		if errors.Is(err, ErrForwardViewNotFound) {
+			return "", ErrShareLinkInvalid
+		}
+		return "", err
+	}
+	if visibility != VisibilityPublic {
+		return "", ErrShareLinkInvalid
+	}
+	return link.ForwardId, nil
+}
+
+// MigratePlaintextTokens 将明文保存的历史分享令牌转换为HMAC，已有的链接继续有效，返回迁移数量
+// 需要在 CreateIndexes 之前调用：先删除旧的 token 唯一索引，否则去掉明文字段后会出现重复的空值
+func (s *ShareLinkService) MigratePlaintextTokens(ctx context.Context) (int, error) {
+	if _, err := s.collection.Indexes().DropOne(ctx, "token_1"); err != nil {
+		var cmdErr mongo.CommandError
+		// 集合或索引不存在（新部署或已迁移）时忽略
+		if !errors.As(err, &cmdErr) || (cmdErr.Code != 26 && cmdErr.Code != 27) {
+			return 0, err
+		}
+	}
+
+	cursor, err := s.collection.Find(ctx, bson.M{"token": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Token string             `bson:"token"`
+		}
+		if err := cursor.Decode(&legacy); err != nil {
+			return count, err
+		}
+		update := bson.M{
+			"$set":   bson.M{"token_hash": utils.HashSecret(legacy.Token)},
+			"$unset": bson.M{"token": ""},
+		}
+		if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": legacy.ID}, update); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, cursor.Err()
+}
+
+// CreateIndexes 创建索引，过期的链接由TTL索引自动删除
+func (s *ShareLinkService) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.M{"token_hash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.M{"forward_id": 1},
+		},
+		{
+			Keys:    bson.M{"expires_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"snail.local/snailllllll/utils"
+)
+
+func TestShareLinkTokenNotStored(t *testing.T) {
+	link := ShareLink{Token: "raw-token", TokenHash: utils.HashSecret("raw-token")}
+	data, err := bson.Marshal(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored bson.M
+	if err := bson.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored["token"]; ok {
+		t.Error("plaintext token is stored")
+	}
+	if stored["token_hash"] != link.TokenHash {
+		t.Errorf("token_hash = %v", stored["token_hash"])
+	}
+}
+
+// TestShareLinkResolve 需要 MongoDB，通过 MONGO_TEST_URI 指定
+func TestShareLinkResolve(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI 未设置")
+	}
+	if err := Init(uri); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	s := NewShareLinkService()
+	forwardId := primitive.NewObjectID().Hex()
+	t.Cleanup(func() { s.collection.DeleteMany(context.Background(), bson.M{"forward_id": forwardId}) })
+
+	link, err := s.Create(ctx, forwardId, "alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 数据库中只有令牌的哈希，用哈希本身不能访问
+	if _, err := s.Resolve(ctx, link.TokenHash); !errors.Is(err, ErrShareLinkInvalid) {
+		t.Errorf("Resolve() with stored hash error = %v, want ErrShareLinkInvalid", err)
+	}
+	links, err := s.List(ctx, forwardId)
+	if err != nil || len(links) != 1 || links[0].Token != "" {
+		t.Errorf("List() = %+v, %v", links, err)
+	}
+
+	// 历史的明文令牌迁移后继续有效
+	legacy := primitive.NewObjectID()
+	if _, err := s.collection.InsertOne(ctx, bson.M{"_id": legacy, "token": "legacy-token", "forward_id": forwardId}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MigratePlaintextTokens(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var migrated bson.M
+	if err := s.collection.FindOne(ctx, bson.M{"_id": legacy}).Decode(&migrated); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := migrated["token"]; ok || migrated["token_hash"] != utils.HashSecret("legacy-token") {
+		t.Errorf("migrated link = %v", migrated)
+	}
+}
@@ -5,23 +5,60 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"snail.local/snailllllll/utils"
 )
 
-// UserToken 用户token结构体
+const (
+	// tokenSlidingTTL 每次使用后token的有效期
+	tokenSlidingTTL = 30 * 24 * time.Hour
+	// tokenMaxLifetime token从创建起的最长有效期，到期后必须重新登录
+	tokenMaxLifetime = 90 * 24 * time.Hour
+	// tokenTouchInterval 最后使用时间的最小更新间隔，避免每个请求都写数据库
+	tokenTouchInterval = time.Minute
+)
+
+// UserToken 用户token结构体，每个token对应一个登录会话
 type UserToken struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"` // token ID
-	Name      string             `bson:"name" json:"name"`                  // 用户名
-	Channel   string             `bson:"channel" json:"channel"`            // 渠道 (qq/phone)
-	Token     string             `bson:"token" json:"token"`                // token字符串
-	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`      // 过期时间
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`      // 创建时间
-	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`      // 更新时间
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`                        // token ID
+	Name              string             `bson:"name" json:"name"`                                         // 用户名
+	Channel           string             `bson:"channel" json:"channel"`                                   // 渠道 (qq/phone)
+	Token             string             `bson:"-" json:"token,omitempty"`                                 // token字符串，只在创建时返回，不保存
+	TokenHash         string             `bson:"token_hash" json:"-"`                                      // token的HMAC
+	ExpiresAt         time.Time          `bson:"expires_at" json:"expires_at"`                             // 过期时间，每次使用后顺延
+	AbsoluteExpiresAt time.Time          `bson:"absolute_expires_at,omitempty" json:"absolute_expires_at"` // 最长有效期，不会顺延
+	LastUsedAt        time.Time          `bson:"last_used_at,omitempty" json:"last_used_at"`               // 最后使用时间
+	IP                string             `bson:"ip,omitempty" json:"ip,omitempty"`                         // 最后使用的IP
+	UserAgent         string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`         // 最后使用的User-Agent
+	CreatedAt         time.Time          `bson:"created_at" json:"created_at"`                             // 创建时间
+	UpdatedAt         time.Time          `bson:"updated_at" json:"updated_at"`                             // 更新时间
+}
+
+// absoluteExpiry 最长有效期，引入该字段之前创建的token从创建时间起算
+func (t *UserToken) absoluteExpiry() time.Time {
+	if t.AbsoluteExpiresAt.IsZero() {
+		return t.CreatedAt.Add(tokenMaxLifetime)
+	}
+	return t.AbsoluteExpiresAt
+}
+
+// Session 会话信息，不包含token本身
+type Session struct {
+	ID                string    `json:"id"`
+	Channel           string    `json:"channel"`
+	IP                string    `json:"ip"`
+	UserAgent         string    `json:"user_agent"`
+	CreatedAt         time.Time `json:"created_at"`
+	LastUsedAt        time.Time `json:"last_used_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at"`
+	Current           bool      `json:"current"` // 是否为当前请求使用的会话
 }
 
 // TokenService token服务
@@ -36,8 +73,8 @@ func NewTokenService() *TokenService {
 	}
 }
 
-// GenerateUserToken 生成用户token并存储到MongoDB
-func (s *TokenService) GenerateUserToken(ctx context.Context, name, channel string) (*UserToken, error) {
+// GenerateUserToken 生成用户token并存储到MongoDB，ip 和 userAgent 用于会话列表展示
+func (s *TokenService) GenerateUserToken(ctx context.Context, name, channel, ip, userAgent string) (*UserToken, error) {
 	// 生成随机token
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
@@ -45,16 +82,19 @@ func (s *TokenService) GenerateUserToken(ctx context.Context, name, channel stri
 	}
 	token := hex.EncodeToString(tokenBytes)
 
-	// 设置过期时间为30天后
-	expiresAt := time.Now().Add(30 * 24 * time.Hour)
-
+	now := time.Now()
 	userToken := &UserToken{
-		Name:      name,
-		Channel:   channel,
-		Token:     token,
-		ExpiresAt: expiresAt,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Name:              name,
+		Channel:           channel,
+		Token:             token,
+		TokenHash:         utils.HashSecret(token),
+		ExpiresAt:         now.Add(tokenSlidingTTL),
+		AbsoluteExpiresAt: now.Add(tokenMaxLifetime),
+		LastUsedAt:        now,
+		IP:                ip,
+		UserAgent:         userAgent,
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}
 
 	// 插入新token
@@ -71,11 +111,9 @@ func (s *TokenService) GenerateUserToken(ctx context.Context, name, channel stri
 	return userToken, nil
 }
 
-// ValidateToken 验证token是否有效，如果有效则更新过期时间
-func (s *TokenService) ValidateToken(ctx context.Context, token string) (bool, *UserToken, error) {
-	var userToken UserToken
-	filter := bson.M{"token": token}
-	err := s.collection.FindOne(ctx, filter).Decode(&userToken)
+// ValidateToken 验证token是否有效，如果有效则顺延过期时间（不超过最长有效期）并记录使用信息
+func (s *TokenService) ValidateToken(ctx context.Context, token, ip, userAgent string) (bool, *UserToken, error) {
+	userToken, err := s.findByToken(ctx, token)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return false, nil, nil
@@ -84,34 +122,50 @@ func (s *TokenService) ValidateToken(ctx context.Context, token string) (bool, *
 	}
 
 	// 检查是否过期
-	if time.Now().After(userToken.ExpiresAt) {
+	now := time.Now()
+	absoluteExpiresAt := userToken.absoluteExpiry()
+	if now.After(userToken.ExpiresAt) || now.After(absoluteExpiresAt) {
 		return false, nil, nil
 	}
 
-	// 更新过期时间（延长30天）
-	newExpiresAt := time.Now().Add(30 * 24 * time.Hour)
+	// 短时间内重复使用且来源不变时不更新
+	if now.Sub(userToken.LastUsedAt) < tokenTouchInterval && userToken.IP == ip && userToken.UserAgent == userAgent {
+		return true, userToken, nil
+	}
+
+	// 顺延过期时间，但不超过最长有效期
+	newExpiresAt := now.Add(tokenSlidingTTL)
+	if newExpiresAt.After(absoluteExpiresAt) {
+		newExpiresAt = absoluteExpiresAt
+	}
 	update := bson.M{
 		"$set": bson.M{
-			"expires_at": newExpiresAt,
-			"updated_at": time.Now(),
+			"expires_at":          newExpiresAt,
+			"absolute_expires_at": absoluteExpiresAt,
+			"last_used_at":        now,
+			"ip":                  ip,
+			"user_agent":          userAgent,
+			"updated_at":          now,
 		},
 	}
 
-	_, err = s.collection.UpdateOne(ctx, filter, update)
+	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": userToken.ID}, update)
 	if err != nil {
 		return false, nil, err
 	}
 
-	// 更新内存中的过期时间
+	// 更新内存中的会话信息
 	userToken.ExpiresAt = newExpiresAt
-	return true, &userToken, nil
+	userToken.AbsoluteExpiresAt = absoluteExpiresAt
+	userToken.LastUsedAt = now
+	userToken.IP = ip
+	userToken.UserAgent = userAgent
+	return true, userToken, nil
 }
 
 // GetUserByToken 从token获取用户信息
 func (s *TokenService) GetUserByToken(ctx context.Context, token string) (*UserToken, error) {
-	var userToken UserToken
-	filter := bson.M{"token": token}
-	err := s.collection.FindOne(ctx, filter).Decode(&userToken)
+	userToken, err := s.findByToken(ctx, token)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, errors.New("token不存在")
@@ -120,10 +174,23 @@ func (s *TokenService) GetUserByToken(ctx context.Context, token string) (*UserT
 	}
 
 	// 检查是否过期
-	if time.Now().After(userToken.ExpiresAt) {
+	if time.Now().After(userToken.ExpiresAt) || time.Now().After(userToken.absoluteExpiry()) {
 		return nil, errors.New("token已过期")
 	}
 
+	return userToken, nil
+}
+
+// findByToken 根据token的HMAC查找记录，并以常量时间再次比较
+func (s *TokenService) findByToken(ctx context.Context, token string) (*UserToken, error) {
+	hash := utils.HashSecret(token)
+	var userToken UserToken
+	if err := s.collection.FindOne(ctx, bson.M{"token_hash": hash}).Decode(&userToken); err != nil {
+		return nil, err
+	}
+	if !utils.SecretEqual(userToken.TokenHash, hash) {
+		return nil, mongo.ErrNoDocuments
+	}
 	return &userToken, nil
 }
 
@@ -149,7 +216,7 @@ func (s *TokenService) GetUserFromContext(ctx context.Context, c interface{}) (s
 
 // DeleteToken 删除token
 func (s *TokenService) DeleteToken(ctx context.Context, token string) error {
-	filter := bson.M{"token": token}
+	filter := bson.M{"token_hash": utils.HashSecret(token)}
 	result, err := s.collection.DeleteOne(ctx, filter)
 	if err != nil {
 		return err
@@ -160,11 +227,120 @@ func (s *TokenService) DeleteToken(ctx context.Context, token string) error {
 	return nil
 }
 
+// ListSessions 获取用户未过期的会话，按最后使用时间倒序，currentToken 对应的会话标记为当前会话
+func (s *TokenService) ListSessions(ctx context.Context, name, currentToken string) ([]Session, error) {
+	filter := bson.M{"name": name, "expires_at": bson.M{"$gt": time.Now()}}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []UserToken
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	currentHash := utils.HashSecret(currentToken)
+	sessions := make([]Session, 0, len(tokens))
+	for _, token := range tokens {
+		absoluteExpiresAt := token.absoluteExpiry()
+		if now.After(absoluteExpiresAt) {
+			continue
+		}
+		lastUsedAt := token.LastUsedAt
+		if lastUsedAt.IsZero() {
+			lastUsedAt = token.UpdatedAt
+		}
+		sessions = append(sessions, Session{
+			ID:                token.ID.Hex(),
+			Channel:           token.Channel,
+			IP:                token.IP,
+			UserAgent:         token.UserAgent,
+			CreatedAt:         token.CreatedAt,
+			LastUsedAt:        lastUsedAt,
+			ExpiresAt:         token.ExpiresAt,
+			AbsoluteExpiresAt: absoluteExpiresAt,
+			Current:           utils.SecretEqual(token.TokenHash, currentHash),
+		})
+	}
+	return sessions, nil
+}
+
+// RevokeSession 撤销用户的指定会话
+func (s *TokenService) RevokeSession(ctx context.Context, name, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("无效的ID格式")
+	}
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": objectID, "name": name})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("会话不存在")
+	}
+	return nil
+}
+
+// RevokeAllSessions 撤销用户的全部会话，exceptToken 不为空时保留该会话，返回撤销数量
+func (s *TokenService) RevokeAllSessions(ctx context.Context, name, exceptToken string) (int64, error) {
+	filter := bson.M{"name": name}
+	if exceptToken != "" {
+		filter["token_hash"] = bson.M{"$ne": utils.HashSecret(exceptToken)}
+	}
+	result, err := s.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// MigratePlaintextTokens 将明文保存的历史token转换为HMAC，返回迁移数量
+// 需要在 CreateIndexes 之前调用：先删除旧的 token 唯一索引，否则去掉明文字段后会出现重复的空值
+func (s *TokenService) MigratePlaintextTokens(ctx context.Context) (int, error) {
+	if _, err := s.collection.Indexes().DropOne(ctx, "token_1"); err != nil {
+		var cmdErr mongo.CommandError
+		// 集合或索引不存在（新部署或已迁移）时忽略
+		if !errors.As(err, &cmdErr) || (cmdErr.Code != 26 && cmdErr.Code != 27) {
+			return 0, err
+		}
+	}
+
+	cursor, err := s.collection.Find(ctx, bson.M{"token": bson.M{"$exists": true}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	count := 0
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Token string             `bson:"token"`
+		}
+		if err := cursor.Decode(&legacy); err != nil {
+			return count, err
+		}
+		update := bson.M{
+			"$set":   bson.M{"token_hash": utils.HashSecret(legacy.Token)},
+			"$unset": bson.M{"token": ""},
+		}
+		if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": legacy.ID}, update); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, cursor.Err()
+}
+
 // CreateIndexes 创建索引
 func (s *TokenService) CreateIndexes(ctx context.Context) error {
 	indexes := []mongo.IndexModel{
 		{
-			Keys:    bson.M{"token": 1},
+			Keys:    bson.M{"token_hash": 1},
 			Options: options.Index().SetUnique(true),
 		},
 		{
@@ -179,9 +355,33 @@ func (s *TokenService) CreateIndexes(ctx context.Context) error {
 	return err
 }
 
-// CleanExpiredTokens 清理过期token
+// CleanExpiredTokens 清理过期token，包括超过最长有效期的token
 func (s *TokenService) CleanExpiredTokens(ctx context.Context) error {
-	filter := bson.M{"expires_at": bson.M{"$lt": time.Now()}}
+	now := time.Now()
+	filter := bson.M{"$or": []bson.M{
+		{"expires_at": bson.M{"$lt": now}},
+		{"absolute_expires_at": bson.M{"$lt": now}},
+		// 引入最长有效期之前创建、之后未再使用的token
+		{"absolute_expires_at": bson.M{"$exists": false}, "created_at": bson.M{"$lt": now.Add(-tokenMaxLifetime)}},
+	}}
 	_, err := s.collection.DeleteMany(ctx, filter)
 	return err
 }
+
+// StartCleanup 定期清理过期token，ctx 取消时停止
+func (s *TokenService) StartCleanup(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.CleanExpiredTokens(ctx); err != nil && ctx.Err() == nil {
+				fmt.Printf("清理过期token失败: %v\n", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -2,7 +2,11 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -18,8 +22,11 @@ type User struct {
 	Name      string             `bson:"name" json:"name"`                  // 用户名，唯一键
 	QQ        string             `bson:"qq" json:"qq"`                      // QQ号
 	Phone     string             `bson:"phone" json:"phone"`                // 手机号
+	Role      Role               `bson:"role" json:"role"`                  // 角色，为空时视为 member
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`      // 创建时间
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`      // 更新时间
+
+	Groups []int64 `bson:"-" json:"-"` // 所在的QQ群，由 GroupMemberService 查询，用于判断群成员可见的记录
 }
 
 // UserService 用户服务
@@ -45,6 +52,22 @@ func (s *UserService) CreateUser(ctx context.Context, user *User) error {
 	if count > 0 {
 		return errors.New("用户名已存在")
 	}
+	if user.QQ != "" {
+		count, err := s.collection.CountDocuments(ctx, bson.M{"qq": user.QQ})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("QQ号已被其他用户使用")
+		}
+	}
+
+	if user.Role == "" {
+		user.Role = RoleMember
+	}
+	if !user.Role.Valid() {
+		return errors.New("无效的角色")
+	}
 
 	// 设置时间戳
 	user.CreatedAt = time.Now()
@@ -53,7 +76,7 @@ func (s *UserService) CreateUser(ctx context.Context, user *User) error {
 	// 插入用户
 	result, err := s.collection.InsertOne(ctx, user)
 	if err != nil {
-		return err
+		return duplicateUserError(err, "用户名已存在")
 	}
 
 	// 获取插入的ID
@@ -97,16 +120,55 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*User, error)
 	return &user, nil
 }
 
+// UserUpdate 更新用户的字段，为 nil 的字段保持不变
+type UserUpdate struct {
+	Name  *string `json:"name"`
+	QQ    *string `json:"qq"`
+	Phone *string `json:"phone"`
+	Role  *Role   `json:"role"`
+}
+
+var (
+	// SelfEditableUserFields 用户可以修改自己的字段
+	SelfEditableUserFields = []string{"phone"}
+	// ManagedUserFields 拥有 PermManageUsers 权限时可以修改的字段
+	ManagedUserFields = []string{"name", "qq", "phone", "role"}
+)
+
+// ParseUserUpdate 解析更新请求，字段名区分大小写，包含 allowed 以外的字段时返回错误
+func ParseUserUpdate(data []byte, allowed []string) (*UserUpdate, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name := range fields {
+		if !slices.Contains(allowed, name) {
+			return nil, fmt.Errorf("不允许修改字段: %s", name)
+		}
+	}
+
+	// 字段名已精确校验，encoding/json 的大小写不敏感匹配不会再引入其他字段
+	var update UserUpdate
+	if err := json.Unmarshal(data, &update); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
 // UpdateUser 更新用户信息
-func (s *UserService) UpdateUser(ctx context.Context, id string, updateData map[string]interface{}) error {
+func (s *UserService) UpdateUser(ctx context.Context, id string, update *UserUpdate) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return errors.New("无效的ID格式")
 	}
 
-	// 检查用户名是否被其他用户使用
-	if name, ok := updateData["name"].(string); ok {
-		filter := bson.M{"name": name, "_id": bson.M{"$ne": objectID}}
+	set := bson.M{}
+	if update.Name != nil {
+		if *update.Name == "" {
+			return errors.New("用户名不能为空")
+		}
+		// 检查用户名是否被其他用户使用
+		filter := bson.M{"name": *update.Name, "_id": bson.M{"$ne": objectID}}
 		count, err := s.collection.CountDocuments(ctx, filter)
 		if err != nil {
 			return err
@@ -114,17 +176,42 @@ func (s *UserService) UpdateUser(ctx context.Context, id string, updateData map[
 		if count > 0 {
 			return errors.New("用户名已被其他用户使用")
 		}
+		set["name"] = *update.Name
+	}
+	if update.QQ != nil {
+		// QQ号决定聊天记录的归属，不能与其他用户重复
+		if *update.QQ != "" {
+			filter := bson.M{"qq": *update.QQ, "_id": bson.M{"$ne": objectID}}
+			count, err := s.collection.CountDocuments(ctx, filter)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return errors.New("QQ号已被其他用户使用")
+			}
+		}
+		set["qq"] = *update.QQ
+	}
+	if update.Phone != nil {
+		set["phone"] = *update.Phone
+	}
+	if update.Role != nil {
+		if !update.Role.Valid() {
+			return errors.New("无效的角色")
+		}
+		set["role"] = *update.Role
+	}
+	if len(set) == 0 {
+		return errors.New("没有需要更新的字段")
 	}
 
 	// 设置更新时间
-	updateData["updated_at"] = time.Now()
-
-	update := bson.M{"$set": updateData}
+	set["updated_at"] = time.Now()
 	filter := bson.M{"_id": objectID}
 
-	result, err := s.collection.UpdateOne(ctx, filter, update)
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": set})
 	if err != nil {
-		return err
+		return duplicateUserError(err, "用户名已被其他用户使用")
 	}
 	if result.MatchedCount == 0 {
 		return errors.New("用户不存在")
@@ -198,6 +285,9 @@ func (s *UserService) GetUsersByPage(ctx context.Context, page, pageSize int64)
 	return users, total, nil
 }
 
+// userQQIndex QQ号唯一索引的名称，只约束非空的QQ号
+const userQQIndex = "qq_unique"
+
 // CreateIndexes 创建索引
 func (s *UserService) CreateIndexes(ctx context.Context) error {
 	indexes := []mongo.IndexModel{
@@ -206,13 +296,51 @@ func (s *UserService) CreateIndexes(ctx context.Context) error {
 			Options: options.Index().SetUnique(true),
 		},
 		{
-			Keys: bson.M{"qq": 1},
+			Keys: bson.M{"phone": 1},
 		},
 		{
-			Keys: bson.M{"phone": 1},
+			Keys: bson.M{"role": 1},
 		},
 	}
 
-	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
-	return err
+	if _, err := s.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	// 删除旧的非唯一QQ号索引，集合或索引不存在时忽略
+	if _, err := s.collection.Indexes().DropOne(ctx, "qq_1"); err != nil {
+		var cmdErr mongo.CommandError
+		if !errors.As(err, &cmdErr) || (cmdErr.Code != 26 && cmdErr.Code != 27) {
+			return err
+		}
+	}
+	// QQ号决定聊天记录的归属，由唯一索引保证并发创建和修改时也不会重复
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"qq": 1},
+		Options: options.Index().
+			SetName(userQQIndex).
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"qq": bson.M{"$type": "string", "$gt": ""}}),
+	})
+	if err != nil {
+		return fmt.Errorf("创建QQ号唯一索引失败，请检查是否有重复的QQ号: %w", err)
+	}
+	return nil
+}
+
+// duplicateUserError 将唯一索引冲突转换为与提前检查相同的错误，其他错误原样返回
+// 提前检查和写入之间可能有并发的请求写入相同的用户名或QQ号
+func duplicateUserError(err error, nameTaken string) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		for _, e := range writeErr.WriteErrors {
+			if strings.Contains(e.Message, userQQIndex) {
+				return errors.New("QQ号已被其他用户使用")
+			}
+		}
+	}
+	return errors.New(nameTaken)
 }
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestParseUserUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		allowed []string
+		wantErr bool
+	}{
+		{"self phone", `{"phone":"13800000000"}`, SelfEditableUserFields, false},
+		{"self role", `{"role":"admin"}`, SelfEditableUserFields, true},
+		{"self role case variant", `{"Role":"admin"}`, SelfEditableUserFields, true},
+		{"self phone case variant", `{"PHONE":"13800000000"}`, SelfEditableUserFields, true},
+		{"self qq", `{"qq":"10001"}`, SelfEditableUserFields, true},
+		{"self unknown field", `{"phone":"1","created_at":"2020-01-01T00:00:00Z"}`, SelfEditableUserFields, true},
+		{"self id", `{"_id":"000000000000000000000000"}`, SelfEditableUserFields, true},
+		{"managed role", `{"role":"admin","qq":"10001"}`, ManagedUserFields, false},
+		{"managed case variant", `{"Role":"admin"}`, ManagedUserFields, true},
+		{"not an object", `["phone"]`, SelfEditableUserFields, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update, err := ParseUserUpdate([]byte(tt.body), tt.allowed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUserUpdate(%s) error = %v, wantErr %v", tt.body, err, tt.wantErr)
+			}
+			if err == nil && update.Role != nil && !slices.Contains(tt.allowed, "role") {
+				t.Errorf("ParseUserUpdate(%s) set role without permission", tt.body)
+			}
+		})
+	}
+
+	update, err := ParseUserUpdate([]byte(`{"phone":"13800000000"}`), SelfEditableUserFields)
+	if err != nil || update.Phone == nil || *update.Phone != "13800000000" || update.Name != nil || update.QQ != nil {
+		t.Errorf("ParseUserUpdate() = %+v, %v", update, err)
+	}
+}
+
+func TestDuplicateUserError(t *testing.T) {
+	duplicate := func(message string) error {
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: message}}}
+	}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{duplicate("E11000 duplicate key error collection: message_db.users index: qq_unique dup key: { qq: \"10001\" }"), "QQ号已被其他用户使用"},
+		{duplicate("E11000 duplicate key error collection: message_db.users index: name_1 dup key: { name: \"alice\" }"), "用户名已存在"},
+		{errors.New("connection reset"), "connection reset"},
+	}
+	for _, tt := range tests {
+		if got := duplicateUserError(tt.err, "用户名已存在"); got.Error() != tt.want {
+			t.Errorf("duplicateUserError(%v) = %v, want %s", tt.err, got, tt.want)
+		}
+	}
+}
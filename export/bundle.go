@@ -0,0 +1,71 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// WriteJSON 写出规范化的JSON
+func (e *Export) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(e.Document)
+}
+
+// WriteZip 写出包含 HTML、Markdown、JSON 和 media 目录的 zip 包
+func (e *Export) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"index.html", func(w io.Writer) error { return e.WriteHTML(w, false) }},
+		{"conversation.md", e.WriteMarkdown},
+		{"conversation.json", e.WriteJSON},
+	}
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if err := file.write(writer); err != nil {
+			return err
+		}
+	}
+
+	paths := make([]string, 0, len(e.assets))
+	for path := range e.assets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := writeAsset(archive, path, e.assets[path]); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// writeAsset 从媒体存储读取文件直接写入 zip 包，打开失败时跳过该文件
+func writeAsset(archive *zip.Writer, path string, a *asset) error {
+	reader, err := a.open()
+	if err != nil {
+		fmt.Printf("读取媒体文件失败 %s: %v\n", path, err)
+		return nil
+	}
+	defer reader.Close()
+
+	// 媒体文件大多已经压缩，直接存储
+	writer, err := archive.CreateHeader(&zip.FileHeader{Name: path, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, reader)
+	return err
+}
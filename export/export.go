@@ -0,0 +1,402 @@
+// Package export 将归档的聊天记录导出为独立的 HTML、Markdown、JSON 文件或 zip 包
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"memento_backend/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"snail.local/snailllllll/napcat_go_sdk"
+	"snail.local/snailllllll/utils"
+)
+
+// Format 导出格式
+type Format string
+
+const (
+	FormatHTML     Format = "html"
+	FormatMarkdown Format = "md"
+	FormatJSON     Format = "json"
+	FormatZip      Format = "zip"
+)
+
+const (
+	// 导出文档格式版本，结构不兼容变化时递增
+	documentVersion = 1
+	// 单个媒体文件大小上限，超过时不导出内容
+	maxAssetSize = 50 << 20
+	// HTML 中以 data URI 内嵌的单个文件大小上限，超过时只显示文件名
+	maxEmbedSize = 10 << 20
+	// 一次导出的媒体文件总大小上限，超过时拒绝导出
+	maxExportSize = 100 << 20
+)
+
+// ErrNotFound 聊天记录不存在
+var ErrNotFound = errors.New("conversation not found")
+
+// ErrTooLarge 导出的媒体文件总大小超过上限
+var ErrTooLarge = errors.New("export too large")
+
+// ParseFormat 解析导出格式，为空时默认为 HTML
+func ParseFormat(value string) (Format, error) {
+	switch Format(strings.ToLower(value)) {
+	case "", FormatHTML:
+		return FormatHTML, nil
+	case FormatMarkdown, "markdown":
+		return FormatMarkdown, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatZip:
+		return FormatZip, nil
+	}
+	return "", fmt.Errorf("unsupported export format: %s", value)
+}
+
+// ContentType 导出文件的 MIME 类型
+func (f Format) ContentType() string {
+	switch f {
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	case FormatJSON:
+		return "application/json; charset=utf-8"
+	case FormatZip:
+		return "application/zip"
+	}
+	return "text/html; charset=utf-8"
+}
+
+// Document 规范化的聊天记录，也是 JSON 导出的结构
+type Document struct {
+	Version    int       `json:"version"`
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	Sender     string    `json:"sender"` // 上传者
+	CreatedAt  time.Time `json:"created_at"`
+	ExportedAt time.Time `json:"exported_at"`
+	Messages   []Message `json:"messages"`
+}
+
+// Message 导出的单条消息
+type Message struct {
+	Time     time.Time `json:"time"`
+	SenderId int       `json:"sender_id"`
+	Nickname string    `json:"nickname"`
+	Card     string    `json:"card,omitempty"`
+	Text     string    `json:"text"` // 去掉CQ码的纯文本
+	Segments []Segment `json:"segments"`
+}
+
+// DisplayName 群名片优先，没有时使用昵称
+func (m Message) DisplayName() string {
+	if m.Card != "" {
+		return m.Card
+	}
+	return m.Nickname
+}
+
+// Segment 导出的消息段，Media 为导出包内的相对路径，只有 HTML 和 zip 导出时包含媒体文件
+type Segment struct {
+	Type      string    `json:"type"`
+	Text      string    `json:"text,omitempty"`
+	FaceId    string    `json:"face_id,omitempty"`
+	ReplyTo   string    `json:"reply_to,omitempty"`
+	AtQQ      string    `json:"at_qq,omitempty"`
+	Result    string    `json:"result,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Summary   string    `json:"summary,omitempty"`
+	Media     string    `json:"media,omitempty"`
+	MimeType  string    `json:"mime,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	Forward   []Message `json:"forward,omitempty"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// asset 导出包中的媒体文件
+// HTML 导出时读取内容以便内嵌，zip 导出时在写入时才打开，避免整个导出包驻留内存
+type asset struct {
+	MimeType string
+	Size     int64
+	Data     []byte
+	open     func() (io.ReadCloser, error)
+}
+
+// MediaSource 导出时读取媒体文件，默认为 db.GetMediaService()
+type MediaSource interface {
+	Find(ctx context.Context, name string) (*db.Media, error)
+	Open(ctx context.Context, name string) (io.ReadCloser, *db.Media, error)
+}
+
+// Export 一次导出任务，保存规范化后的文档和用到的媒体文件
+type Export struct {
+	Document Document
+	format   Format
+	media    MediaSource
+	size     int64             // 已收集的媒体文件总大小
+	tooLarge bool              // 媒体文件总大小超过上限
+	assets   map[string]*asset // 相对路径 -> 文件
+	resolved map[string]string // 媒体名称 -> 相对路径，找不到时为空
+}
+
+// forwardViewDoc forward_views 中导出需要的字段
+type forwardViewDoc struct {
+	ID       primitive.ObjectID          `bson:"_id"`
+	Title    string                      `bson:"title"`
+	Sender   string                      `bson:"sender"`
+	Messages []napcat_go_sdk.MessageView `bson:"messages"`
+}
+
+// Load 读取聊天记录，HTML 和 zip 格式同时准备导出所需的媒体文件
+// 媒体文件总大小超过上限时返回 ErrTooLarge
+func Load(ctx context.Context, id string, format Format) (*Export, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("无效的ID格式")
+	}
+
+	var doc forwardViewDoc
+	collection := db.Collection("message_db", "forward_views")
+	if err := collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return newExport(ctx, &doc, format, db.GetMediaService())
+}
+
+// newExport 转换聊天记录并收集媒体文件
+func newExport(ctx context.Context, doc *forwardViewDoc, format Format, media MediaSource) (*Export, error) {
+	// 与列表一致，创建时间取自 _id
+	createdAt := doc.ID.Timestamp()
+	title := doc.Title
+	if title == "" {
+		title = "聊天 " + createdAt.Local().Format("2006-01-02 15:04")
+	}
+
+	e := &Export{
+		format:   format,
+		media:    media,
+		assets:   make(map[string]*asset),
+		resolved: make(map[string]string),
+	}
+	e.Document = Document{
+		Version:    documentVersion,
+		ID:         doc.ID.Hex(),
+		Title:      title,
+		Sender:     doc.Sender,
+		CreatedAt:  createdAt,
+		ExportedAt: time.Now(),
+		Messages:   e.convertMessages(ctx, doc.Messages),
+	}
+	if e.tooLarge {
+		return nil, ErrTooLarge
+	}
+	return e, nil
+}
+
+// withAssets 该格式是否包含媒体文件，Markdown 和 JSON 单独导出时没有可以引用的文件
+func (e *Export) withAssets() bool {
+	return e.format == FormatHTML || e.format == FormatZip
+}
+
+// convertMessages 转换消息并收集媒体文件
+func (e *Export) convertMessages(ctx context.Context, views []napcat_go_sdk.MessageView) []Message {
+	messages := make([]Message, 0, len(views))
+	for _, view := range views {
+		message := Message{
+			Time:     time.Unix(int64(view.Time), 0),
+			SenderId: view.Sender.UserId,
+			Nickname: view.Sender.Nickname,
+			Card:     view.Sender.Card,
+			Text:     utils.StripCQCode(view.RawMessage),
+		}
+
+		segments := view.Segments
+		if len(segments) == 0 {
+			// 引入结构化消息段之前的记录只有 raw_message
+			segments = legacySegments(view.RawMessage)
+		}
+		for _, s := range segments {
+			segment := Segment{
+				Type:      string(s.Type),
+				Text:      s.Text,
+				FaceId:    s.FaceId,
+				ReplyTo:   s.ReplyTo,
+				AtQQ:      s.AtQQ,
+				Result:    s.Result,
+				Name:      s.Name,
+				Summary:   s.Summary,
+				MimeType:  s.MimeType,
+				Size:      s.Size,
+				Truncated: s.Truncated,
+			}
+			switch s.Type {
+			case napcat_go_sdk.IMAGE, napcat_go_sdk.RECORD, napcat_go_sdk.VIDEO, napcat_go_sdk.FILE:
+				if e.withAssets() {
+					segment.Media = e.resolve(ctx, s.Media, s.File)
+				}
+				if segment.Media != "" {
+					segment.MimeType = e.assets[segment.Media].MimeType
+				}
+				if segment.Name == "" {
+					segment.Name = s.File
+				}
+			case napcat_go_sdk.FORWARD:
+				segment.Forward = e.convertMessages(ctx, s.Forward)
+			}
+			message.Segments = append(message.Segments, segment)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// legacySegments 从 raw_message 的CQ码还原消息段
+func legacySegments(raw string) []napcat_go_sdk.Segment {
+	var segments []napcat_go_sdk.Segment
+	for _, cq := range utils.ParseCQCode(raw) {
+		segment := napcat_go_sdk.Segment{Type: napcat_go_sdk.MsgType(cq.Type)}
+		switch segment.Type {
+		case napcat_go_sdk.TEXT:
+			segment.Text = cq.Data["text"]
+		case napcat_go_sdk.FACE, napcat_go_sdk.MFACE:
+			segment.FaceId = cq.Data["id"]
+			segment.Summary = cq.Data["summary"]
+		case napcat_go_sdk.REPLY:
+			segment.ReplyTo = cq.Data["id"]
+		case napcat_go_sdk.AT:
+			segment.AtQQ = cq.Data["qq"]
+			segment.Text = cq.Data["name"]
+		case napcat_go_sdk.IMAGE, napcat_go_sdk.RECORD, napcat_go_sdk.VIDEO, napcat_go_sdk.FILE:
+			segment.File = cq.Data["file"]
+		case napcat_go_sdk.FORWARD:
+			segment.ForwardId = cq.Data["id"]
+			segment.Truncated = true
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// resolve 按存储key、QQ文件名的顺序查找媒体文件，返回导出包内的相对路径
+// 媒体存储中找不到时回退到 ./pics 目录下的历史文件
+func (e *Export) resolve(ctx context.Context, names ...string) string {
+	for _, name := range names {
+		if name == "" || e.tooLarge {
+			continue
+		}
+		if path, ok := e.resolved[name]; ok {
+			if path != "" {
+				return path
+			}
+			continue
+		}
+
+		path := e.load(ctx, name)
+		e.resolved[name] = path
+		if path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// load 查找单个媒体文件并加入导出包，失败时返回空路径
+func (e *Export) load(ctx context.Context, name string) string {
+	if media, err := e.media.Find(ctx, name); err == nil {
+		return e.add("media/"+media.Key, media.MimeType, media.Size, func() (io.ReadCloser, error) {
+			reader, _, err := e.media.Open(ctx, media.Key)
+			return reader, err
+		})
+	}
+
+	file := filepath.Join(".", "pics", filepath.Base(name))
+	info, err := os.Stat(file)
+	if err != nil || info.IsDir() {
+		return ""
+	}
+	return e.add("media/"+filepath.Base(name), mime.TypeByExtension(filepath.Ext(file)), info.Size(), func() (io.ReadCloser, error) {
+		return os.Open(file)
+	})
+}
+
+// add 记录媒体文件，HTML 导出时读取内容；超过单个文件或总大小上限时返回空路径
+func (e *Export) add(path, mimeType string, size int64, open func() (io.ReadCloser, error)) string {
+	if size > maxAssetSize || (e.format == FormatHTML && size > maxEmbedSize) {
+		return ""
+	}
+	if e.size+size > maxExportSize {
+		e.tooLarge = true
+		return ""
+	}
+
+	a := &asset{MimeType: mimeType, Size: size, open: open}
+	if e.format == FormatHTML {
+		reader, err := open()
+		if err != nil {
+			fmt.Printf("读取媒体文件失败 %s: %v\n", path, err)
+			return ""
+		}
+		defer reader.Close()
+		a.Data, err = io.ReadAll(io.LimitReader(reader, maxEmbedSize+1))
+		if err != nil {
+			fmt.Printf("读取媒体文件失败 %s: %v\n", path, err)
+			return ""
+		}
+		if len(a.Data) > maxEmbedSize {
+			return ""
+		}
+		a.Size = int64(len(a.Data))
+	}
+	if a.MimeType == "" {
+		a.MimeType = "application/octet-stream"
+		if a.Data != nil {
+			a.MimeType = http.DetectContentType(a.Data)
+		}
+	}
+
+	e.size += a.Size
+	e.assets[path] = a
+	return path
+}
+
+// Filename 导出文件名，使用标题并去掉文件系统不允许的字符
+func (e *Export) Filename(format Format) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`\/:*?"<>|`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(e.Document.Title))
+	if name == "" {
+		name = e.Document.ID
+	}
+	return name + "." + string(format)
+}
+
+// Write 按指定格式写出
+func (e *Export) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatHTML:
+		return e.WriteHTML(w, true)
+	case FormatMarkdown:
+		return e.WriteMarkdown(w)
+	case FormatJSON:
+		return e.WriteJSON(w)
+	case FormatZip:
+		return e.WriteZip(w)
+	}
+	return fmt.Errorf("unsupported export format: %s", format)
+}
@@ -0,0 +1,237 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"memento_backend/db"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"snail.local/snailllllll/napcat_go_sdk"
+	"snail.local/snailllllll/utils"
+)
+
+// fakeMedia 按文件名和存储key查找的内存媒体存储，记录打开次数
+type fakeMedia struct {
+	files map[string]*db.Media
+	data  map[string][]byte
+	opens int
+}
+
+func newFakeMedia() *fakeMedia {
+	return &fakeMedia{files: map[string]*db.Media{}, data: map[string][]byte{}}
+}
+
+func (f *fakeMedia) add(filename, key, mimeType string, data []byte) {
+	media := &db.Media{Key: key, MimeType: mimeType, Size: int64(len(data))}
+	f.files[filename] = media
+	f.files[key] = media
+	f.data[key] = data
+}
+
+func (f *fakeMedia) Find(ctx context.Context, name string) (*db.Media, error) {
+	if media, ok := f.files[name]; ok {
+		return media, nil
+	}
+	return nil, utils.ErrMediaNotFound
+}
+
+func (f *fakeMedia) Open(ctx context.Context, name string) (io.ReadCloser, *db.Media, error) {
+	media, err := f.Find(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	f.opens++
+	return io.NopCloser(bytes.NewReader(f.data[media.Key])), media, nil
+}
+
+// testDoc 包含文本、图片、找不到的文件和嵌套转发的聊天记录
+func testDoc() *forwardViewDoc {
+	message := func(name, raw string, segments ...napcat_go_sdk.Segment) napcat_go_sdk.MessageView {
+		view := napcat_go_sdk.MessageView{Time: 1700000000, RawMessage: raw, Segments: segments}
+		view.Sender.UserId = 10001
+		view.Sender.Nickname = name
+		return view
+	}
+	return &forwardViewDoc{
+		ID:     primitive.NewObjectID(),
+		Title:  "周末*计划",
+		Sender: "alice",
+		Messages: []napcat_go_sdk.MessageView{
+			message("Alice", "去爬山吗",
+				napcat_go_sdk.Segment{Type: napcat_go_sdk.TEXT, Text: "去爬山吗"},
+				napcat_go_sdk.Segment{Type: napcat_go_sdk.IMAGE, File: "abc.jpg"},
+			),
+			message("Bob", "[CQ:file,file=missing.zip]",
+				napcat_go_sdk.Segment{Type: napcat_go_sdk.FILE, File: "missing.zip"},
+			),
+			message("Carol", "[CQ:forward,id=1]",
+				napcat_go_sdk.Segment{Type: napcat_go_sdk.FORWARD, Forward: []napcat_go_sdk.MessageView{
+					message("Dave", "好", napcat_go_sdk.Segment{Type: napcat_go_sdk.TEXT, Text: "好"}),
+				}},
+			),
+			// 没有消息段的历史记录从CQ码还原
+			message("Eve", "[CQ:at,qq=10002,name=Bob] 收到"),
+		},
+	}
+}
+
+func newTestExport(t *testing.T, format Format) (*Export, *fakeMedia) {
+	t.Helper()
+	media := newFakeMedia()
+	media.add("abc.jpg", "ab/abcdef.jpg", "image/jpeg", []byte("jpeg-data"))
+	e, err := newExport(context.Background(), testDoc(), format, media)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, media
+}
+
+func render(t *testing.T, e *Export, format Format) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := e.Write(&buf, format); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestMarkdown(t *testing.T) {
+	e, media := newTestExport(t, FormatMarkdown)
+	if media.opens != 0 || len(e.assets) != 0 {
+		t.Errorf("Markdown export read %d media files", media.opens)
+	}
+
+	out := render(t, e, FormatMarkdown)
+	for _, want := range []string{
+		`# 周末\*计划`,
+		"上传者 alice · 4 条消息",
+		"**Alice**",
+		"去爬山吗[图片]",
+		"[文件 missing.zip]",
+		"> 合并转发 · 1 条消息",
+		"> **Dave**",
+		"@Bob  收到",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Markdown missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	e, media := newTestExport(t, FormatJSON)
+	if media.opens != 0 {
+		t.Errorf("JSON export read %d media files", media.opens)
+	}
+
+	var doc Document
+	if err := json.Unmarshal([]byte(render(t, e, FormatJSON)), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != documentVersion || doc.Title != "周末*计划" || len(doc.Messages) != 4 {
+		t.Fatalf("JSON document = %+v", doc)
+	}
+	if image := doc.Messages[0].Segments[1]; image.Type != "image" || image.Media != "" || image.Name != "abc.jpg" {
+		t.Errorf("image segment = %+v", image)
+	}
+	if forward := doc.Messages[2].Segments[0].Forward; len(forward) != 1 || forward[0].Text != "好" {
+		t.Errorf("forward = %+v", forward)
+	}
+	if at := doc.Messages[3].Segments[0]; at.Type != "at" || at.AtQQ != "10002" {
+		t.Errorf("legacy at segment = %+v", at)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	e, _ := newTestExport(t, FormatHTML)
+	out := render(t, e, FormatHTML)
+	for _, want := range []string{
+		"<title>周末*计划</title>",
+		`<img src="data:image/jpeg;base64,anBlZy1kYXRh" alt="abc.jpg">`,
+		`<span class="missing">[文件 missing.zip]</span>`,
+		"合并转发 · 1 条消息",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("HTML missing %q", want)
+		}
+	}
+}
+
+func TestZip(t *testing.T) {
+	e, media := newTestExport(t, FormatZip)
+	// 媒体文件在写入时才读取
+	if media.opens != 0 {
+		t.Errorf("zip export read %d media files before writing", media.opens)
+	}
+
+	out := render(t, e, FormatZip)
+	archive, err := zip.NewReader(strings.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		files[file.Name] = string(data)
+	}
+
+	if files["media/ab/abcdef.jpg"] != "jpeg-data" {
+		t.Errorf("zip media = %q", files["media/ab/abcdef.jpg"])
+	}
+	// zip 中的页面和文档引用包内的相对路径
+	if !strings.Contains(files["index.html"], `<img src="media/ab/abcdef.jpg"`) {
+		t.Error("index.html does not reference the bundled media")
+	}
+	if !strings.Contains(files["conversation.md"], "![abc.jpg](media/ab/abcdef.jpg)") {
+		t.Error("conversation.md does not reference the bundled media")
+	}
+	if !strings.Contains(files["conversation.json"], `"media": "media/ab/abcdef.jpg"`) {
+		t.Error("conversation.json does not reference the bundled media")
+	}
+}
+
+func TestExportTooLarge(t *testing.T) {
+	media := newFakeMedia()
+	doc := testDoc()
+	doc.Messages = nil
+	// 每个文件都不超过单个文件的上限，总大小超过导出上限
+	for _, key := range []string{"a", "b", "c"} {
+		media.add(key+".mp4", key, "video/mp4", nil)
+		media.files[key].Size = maxAssetSize
+		doc.Messages = append(doc.Messages, napcat_go_sdk.MessageView{
+			Segments: []napcat_go_sdk.Segment{{Type: napcat_go_sdk.VIDEO, File: key + ".mp4"}},
+		})
+	}
+
+	if _, err := newExport(context.Background(), doc, FormatZip, media); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("newExport() error = %v, want ErrTooLarge", err)
+	}
+	// 不包含媒体文件的格式不受限制
+	if _, err := newExport(context.Background(), doc, FormatJSON, media); err != nil {
+		t.Errorf("newExport() JSON error = %v", err)
+	}
+}
+
+func TestFilename(t *testing.T) {
+	e, _ := newTestExport(t, FormatJSON)
+	e.Document.Title = `a/b:c?`
+	if got := e.Filename(FormatZip); got != "a_b_c_.zip" {
+		t.Errorf("Filename() = %q", got)
+	}
+	e.Document.Title = " "
+	if got := e.Filename(FormatHTML); got != e.Document.ID+".html" {
+		t.Errorf("Filename() = %q", got)
+	}
+}
@@ -0,0 +1,113 @@
+package export
+
+import (
+	"encoding/base64"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// pageTemplate 独立的聊天记录页面，样式全部内联，不依赖外部资源
+var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"initial": func(name string) string {
+		for _, r := range name {
+			return strings.ToUpper(string(r))
+		}
+		return "?"
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Doc.Title}}</title>
+<style>
+body { margin: 0; background: #f2f3f5; font: 15px/1.6 -apple-system, "PingFang SC", "Microsoft YaHei", sans-serif; color: #222; }
+.page { max-width: 760px; margin: 0 auto; padding: 24px 16px; }
+header h1 { margin: 0 0 4px; font-size: 22px; }
+header p { margin: 0 0 24px; color: #888; font-size: 13px; }
+.msg { display: flex; gap: 10px; margin: 14px 0; }
+.avatar { flex: none; width: 36px; height: 36px; border-radius: 50%; background: #5b8def; color: #fff; display: flex; align-items: center; justify-content: center; font-weight: bold; }
+.body { min-width: 0; max-width: 85%; }
+.meta { font-size: 12px; color: #888; margin-bottom: 2px; }
+.bubble { display: inline-block; background: #fff; border-radius: 4px 12px 12px 12px; padding: 8px 12px; white-space: pre-wrap; word-break: break-word; box-shadow: 0 1px 2px rgba(0,0,0,.06); }
+.bubble img, .bubble video { display: block; max-width: 100%; max-height: 360px; border-radius: 6px; margin: 4px 0; }
+.bubble audio { display: block; margin: 4px 0; }
+.tag { color: #5b8def; }
+.reply { display: block; font-size: 12px; color: #888; border-left: 3px solid #ccc; padding-left: 6px; margin-bottom: 4px; }
+.missing { color: #aaa; font-style: italic; }
+.forward { border: 1px solid #e3e5e8; border-radius: 8px; padding: 4px 10px; margin: 4px 0; background: #fafafa; }
+.forward summary { cursor: pointer; color: #666; font-size: 13px; }
+</style>
+</head>
+<body>
+<div class="page">
+<header>
+<h1>{{.Doc.Title}}</h1>
+<p>{{with .Doc.Sender}}上传者 {{.}} · {{end}}{{len .Doc.Messages}} 条消息 · 归档于 {{.Doc.CreatedAt.Local.Format "2006-01-02 15:04"}}</p>
+</header>
+{{template "messages" .Messages}}
+</div>
+</body>
+</html>
+{{define "messages"}}{{range .}}<div class="msg">
+<div class="avatar">{{initial .DisplayName}}</div>
+<div class="body">
+<div class="meta">{{.DisplayName}} · {{.Time.Local.Format "2006-01-02 15:04:05"}}</div>
+<div class="bubble">{{range .Segments}}{{template "segment" .}}{{end}}</div>
+</div>
+</div>
+{{end}}{{end}}
+{{define "segment"}}{{if eq .Type "text"}}{{.Text}}{{else if eq .Type "image"}}{{if .Src}}<img src="{{.Src}}" alt="{{.Name}}">{{else}}<span class="missing">[图片]</span>{{end}}{{else if eq .Type "record"}}{{if .Src}}<audio controls src="{{.Src}}"></audio>{{else}}<span class="missing">[语音]</span>{{end}}{{else if eq .Type "video"}}{{if .Src}}<video controls src="{{.Src}}"></video>{{else}}<span class="missing">[视频 {{.Name}}]</span>{{end}}{{else if eq .Type "file"}}{{if .Src}}<a href="{{.Src}}" download="{{.Name}}">📎 {{.Name}}</a>{{else}}<span class="missing">[文件 {{.Name}}]</span>{{end}}{{else if eq .Type "at"}}<span class="tag">@{{if .Text}}{{.Text}}{{else}}{{.AtQQ}}{{end}}</span> {{else if eq .Type "reply"}}<span class="reply">回复消息 {{.ReplyTo}}</span>{{else if eq .Type "face"}}[表情{{.FaceId}}]{{else if eq .Type "mface"}}{{if .Summary}}{{.Summary}}{{else}}[表情]{{end}}{{else if eq .Type "dice"}}[骰子 {{.Result}}]{{else if eq .Type "rps"}}[猜拳 {{.Result}}]{{else if eq .Type "forward"}}{{if .Forward}}<details class="forward" open><summary>合并转发 · {{len .Forward}} 条消息</summary>{{template "messages" .Forward}}</details>{{else}}<span class="missing">[合并转发]</span>{{end}}{{else}}<span class="missing">[{{.Type}}]</span>{{end}}{{end}}`))
+
+// htmlMessage 渲染时使用的消息，媒体地址已根据导出方式确定
+type htmlMessage struct {
+	Message
+	Segments []htmlSegment
+}
+
+type htmlSegment struct {
+	Segment
+	Src     template.URL
+	Forward []htmlMessage
+}
+
+// WriteHTML 写出HTML页面
+// embed 为 true 时媒体以 data URI 内嵌，生成可以单独打开的页面；否则引用 zip 包中的相对路径
+func (e *Export) WriteHTML(w io.Writer, embed bool) error {
+	return pageTemplate.Execute(w, map[string]interface{}{
+		"Doc":      e.Document,
+		"Messages": e.htmlMessages(e.Document.Messages, embed),
+	})
+}
+
+func (e *Export) htmlMessages(messages []Message, embed bool) []htmlMessage {
+	result := make([]htmlMessage, 0, len(messages))
+	for _, message := range messages {
+		m := htmlMessage{Message: message}
+		for _, segment := range message.Segments {
+			s := htmlSegment{Segment: segment}
+			if segment.Media != "" {
+				s.Src = e.mediaURL(segment.Media, embed)
+			}
+			if len(segment.Forward) > 0 {
+				s.Forward = e.htmlMessages(segment.Forward, embed)
+			}
+			m.Segments = append(m.Segments, s)
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+// mediaURL 返回媒体文件在页面中的地址
+func (e *Export) mediaURL(path string, embed bool) template.URL {
+	if !embed {
+		return template.URL(path)
+	}
+	a := e.assets[path]
+	if a == nil || len(a.Data) > maxEmbedSize {
+		return ""
+	}
+	return template.URL("data:" + a.MimeType + ";base64," + base64.StdEncoding.EncodeToString(a.Data))
+}
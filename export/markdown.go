@@ -0,0 +1,100 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteMarkdown 写出Markdown，媒体引用 zip 包中的相对路径
+func (e *Export) WriteMarkdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s\n\n", markdownEscape(e.Document.Title))
+	if e.Document.Sender != "" {
+		fmt.Fprintf(bw, "上传者 %s · ", markdownEscape(e.Document.Sender))
+	}
+	fmt.Fprintf(bw, "%d 条消息 · 归档于 %s\n\n", len(e.Document.Messages), e.Document.CreatedAt.Local().Format("2006-01-02 15:04"))
+	writeMarkdownMessages(bw, e.Document.Messages, "")
+	return bw.Flush()
+}
+
+// writeMarkdownMessages 写出消息，嵌套的合并转发使用引用块
+func writeMarkdownMessages(w *bufio.Writer, messages []Message, prefix string) {
+	for _, message := range messages {
+		fmt.Fprintf(w, "%s**%s** · %s\n%s\n", prefix, markdownEscape(message.DisplayName()), message.Time.Local().Format("2006-01-02 15:04:05"), prefix)
+
+		var line strings.Builder
+		flush := func() {
+			for _, text := range strings.Split(line.String(), "\n") {
+				fmt.Fprintf(w, "%s%s  \n", prefix, text)
+			}
+			line.Reset()
+		}
+		for _, segment := range message.Segments {
+			switch segment.Type {
+			case "text":
+				line.WriteString(markdownEscape(segment.Text))
+			case "image":
+				if segment.Media != "" {
+					fmt.Fprintf(&line, "![%s](%s)", markdownEscape(segment.Name), segment.Media)
+				} else {
+					line.WriteString("[图片]")
+				}
+			case "record", "video", "file":
+				label := map[string]string{"record": "语音", "video": "视频", "file": "文件"}[segment.Type]
+				if segment.Name != "" && segment.Type != "record" {
+					label += " " + segment.Name
+				}
+				if segment.Media != "" {
+					fmt.Fprintf(&line, "[%s](%s)", markdownEscape(label), segment.Media)
+				} else {
+					fmt.Fprintf(&line, "[%s]", markdownEscape(label))
+				}
+			case "at":
+				name := segment.Text
+				if name == "" {
+					name = segment.AtQQ
+				}
+				fmt.Fprintf(&line, "@%s ", markdownEscape(name))
+			case "reply":
+				fmt.Fprintf(&line, "↪ 回复消息 %s\n", segment.ReplyTo)
+			case "face":
+				fmt.Fprintf(&line, "[表情%s]", segment.FaceId)
+			case "mface":
+				if segment.Summary != "" {
+					line.WriteString(markdownEscape(segment.Summary))
+				} else {
+					line.WriteString("[表情]")
+				}
+			case "dice":
+				fmt.Fprintf(&line, "[骰子 %s]", segment.Result)
+			case "rps":
+				fmt.Fprintf(&line, "[猜拳 %s]", segment.Result)
+			case "forward":
+				if len(segment.Forward) == 0 {
+					line.WriteString("[合并转发]")
+					continue
+				}
+				flush()
+				fmt.Fprintf(w, "%s\n%s> 合并转发 · %d 条消息\n%s>\n", prefix, prefix, len(segment.Forward), prefix)
+				writeMarkdownMessages(w, segment.Forward, prefix+"> ")
+			default:
+				fmt.Fprintf(&line, "[%s]", segment.Type)
+			}
+		}
+		if line.Len() > 0 {
+			flush()
+		}
+		fmt.Fprintf(w, "%s\n", prefix)
+	}
+}
+
+// markdownEscaper 转义会被解释为Markdown语法的字符
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "#", `\#`, "<", "&lt;", ">", "&gt;",
+)
+
+func markdownEscape(text string) string {
+	return markdownEscaper.Replace(text)
+}
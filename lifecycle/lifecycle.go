@@ -0,0 +1,84 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShutdownFunc 关闭组件，ctx 到期后应尽快返回
+type ShutdownFunc func(ctx context.Context) error
+
+// hook 注册的关闭函数
+type hook struct {
+	name string
+	fn   ShutdownFunc
+}
+
+// App 应用生命周期：记录启动完成的组件，关闭时按启动的相反顺序依次关闭
+type App struct {
+	mu           sync.Mutex
+	hooks        []hook
+	ready        atomic.Bool
+	shuttingDown atomic.Bool
+}
+
+// New 创建应用生命周期
+func New() *App {
+	return &App{}
+}
+
+// OnShutdown 注册组件的关闭函数，应在组件启动成功后立即调用
+func (a *App) OnShutdown(name string, fn ShutdownFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.hooks = append(a.hooks, hook{name: name, fn: fn})
+}
+
+// SetReady 标记启动完成，可以接收请求
+func (a *App) SetReady() {
+	if !a.shuttingDown.Load() {
+		a.ready.Store(true)
+		fmt.Println("服务已就绪")
+	}
+}
+
+// Ready 启动已完成且没有开始关闭
+func (a *App) Ready() bool {
+	return a.ready.Load() && !a.shuttingDown.Load()
+}
+
+// ShuttingDown 是否已开始关闭
+func (a *App) ShuttingDown() bool {
+	return a.shuttingDown.Load()
+}
+
+// Shutdown 按注册的相反顺序关闭所有组件，单个组件失败不影响其他组件
+// 所有组件共用 ctx 的截止时间
+func (a *App) Shutdown(ctx context.Context) error {
+	if a.shuttingDown.Swap(true) {
+		return nil
+	}
+	a.ready.Store(false)
+
+	a.mu.Lock()
+	hooks := a.hooks
+	a.hooks = nil
+	a.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		start := time.Now()
+		if err := h.fn(ctx); err != nil {
+			fmt.Printf("关闭 %s 失败: %v\n", h.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		fmt.Printf("已关闭 %s，耗时 %v\n", h.name, time.Since(start).Round(time.Millisecond))
+	}
+	return errors.Join(errs...)
+}
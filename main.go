@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"sync"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"memento_backend/db"
+	"memento_backend/lifecycle"
 
 	"snail.local/snailllllll/verification"
 
@@ -16,69 +22,243 @@ import (
 	"snail.local/snailllllll/utils"
 )
 
-var (
-	wsClientInstance *napcat_go_sdk.WebSocketClient
-	once             sync.Once
-	Admin_uin        string
-)
-
 func main() {
-	// 初始化配置
-	utils.LoadConfig()
-
-	// 创建路由引擎
-	router := gin.Default()
+	configFile := flag.String("config", "", "配置文件路径（YAML 或 TOML）")
+	profile := flag.String("profile", "", "运行环境：dev 或 prod")
+	printConfig := flag.Bool("print-config", false, "输出合并后的配置（隐藏敏感项）并退出")
+	flag.Parse()
 
-	// 初始化 WebSocket 客户端
-	wsClientInstance, err := napcat_go_sdk.GetWebSocketClient(utils.Config.Addr, 3001, &utils.Config.Token)
-	if err != nil {
-		fmt.Println("Failed to initialize WebSocket client:", err)
+	// 初始化配置
+	if err := utils.LoadConfigWithOptions(utils.ConfigOptions{File: *configFile, Profile: *profile}); err != nil {
+		fmt.Fprintf(os.Stderr, "配置错误:\n%v\n", err)
+		os.Exit(1)
+	}
+	if *printConfig {
+		if err := utils.PrintConfig(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		return
 	}
 
-	// 发送bot 登录成功提示
-	text := utils.GetConfig("TEXT", "")
-	napcat_go_sdk.SingleTextMessage(&text, &utils.Config.AdminUIN, wsClientInstance)
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run 按 MongoDB → NapCat → 后台任务 → HTTP 的顺序启动，收到 SIGINT/SIGTERM 后按相反顺序关闭
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	app := lifecycle.New()
+	shutdown := func() error {
+		timeout := time.Duration(utils.Config.Server.ShutdownTimeout) * time.Second
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return app.Shutdown(shutdownCtx)
+	}
 
 	// 连接 mongoDB
-	err = db.Init(utils.Config.DBURI)
+	if err := db.Init(utils.Config.Database.URI); err != nil {
+		return err
+	}
+	app.OnShutdown("MongoDB", db.Close)
+
+	userService := db.NewUserService()
+	verificationService := verification.NewVerificationCodeService()
+	if err := initDatabase(ctx, userService, verificationService); err != nil {
+		_ = shutdown()
+		return err
+	}
+
+	// 按配置的方式连接 NapCat 的所有账号，正向WebSocket连接失败时在后台持续重连
+	napcatConfig := utils.Config.NapCat
+	napcatClient, err := napcat_go_sdk.Connect(napcat_go_sdk.ConnectOptions{
+		Mode:             napcatConfig.Mode,
+		Addr:             napcatConfig.Addr,
+		Port:             uint(napcatConfig.Port),
+		Token:            napcatConfig.Token,
+		NotifyBots:       napcatConfig.NotifyBotList(),
+		FailoverCooldown: time.Duration(napcatConfig.FailoverCooldown) * time.Second,
+	})
 	if err != nil {
-		db_connect_success := "MongoDB连接失败"
-		napcat_go_sdk.SingleTextMessage(&db_connect_success, &utils.Config.AdminUIN, wsClientInstance)
-		return
+		fmt.Printf("连接NapCat失败，将在后台重连: %v\n", err)
+	}
+	app.OnShutdown("NapCat", func(ctx context.Context) error {
+		// 反向WebSocket的账号同时注册在两处，重复关闭没有影响
+		return errors.Join(napcatClient.Close(), napcat_go_sdk.GetEventServer().Close())
+	})
+
+	// 发送bot 登录成功提示，反向WebSocket此时还未连接
+	if napcatClient.IsConnected() {
+		text := napcatConfig.Text
+		napcat_go_sdk.SingleTextMessage(&text, &napcatConfig.AdminUIN, napcatClient)
+	}
+
+	// 启动后台任务队列，关闭时等待执行中的标题生成结束
+	jobQueue := db.GetJobQueue()
+	napcat_go_sdk.RegisterTitleJobs(jobQueue)
+	jobQueue.Start(4)
+	app.OnShutdown("任务队列", jobQueue.Stop)
+
+	// 每小时清理过期token
+	db.NewTokenService().StartCleanup(ctx, time.Hour)
+
+	// 每小时同步群成员，决定群成员可见的记录对哪些用户可见
+	napcat_go_sdk.StartGroupMemberSync(ctx, time.Hour)
+
+	// 为历史数据补建检索索引
+	go func() {
+		count, err := db.NewSearchService().BackfillSearchText(ctx)
+		if err != nil {
+			fmt.Printf("补建检索索引失败: %v\n", err)
+			return
+		}
+		fmt.Printf("已为 %d 条聊天记录补建检索索引\n", count)
+	}()
+
+	// 处理历史数据
+	napcat_go_sdk.ProcessEmptyTitleForwardViews() //处理没有title的forward_view,处理历史数据用
+
+	// 创建路由引擎并设置所有路由
+	router := gin.Default()
+	// 只信任配置的反向代理转发的客户端IP，否则 X-Forwarded-For 可以绕过按IP的限流
+	if err := router.SetTrustedProxies(utils.Config.Server.TrustedProxyList()); err != nil {
+		return fmt.Errorf("server.trusted_proxies 配置错误: %v", err)
+	}
+	routes.SetupRoutes(router, userService, verificationService, napcatClient)
+	routes.SetupHealthRoutes(router, app, napcatClient)
+	routes.SetupOneBotRoutes(router, napcat_go_sdk.GetEventServer())
+
+	// 启动服务
+	server := &http.Server{
+		Addr:    ":" + utils.Config.Server.Port,
+		Handler: router,
 	}
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("HTTP服务监听 %s\n", server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+	app.OnShutdown("HTTP服务", server.Shutdown)
+	app.SetReady()
+
+	select {
+	case <-ctx.Done():
+		fmt.Println("收到退出信号，开始关闭")
+	case err := <-serverErr:
+		_ = shutdown()
+		return fmt.Errorf("HTTP服务异常退出: %w", err)
+	}
+
+	// 恢复默认信号处理，关闭过程中再次收到信号时立即退出
+	stop()
+	return shutdown()
+}
+
+// initDatabase 迁移历史数据并创建索引，索引创建失败只打印日志
+// 启动过程中收到退出信号时返回错误
+func initDatabase(ctx context.Context, userService *db.UserService, verificationService *verification.VerificationCodeService) error {
+	indexCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
 
 	// 初始化用户服务并创建索引
-	userService := db.NewUserService()
-	ctx := context.Background()
-	if err := userService.CreateIndexes(ctx); err != nil {
+	if err := userService.CreateIndexes(indexCtx); err != nil {
 		fmt.Printf("创建用户索引失败: %v\n", err)
 	}
 
-	// 创建token服务并初始化索引
+	// 没有管理员时将 ADMIN_UIN 对应的用户设为管理员
+	if err := userService.EnsureAdmin(indexCtx, utils.Config.NapCat.AdminUIN); err != nil {
+		fmt.Printf("初始化管理员失败: %v\n", err)
+	}
+
+	// 历史token改为只保存HMAC，需要在创建索引之前完成
 	tokenService := db.NewTokenService()
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	if count, err := tokenService.MigratePlaintextTokens(indexCtx); err != nil {
+		fmt.Printf("迁移明文token失败: %v\n", err)
+	} else if count > 0 {
+		fmt.Printf("已迁移%d个明文token\n", count)
+	}
 
-	if err := tokenService.CreateIndexes(ctx); err != nil {
+	if err := tokenService.CreateIndexes(indexCtx); err != nil {
 		fmt.Printf("创建token索引失败: %v\n", err)
 	}
 
-	// 初始化验证码服务并创建索引
-	verificationService := verification.NewVerificationCodeService()
-	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// 删除明文保存的历史验证码
+	if count, err := verificationService.DeletePlaintextCodes(indexCtx); err != nil {
+		fmt.Printf("删除明文验证码失败: %v\n", err)
+	} else if count > 0 {
+		fmt.Printf("已删除%d个明文验证码\n", count)
+	}
 
-	if err := verificationService.CreateIndexes(ctx); err != nil {
+	// 创建验证码索引
+	if err := verificationService.CreateIndexes(indexCtx); err != nil {
 		fmt.Printf("创建验证码索引失败: %v\n", err)
 	}
 
-	// 设置所有路由
-	routes.SetupRoutes(router, userService, verificationService, wsClientInstance)
+	// 可见范围 group 更名为 members
+	forwardViewService := db.NewForwardViewService()
+	if count, err := forwardViewService.MigrateVisibility(indexCtx); err != nil {
+		fmt.Printf("迁移聊天记录可见范围失败: %v\n", err)
+	} else if count > 0 {
+		fmt.Printf("已迁移%d条聊天记录的可见范围\n", count)
+	}
 
-	// 处理历史数据
-	napcat_go_sdk.ProcessEmptyTitleForwardViews() //处理没有title的forward_view,处理历史数据用
+	// 创建聊天记录列表索引
+	if err := forwardViewService.CreateIndexes(indexCtx); err != nil {
+		fmt.Printf("创建聊天记录索引失败: %v\n", err)
+	}
 
-	// 启动服务
-	router.Run()
+	// 分享令牌改为只保存HMAC，需要在创建索引之前完成
+	shareLinkService := db.NewShareLinkService()
+	if count, err := shareLinkService.MigratePlaintextTokens(indexCtx); err != nil {
+		fmt.Printf("迁移明文分享令牌失败: %v\n", err)
+	} else if count > 0 {
+		fmt.Printf("已迁移%d个明文分享令牌\n", count)
+	}
+
+	// 创建群成员索引
+	if err := db.NewGroupMemberService().CreateIndexes(indexCtx); err != nil {
+		fmt.Printf("创建群成员索引失败: %v\n", err)
+	}
+
+	// 创建分享链接索引
+	if err := shareLinkService.CreateIndexes(indexCtx); err != nil {
+		fmt.Printf("创建分享链接索引失败: %v\n", err)
+	}
+
+	// 多个实例共享的锁，替换默认的进程内存锁
+	locker := db.NewMongoLocker()
+	if err := locker.CreateIndexes(indexCtx); err != nil {
+		fmt.Printf("创建锁索引失败: %v\n", err)
+	}
+	utils.SetLocker(locker)
+
+	// 多个实例部署时使用共享的限流存储
+	if utils.Config.RateLimit.Store == "mongo" {
+		rateLimitStore := db.NewMongoRateLimitStore()
+		if err := rateLimitStore.CreateIndexes(indexCtx); err != nil {
+			fmt.Printf("创建限流索引失败: %v\n", err)
+		}
+		utils.SetRateLimitStore(rateLimitStore)
+	}
+
+	// 创建聊天记录检索索引
+	if err := db.NewSearchService().CreateIndexes(indexCtx); err != nil {
+		fmt.Printf("创建检索索引失败: %v\n", err)
+	}
+
+	// 创建媒体文件索引
+	if err := db.GetMediaService().CreateIndexes(indexCtx); err != nil {
+		fmt.Printf("创建媒体索引失败: %v\n", err)
+	}
+
+	// 创建任务索引
+	if err := db.GetJobQueue().CreateIndexes(indexCtx); err != nil {
+		fmt.Printf("创建任务索引失败: %v\n", err)
+	}
+
+	return ctx.Err()
 }
@@ -48,7 +48,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		defer cancel()
 
 		tokenService := db.NewTokenService()
-		isValid, userToken, err := tokenService.ValidateToken(ctx, token)
+		isValid, userToken, err := tokenService.ValidateToken(ctx, token, c.ClientIP(), c.Request.UserAgent())
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -74,6 +74,18 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// OptionalAuth 可选的鉴权中间件，没有 Authorization 请求头时按匿名请求处理，有则必须有效
+func OptionalAuth() gin.HandlerFunc {
+	auth := AuthMiddleware()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		auth(c)
+	}
+}
+
 // GetUsernameFromContext 从gin.Context获取用户名
 func GetUsernameFromContext(c *gin.Context) (string, error) {
 	if username, exists := c.Get("username"); exists {
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"snail.local/snailllllll/utils"
+)
+
+var httpRequestDuration = utils.NewHistogram("memento_http_request_duration_seconds", "HTTP请求耗时", utils.DefaultBuckets, "method", "route", "status")
+
+// Metrics 记录HTTP请求耗时，route 为路由模板，未匹配的请求记为 unmatched
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.Observe(time.Since(start).Seconds(), c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"snail.local/snailllllll/utils"
+)
+
+// RateLimit 按名称使用配置中的限流策略，未配置该策略时不限流
+// 按用户限流时需要放在 AuthMiddleware 之后
+func RateLimit(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, ok := utils.GetRateLimitPolicy(name)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		defer cancel()
+
+		key := "ratelimit:" + policy.Name + ":" + rateLimitKey(c, policy.Key)
+		allowed, retryAfter, err := utils.GetRateLimitStore().Take(ctx, key, policy.Rate(), policy.Burst)
+		if err != nil {
+			// 限流存储不可用时放行，避免影响正常请求
+			log.Printf("限流检查失败 (%s): %v", policy.Name, err)
+			c.Next()
+			return
+		}
+
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "请求过于频繁，请稍后再试",
+				"retry_after": seconds,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// rateLimitKey 按策略维度计算调用方标识
+func rateLimitKey(c *gin.Context, key utils.RateLimitKey) string {
+	switch key {
+	case utils.RateLimitByUser:
+		if username := c.GetString("username"); username != "" {
+			return "user:" + username
+		}
+		return "ip:" + c.ClientIP()
+	case utils.RateLimitByRoute:
+		return "route:" + c.Request.Method + " " + c.FullPath()
+	default:
+		return "ip:" + c.ClientIP()
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"memento_backend/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission 权限校验中间件，需要放在 AuthMiddleware 之后
+// 校验通过后当前用户保存在上下文的 user 中
+func RequirePermission(permission db.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := CurrentUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "用户不存在",
+			})
+			c.Abort()
+			return
+		}
+
+		if !user.GetRole().Can(permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "权限不足",
+				"permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermissionGroup 需要鉴权并拥有指定权限的接口组
+func RequirePermissionGroup(router *gin.RouterGroup, permission db.Permission) *gin.RouterGroup {
+	group := RequireAuth(router)
+	group.Use(RequirePermission(permission))
+	return group
+}
+
+// CurrentUser 读取token对应的用户及其所在的群，同一请求内只查询一次
+func CurrentUser(c *gin.Context) (*db.User, error) {
+	if user, err := GetUserFromContext(c); err == nil {
+		return user, nil
+	}
+
+	username, err := GetUsernameFromContext(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := db.NewUserService().GetUserByName(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	// 用户所在的群决定能否查看群成员可见的记录
+	if user.Groups, err = db.NewGroupMemberService().Groups(ctx, user.QQ); err != nil {
+		return nil, err
+	}
+	c.Set("user", user)
+	return user, nil
+}
+
+// GetUserFromContext 从gin.Context获取当前用户
+func GetUserFromContext(c *gin.Context) (*db.User, error) {
+	if value, exists := c.Get("user"); exists {
+		if user, ok := value.(*db.User); ok {
+			return user, nil
+		}
+	}
+	return nil, errors.New("无法从context获取用户")
+}
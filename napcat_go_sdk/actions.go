@@ -0,0 +1,380 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// 请求参数
+
+// MessageIdRequest 按消息ID操作的请求：get_msg、delete_msg、set_essence_msg 等
+type MessageIdRequest struct {
+	MessageId int64 `json:"message_id"`
+}
+
+// GroupRequest 按群号操作的请求
+type GroupRequest struct {
+	GroupId int64 `json:"group_id"`
+	NoCache bool  `json:"no_cache,omitempty"`
+}
+
+// UserRequest 按QQ号操作的请求
+type UserRequest struct {
+	UserId  int64 `json:"user_id"`
+	NoCache bool  `json:"no_cache,omitempty"`
+}
+
+// NoCacheRequest 列表类接口的请求
+type NoCacheRequest struct {
+	NoCache bool `json:"no_cache,omitempty"`
+}
+
+// GroupMemberRequest 获取群成员信息的请求
+type GroupMemberRequest struct {
+	GroupId int64 `json:"group_id"`
+	UserId  int64 `json:"user_id"`
+	NoCache bool  `json:"no_cache,omitempty"`
+}
+
+// GroupMsgHistoryRequest 获取群历史消息的请求
+// MessageSeq 为0时从最新消息开始，Count 为0时使用 NapCat 默认值（20）
+type GroupMsgHistoryRequest struct {
+	GroupId      int64 `json:"group_id"`
+	MessageSeq   int64 `json:"message_seq,omitempty"`
+	Count        int   `json:"count,omitempty"`
+	ReverseOrder bool  `json:"reverseOrder,omitempty"`
+}
+
+// FriendMsgHistoryRequest 获取私聊历史消息的请求
+type FriendMsgHistoryRequest struct {
+	UserId       int64 `json:"user_id"`
+	MessageSeq   int64 `json:"message_seq,omitempty"`
+	Count        int   `json:"count,omitempty"`
+	ReverseOrder bool  `json:"reverseOrder,omitempty"`
+}
+
+// GetRecordRequest 获取语音的请求，OutFormat 如 mp3、amr、wav
+type GetRecordRequest struct {
+	File      string `json:"file"`
+	OutFormat string `json:"out_format,omitempty"`
+}
+
+// GetFileRequest 获取文件的请求，FileId 和 File 二选一
+type GetFileRequest struct {
+	FileId string `json:"file_id,omitempty"`
+	File   string `json:"file,omitempty"`
+}
+
+// GetImageRequest 获取图片的请求
+type GetImageRequest struct {
+	File string `json:"file"`
+}
+
+// SetGroupBanRequest 群禁言的请求，Duration 单位秒，0表示解除禁言
+type SetGroupBanRequest struct {
+	GroupId  int64 `json:"group_id"`
+	UserId   int64 `json:"user_id"`
+	Duration int64 `json:"duration"`
+}
+
+// SetGroupWholeBanRequest 全员禁言的请求
+type SetGroupWholeBanRequest struct {
+	GroupId int64 `json:"group_id"`
+	Enable  bool  `json:"enable"`
+}
+
+// SetGroupKickRequest 踢出群成员的请求
+type SetGroupKickRequest struct {
+	GroupId          int64 `json:"group_id"`
+	UserId           int64 `json:"user_id"`
+	RejectAddRequest bool  `json:"reject_add_request"`
+}
+
+// SetGroupCardRequest 设置群名片的请求，Card 为空时取消群名片
+type SetGroupCardRequest struct {
+	GroupId int64  `json:"group_id"`
+	UserId  int64  `json:"user_id"`
+	Card    string `json:"card"`
+}
+
+// SetGroupNameRequest 设置群名的请求
+type SetGroupNameRequest struct {
+	GroupId   int64  `json:"group_id"`
+	GroupName string `json:"group_name"`
+}
+
+// SendLikeRequest 点赞的请求
+type SendLikeRequest struct {
+	UserId int64 `json:"user_id"`
+	Times  int   `json:"times"`
+}
+
+// SendPrivateMsgRequest 发送私聊消息的请求
+type SendPrivateMsgRequest struct {
+	UserId  int64 `json:"user_id"`
+	Message []Msg `json:"message"`
+}
+
+// SendGroupMsgRequest 发送群消息的请求
+type SendGroupMsgRequest struct {
+	GroupId int64 `json:"group_id"`
+	Message []Msg `json:"message"`
+}
+
+// 响应数据
+
+// SendMsgResult 发送消息的响应
+type SendMsgResult struct {
+	MessageId int64 `json:"message_id"`
+}
+
+// MessageHistory 历史消息的响应
+type MessageHistory struct {
+	Messages []ReceiveMessage `json:"messages"`
+}
+
+// FileInfo get_record、get_file、get_image 的响应
+type FileInfo struct {
+	File     string     `json:"file"`
+	Url      string     `json:"url"`
+	FileSize FlexString `json:"file_size"`
+	FileName string     `json:"file_name"`
+	Base64   string     `json:"base64"`
+}
+
+// LoginInfo 登录号信息
+type LoginInfo struct {
+	UserId   int64  `json:"user_id"`
+	Nickname string `json:"nickname"`
+}
+
+// StrangerInfo 陌生人信息
+type StrangerInfo struct {
+	UserId   int64  `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Sex      string `json:"sex"` // male、female、unknown
+	Age      int    `json:"age"`
+}
+
+// FriendInfo 好友信息
+type FriendInfo struct {
+	UserId   int64  `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Remark   string `json:"remark"`
+}
+
+// GroupInfo 群信息
+type GroupInfo struct {
+	GroupId        int64  `json:"group_id"`
+	GroupName      string `json:"group_name"`
+	MemberCount    int    `json:"member_count"`
+	MaxMemberCount int    `json:"max_member_count"`
+}
+
+// GroupMemberInfo 群成员信息
+type GroupMemberInfo struct {
+	GroupId         int64  `json:"group_id"`
+	UserId          int64  `json:"user_id"`
+	Nickname        string `json:"nickname"`
+	Card            string `json:"card"`
+	Sex             string `json:"sex"`
+	Age             int    `json:"age"`
+	Area            string `json:"area"`
+	JoinTime        int64  `json:"join_time"`
+	LastSentTime    int64  `json:"last_sent_time"`
+	Level           string `json:"level"`
+	Role            string `json:"role"` // owner、admin、member
+	Unfriendly      bool   `json:"unfriendly"`
+	Title           string `json:"title"`
+	TitleExpireTime int64  `json:"title_expire_time"`
+	CardChangeable  bool   `json:"card_changeable"`
+	ShutUpTimestamp int64  `json:"shut_up_timestamp"` // 禁言到期时间
+}
+
+// EssenceMsg 精华消息
+type EssenceMsg struct {
+	SenderId     int64           `json:"sender_id"`
+	SenderNick   string          `json:"sender_nick"`
+	SenderTime   int64           `json:"sender_time"`
+	OperatorId   int64           `json:"operator_id"`
+	OperatorNick string          `json:"operator_nick"`
+	OperatorTime int64           `json:"operator_time"`
+	MessageId    int64           `json:"message_id"`
+	Content      json.RawMessage `json:"content"` // 消息段数组
+}
+
+// Status 运行状态
+type Status struct {
+	Online bool `json:"online"`
+	Good   bool `json:"good"`
+}
+
+// VersionInfo 版本信息
+type VersionInfo struct {
+	AppName         string `json:"app_name"`
+	AppVersion      string `json:"app_version"`
+	ProtocolVersion string `json:"protocol_version"`
+}
+
+// 消息
+
+// SendPrivateMsg 发送私聊消息
+func (client *Client) SendPrivateMsg(ctx context.Context, userId int64, message []Msg) (SendMsgResult, error) {
+	return Call[SendPrivateMsgRequest, SendMsgResult](ctx, client, SEND_PRIVATE_MSG, SendPrivateMsgRequest{UserId: userId, Message: message})
+}
+
+// SendGroupMsg 发送群消息
+func (client *Client) SendGroupMsg(ctx context.Context, groupId int64, message []Msg) (SendMsgResult, error) {
+	return Call[SendGroupMsgRequest, SendMsgResult](ctx, client, SEND_GROUP_MSG, SendGroupMsgRequest{GroupId: groupId, Message: message})
+}
+
+// DeleteMsg 撤回消息
+func (client *Client) DeleteMsg(ctx context.Context, messageId int64) error {
+	_, err := Call[MessageIdRequest, json.RawMessage](ctx, client, DELETE_MSG, MessageIdRequest{MessageId: messageId})
+	return err
+}
+
+// GetMsg 获取消息详情
+func (client *Client) GetMsg(ctx context.Context, messageId int64) (ReceiveMessage, error) {
+	return Call[MessageIdRequest, ReceiveMessage](ctx, client, GET_MSG, MessageIdRequest{MessageId: messageId})
+}
+
+// GetForwardMsg 获取合并转发中的消息，id 为合并转发消息段中的 id
+func (client *Client) GetForwardMsg(ctx context.Context, id string) ([]ReceiveMessage, error) {
+	result, err := Call[MessageId, MessageHistory](ctx, client, GET_FORWARD_MESSAGE, MessageId{MessageId: id})
+	return result.Messages, err
+}
+
+// GetGroupMsgHistory 获取群历史消息
+func (client *Client) GetGroupMsgHistory(ctx context.Context, request GroupMsgHistoryRequest) ([]ReceiveMessage, error) {
+	result, err := Call[GroupMsgHistoryRequest, MessageHistory](ctx, client, GET_GROUP_MSG_HISTORY, request)
+	return result.Messages, err
+}
+
+// GetFriendMsgHistory 获取私聊历史消息
+func (client *Client) GetFriendMsgHistory(ctx context.Context, request FriendMsgHistoryRequest) ([]ReceiveMessage, error) {
+	result, err := Call[FriendMsgHistoryRequest, MessageHistory](ctx, client, GET_FRIEND_MSG_HISTORY, request)
+	return result.Messages, err
+}
+
+// 文件
+
+// GetRecord 获取语音，outFormat 为空时返回原始格式
+func (client *Client) GetRecord(ctx context.Context, file, outFormat string) (FileInfo, error) {
+	return Call[GetRecordRequest, FileInfo](ctx, client, GET_RECORD, GetRecordRequest{File: file, OutFormat: outFormat})
+}
+
+// GetFile 获取视频、群文件或私聊文件
+func (client *Client) GetFile(ctx context.Context, request GetFileRequest) (FileInfo, error) {
+	return Call[GetFileRequest, FileInfo](ctx, client, GET_FILE, request)
+}
+
+// GetImage 获取图片
+func (client *Client) GetImage(ctx context.Context, file string) (FileInfo, error) {
+	return Call[GetImageRequest, FileInfo](ctx, client, GET_IMAGE, GetImageRequest{File: file})
+}
+
+// 账号和好友
+
+// GetLoginInfo 获取登录号信息
+func (client *Client) GetLoginInfo(ctx context.Context) (LoginInfo, error) {
+	return Call[struct{}, LoginInfo](ctx, client, GET_LOGIN_INFO, struct{}{})
+}
+
+// GetStrangerInfo 获取陌生人信息
+func (client *Client) GetStrangerInfo(ctx context.Context, userId int64, noCache bool) (StrangerInfo, error) {
+	return Call[UserRequest, StrangerInfo](ctx, client, GET_STRANGER_INFO, UserRequest{UserId: userId, NoCache: noCache})
+}
+
+// GetFriendList 获取好友列表
+func (client *Client) GetFriendList(ctx context.Context, noCache bool) ([]FriendInfo, error) {
+	return Call[NoCacheRequest, []FriendInfo](ctx, client, GET_FRIEND_LIST, NoCacheRequest{NoCache: noCache})
+}
+
+// SendLike 给好友点赞
+func (client *Client) SendLike(ctx context.Context, userId int64, times int) error {
+	_, err := Call[SendLikeRequest, json.RawMessage](ctx, client, SEND_LIKE, SendLikeRequest{UserId: userId, Times: times})
+	return err
+}
+
+// 群
+
+// GetGroupInfo 获取群信息
+func (client *Client) GetGroupInfo(ctx context.Context, groupId int64, noCache bool) (GroupInfo, error) {
+	return Call[GroupRequest, GroupInfo](ctx, client, GET_GROUP_INFO, GroupRequest{GroupId: groupId, NoCache: noCache})
+}
+
+// GetGroupList 获取群列表
+func (client *Client) GetGroupList(ctx context.Context, noCache bool) ([]GroupInfo, error) {
+	return Call[NoCacheRequest, []GroupInfo](ctx, client, GET_GROUP_LIST, NoCacheRequest{NoCache: noCache})
+}
+
+// GetGroupMemberInfo 获取群成员信息
+func (client *Client) GetGroupMemberInfo(ctx context.Context, groupId, userId int64, noCache bool) (GroupMemberInfo, error) {
+	return Call[GroupMemberRequest, GroupMemberInfo](ctx, client, GET_GROUP_MEMBER_INFO, GroupMemberRequest{GroupId: groupId, UserId: userId, NoCache: noCache})
+}
+
+// GetGroupMemberList 获取群成员列表
+func (client *Client) GetGroupMemberList(ctx context.Context, groupId int64, noCache bool) ([]GroupMemberInfo, error) {
+	return Call[GroupRequest, []GroupMemberInfo](ctx, client, GET_GROUP_MEMBER_LIST, GroupRequest{GroupId: groupId, NoCache: noCache})
+}
+
+// SetGroupBan 群禁言，duration 为0时解除禁言，精度为秒
+func (client *Client) SetGroupBan(ctx context.Context, groupId, userId int64, duration time.Duration) error {
+	_, err := Call[SetGroupBanRequest, json.RawMessage](ctx, client, SET_GROUP_BAN, SetGroupBanRequest{GroupId: groupId, UserId: userId, Duration: int64(duration / time.Second)})
+	return err
+}
+
+// SetGroupWholeBan 开启或关闭全员禁言
+func (client *Client) SetGroupWholeBan(ctx context.Context, groupId int64, enable bool) error {
+	_, err := Call[SetGroupWholeBanRequest, json.RawMessage](ctx, client, SET_GROUP_WHOLE_BAN, SetGroupWholeBanRequest{GroupId: groupId, Enable: enable})
+	return err
+}
+
+// SetGroupKick 踢出群成员，rejectAddRequest 为 true 时拒绝此人再次加群
+func (client *Client) SetGroupKick(ctx context.Context, groupId, userId int64, rejectAddRequest bool) error {
+	_, err := Call[SetGroupKickRequest, json.RawMessage](ctx, client, SET_GROUP_KICK, SetGroupKickRequest{GroupId: groupId, UserId: userId, RejectAddRequest: rejectAddRequest})
+	return err
+}
+
+// SetGroupCard 设置群名片
+func (client *Client) SetGroupCard(ctx context.Context, groupId, userId int64, card string) error {
+	_, err := Call[SetGroupCardRequest, json.RawMessage](ctx, client, SET_GROUP_CARD, SetGroupCardRequest{GroupId: groupId, UserId: userId, Card: card})
+	return err
+}
+
+// SetGroupName 设置群名
+func (client *Client) SetGroupName(ctx context.Context, groupId int64, name string) error {
+	_, err := Call[SetGroupNameRequest, json.RawMessage](ctx, client, SET_GROUP_NAME, SetGroupNameRequest{GroupId: groupId, GroupName: name})
+	return err
+}
+
+// SetEssenceMsg 设置精华消息
+func (client *Client) SetEssenceMsg(ctx context.Context, messageId int64) error {
+	_, err := Call[MessageIdRequest, json.RawMessage](ctx, client, SET_ESSENCE_MSG, MessageIdRequest{MessageId: messageId})
+	return err
+}
+
+// DeleteEssenceMsg 移出精华消息
+func (client *Client) DeleteEssenceMsg(ctx context.Context, messageId int64) error {
+	_, err := Call[MessageIdRequest, json.RawMessage](ctx, client, DELETE_ESSENCE_MSG, MessageIdRequest{MessageId: messageId})
+	return err
+}
+
+// GetEssenceMsgList 获取精华消息列表
+func (client *Client) GetEssenceMsgList(ctx context.Context, groupId int64) ([]EssenceMsg, error) {
+	return Call[GroupRequest, []EssenceMsg](ctx, client, GET_ESSENCE_MSG_LIST, GroupRequest{GroupId: groupId})
+}
+
+// 运行状态
+
+// GetStatus 获取运行状态
+func (client *Client) GetStatus(ctx context.Context) (Status, error) {
+	return Call[struct{}, Status](ctx, client, GET_STATUS, struct{}{})
+}
+
+// GetVersionInfo 获取版本信息
+func (client *Client) GetVersionInfo(ctx context.Context) (VersionInfo, error) {
+	return Call[struct{}, VersionInfo](ctx, client, GET_VERSION_INFO, struct{}{})
+}
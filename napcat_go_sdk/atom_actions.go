@@ -1,49 +1,50 @@
 package napcat_go_sdk
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 )
 
-type SendMsg interface {
-	SendWebSocketMsg() interface{}
-	SendHttpMsg() interface{}
-}
-
 type ReceiveResponseMessage interface {
 	ReceiveResponseMessage(bytes []byte) error
 }
 
-func SingleTextMessage(text *string, user *string, ws *WebSocketClient) {
-	msg := Message[any]{
-		Action: "send_private_msg",
-		Params: SendMsgContent{
-			UserGroupId: UserGroupId{UserId: user},
-			Messages: []Msg{
-				{
-					Type: "text",
-					Data: MsgData{Text: text},
-				},
-			},
-		},
+// sendAction 调用不关心返回数据的接口，失败时只打印日志
+func sendAction(client *Client, action Action, params any) {
+	if client == nil {
+		fmt.Printf("%s失败: napcat client not initialized\n", action)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTimeout)
+	defer cancel()
+	if _, err := Call[any, json.RawMessage](ctx, client, action, params); err != nil {
+		fmt.Printf("%s失败: %v\n", action, err)
 	}
-	ws.SendMessage(msg)
 }
 
-func SingleGroupMessage(text *string, group *string, ws *WebSocketClient) {
-	msg := Message[any]{
-		Action: "send_group_msg",
-		Params: SendMsgContent{
-			UserGroupId: UserGroupId{GroupId: group},
-			Messages: []Msg{
-				{
-					Type: "text",
-					Data: MsgData{Text: text},
-				},
+func SingleTextMessage(text *string, user *string, client *Client) {
+	sendAction(client, "send_private_msg", SendMsgContent{
+		UserGroupId: UserGroupId{UserId: user},
+		Messages: []Msg{
+			{
+				Type: "text",
+				Data: MsgData{Text: text},
 			},
 		},
-	}
-	ws.SendMessage(msg)
+	})
+}
 
+func SingleGroupMessage(text *string, group *string, client *Client) {
+	sendAction(client, "send_group_msg", SendMsgContent{
+		UserGroupId: UserGroupId{GroupId: group},
+		Messages: []Msg{
+			{
+				Type: "text",
+				Data: MsgData{Text: text},
+			},
+		},
+	})
 }
 
 func NewMessageGroupInform(title *string, nickname *string, group *string, id *string) {
@@ -51,19 +52,19 @@ func NewMessageGroupInform(title *string, nickname *string, group *string, id *s
 	// api_host = utils.GetConfig("API_HOST", "")
 	// port = utils.GetConfig("PORT", "")
 	// rebuild_title_host = fmt.Sprintf("http://%s:%s/rebuild_title/", api_host, port)
-	ws, _ := GetExistWSClient()
+	client, _ := GetClient()
 	text := fmt.Sprintf("【翻旧账】用户【%s】向翻旧账推送名为【%s】的聊天记录。 ", *nickname, *title)
-	SingleGroupMessage(&text, group, ws)
+	SingleGroupMessage(&text, group, client)
 }
 
 func RebuildTitleInform(title *string, group *string, username *string) {
-	ws, _ := GetExistWSClient()
+	client, _ := GetClient()
 	text := fmt.Sprintf("【翻旧账】用户【%s】发起了【%s】对话的重命名", *username, *title)
-	SingleGroupMessage(&text, group, ws)
+	SingleGroupMessage(&text, group, client)
 }
 
 func PushQQInform(title *string, group *string, username *string) {
-	ws, _ := GetExistWSClient()
+	client, _ := GetClient()
 	text := fmt.Sprintf("【翻旧账】用户【%s】向您推送了【%s】对话", *username, *title)
-	SingleGroupMessage(&text, group, ws)
+	SingleGroupMessage(&text, group, client)
 }
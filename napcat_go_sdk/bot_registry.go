@@ -0,0 +1,281 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 发送失败（如被风控）后暂停使用该账号的默认时间
+	defaultFailoverCooldown = 10 * time.Minute
+	// 获取 bot 账号失败后重试的间隔
+	registerRetryInterval = 30 * time.Second
+)
+
+var (
+	botRegistryInstance *BotRegistry
+	botRegistryOnce     sync.Once
+)
+
+// BotRegistry 按 self_id 管理多个 bot 账号
+// 作为 Transport 使用时按优先级选择在线的账号；发送消息失败时暂停使用该账号并切换到下一个
+type BotRegistry struct {
+	mu          sync.RWMutex
+	bots        map[string]*Client   //按 self_id 保存的客户端
+	order       []string             //注册顺序
+	priority    []string             //优先使用的账号
+	cooldown    time.Duration        //发送失败后暂停使用的时间
+	unavailable map[string]time.Time //暂停使用的账号及恢复时间
+	clients     []*Client            //所有客户端，包括还未获取到 self_id 的
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func NewBotRegistry() *BotRegistry {
+	return &BotRegistry{
+		bots:        make(map[string]*Client),
+		cooldown:    defaultFailoverCooldown,
+		unavailable: make(map[string]time.Time),
+		done:        make(chan struct{}),
+	}
+}
+
+// GetBotRegistry 返回全局唯一的 BotRegistry
+func GetBotRegistry() *BotRegistry {
+	botRegistryOnce.Do(func() {
+		botRegistryInstance = NewBotRegistry()
+	})
+	return botRegistryInstance
+}
+
+// SetPriority 设置优先使用的账号，排在前面的优先；未列出的账号按注册顺序排在后面
+func (registry *BotRegistry) SetPriority(selfIds []string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.priority = append([]string(nil), selfIds...)
+}
+
+// SetCooldown 设置发送失败后暂停使用账号的时间
+func (registry *BotRegistry) SetCooldown(cooldown time.Duration) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.cooldown = cooldown
+}
+
+// Register 注册 self_id 对应的客户端，已存在时替换
+func (registry *BotRegistry) Register(selfId string, client *Client) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.bots[selfId]; !ok {
+		registry.order = append(registry.order, selfId)
+	}
+	registry.bots[selfId] = client
+	registry.track(client)
+	fmt.Printf("bot账号已注册: %s\n", selfId)
+}
+
+// track 记录客户端，关闭时一并关闭，调用方需持有锁
+func (registry *BotRegistry) track(client *Client) {
+	for _, c := range registry.clients {
+		if c == client {
+			return
+		}
+	}
+	registry.clients = append(registry.clients, client)
+}
+
+// Discover 通过 get_login_info 获取客户端的 self_id 并注册，失败时在后台重试直到成功或关闭
+func (registry *BotRegistry) Discover(client *Client) error {
+	registry.mu.Lock()
+	registry.track(client)
+	registry.mu.Unlock()
+
+	err := registry.discover(client)
+	if err != nil {
+		go func() {
+			ticker := time.NewTicker(registerRetryInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-registry.done:
+					return
+				case <-ticker.C:
+					if registry.discover(client) == nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+	return err
+}
+
+func (registry *BotRegistry) discover(client *Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	info, err := client.GetLoginInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("获取bot账号失败: %w", err)
+	}
+	registry.Register(strconv.FormatInt(info.UserId, 10), client)
+	return nil
+}
+
+// Get 返回 self_id 对应的客户端
+func (registry *BotRegistry) Get(selfId string) (*Client, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	client, ok := registry.bots[selfId]
+	return client, ok
+}
+
+// SelfIds 按注册顺序返回所有账号
+func (registry *BotRegistry) SelfIds() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return append([]string(nil), registry.order...)
+}
+
+// MarkUnavailable 暂停使用账号，暂停期间只在没有其他可用账号时使用
+func (registry *BotRegistry) MarkUnavailable(selfId string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.unavailable[selfId] = time.Now().Add(registry.cooldown)
+}
+
+// botCandidate 调用接口时依次尝试的账号
+type botCandidate struct {
+	selfId string
+	client *Client
+}
+
+// candidates 返回在线的账号：优先账号、其他账号、暂停使用的账号
+func (registry *BotRegistry) candidates() []botCandidate {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	seen := make(map[string]bool, len(registry.bots))
+	var available, paused []botCandidate
+	now := time.Now()
+	for _, selfId := range append(append([]string(nil), registry.priority...), registry.order...) {
+		client, ok := registry.bots[selfId]
+		if !ok || seen[selfId] {
+			continue
+		}
+		seen[selfId] = true
+		if !client.IsConnected() {
+			continue
+		}
+		candidate := botCandidate{selfId: selfId, client: client}
+		if until, ok := registry.unavailable[selfId]; ok && now.Before(until) {
+			paused = append(paused, candidate)
+			continue
+		}
+		available = append(available, candidate)
+	}
+	return append(available, paused...)
+}
+
+// Send 实现 Transport，依次尝试可用的账号
+// 请求没有发出（账号未连接、HTTP 建立连接失败）时直接尝试下一个；发送消息返回失败时暂停使用该账号再尝试下一个；
+// 其他错误（包括超时和等待响应时断开，消息可能已经发出）直接返回，避免重复发送
+func (registry *BotRegistry) Send(ctx context.Context, action Action, params any) ([]byte, error) {
+	var (
+		lastResponse []byte
+		lastErr      error = ErrNotConnected
+	)
+	for _, candidate := range registry.candidates() {
+		response, err := candidate.client.Send(ctx, action, params)
+		switch {
+		case err == nil && !(isSendAction(action) && failedResponse(response)):
+			return response, nil
+		case err == nil:
+			fmt.Printf("bot账号 %s 调用%s失败，暂停使用 %v: %s\n", candidate.selfId, action, registry.cooldown, response)
+			registry.MarkUnavailable(candidate.selfId)
+			lastResponse, lastErr = response, nil
+		case requestNotSent(err):
+			// 请求没有发出，可以安全地换一个账号
+			lastErr = err
+		default:
+			return response, err
+		}
+	}
+	if lastResponse != nil {
+		return lastResponse, nil
+	}
+	return nil, lastErr
+}
+
+// requestNotSent 错误是否发生在请求发出之前
+func requestNotSent(err error) bool {
+	if errors.Is(err, ErrNotConnected) {
+		return true
+	}
+	// HTTP 建立连接失败（包括域名解析失败）时请求还没有写出
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isSendAction 是否为发送消息类的接口，只有这类接口会在失败时切换账号
+func isSendAction(action Action) bool {
+	return strings.HasPrefix(string(action), "send_")
+}
+
+// failedResponse 响应中的 retcode 是否表示失败
+func failedResponse(response []byte) bool {
+	var result HttpResponse[json.RawMessage]
+	if err := json.Unmarshal(response, &result); err != nil {
+		return false
+	}
+	return result.Retcode != 0 || (result.Status != "ok" && result.Status != "async")
+}
+
+// IsConnected 是否有账号在线
+func (registry *BotRegistry) IsConnected() bool {
+	return len(registry.candidates()) > 0
+}
+
+// PendingRequests 所有账号等待响应的请求数量
+func (registry *BotRegistry) PendingRequests() int {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	count := 0
+	for _, client := range registry.clients {
+		count += client.PendingRequests()
+	}
+	return count
+}
+
+// Close 关闭所有客户端并停止后台注册
+func (registry *BotRegistry) Close() error {
+	registry.closeOnce.Do(func() {
+		close(registry.done)
+	})
+	registry.mu.RLock()
+	clients := append([]*Client(nil), registry.clients...)
+	registry.mu.RUnlock()
+
+	var errs []error
+	for _, client := range clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetBot 返回 self_id 对应的客户端
+func GetBot(selfId string) (*Client, error) {
+	client, ok := GetBotRegistry().Get(selfId)
+	if !ok {
+		return nil, fmt.Errorf("bot %s not registered", selfId)
+	}
+	return client, nil
+}
@@ -0,0 +1,135 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeTransport 按预设结果响应的传输层，记录调用次数
+type fakeTransport struct {
+	connected bool
+	response  []byte
+	err       error
+	calls     int
+}
+
+func (f *fakeTransport) Send(ctx context.Context, action Action, params any) ([]byte, error) {
+	f.calls++
+	return f.response, f.err
+}
+func (f *fakeTransport) IsConnected() bool    { return f.connected }
+func (f *fakeTransport) PendingRequests() int { return 0 }
+func (f *fakeTransport) Close() error         { return nil }
+
+var (
+	successResponse = []byte(`{"status":"ok","retcode":0}`)
+	retcodeResponse = []byte(`{"status":"failed","retcode":1200}`)
+)
+
+// newTestRegistry 按顺序注册账号 1、2、3…
+func newTestRegistry(transports ...Transport) *BotRegistry {
+	registry := NewBotRegistry()
+	for i, transport := range transports {
+		registry.Register(fmt.Sprint(i+1), NewClient(transport))
+	}
+	return registry
+}
+
+func TestBotRegistryFailover(t *testing.T) {
+	// 拒绝连接的地址，请求在建立连接时失败
+	server := httptest.NewServer(http.NotFoundHandler())
+	closedURL := server.URL
+	server.Close()
+
+	tests := []struct {
+		name  string
+		first Transport
+	}{
+		{"offline", &fakeTransport{connected: false}},
+		{"not connected", &fakeTransport{connected: true, err: ErrNotConnected}},
+		{"wrapped not connected", &fakeTransport{connected: true, err: fmt.Errorf("send_msg: %w", ErrNotConnected)}},
+		{"http dial error", NewHttpClient(closedURL, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			second := &fakeTransport{connected: true, response: successResponse}
+			registry := newTestRegistry(tt.first, second)
+			if _, err := registry.Send(context.Background(), "send_private_msg", nil); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if second.calls != 1 {
+				t.Errorf("second bot calls = %d, want 1", second.calls)
+			}
+		})
+	}
+}
+
+func TestBotRegistryNoFailoverAfterSend(t *testing.T) {
+	// 请求可能已经发出的错误不能换账号重试
+	for _, err := range []error{
+		fmt.Errorf("%w: read: connection reset", ErrConnectionLost),
+		fmt.Errorf("send_private_msg: %w", context.DeadlineExceeded),
+	} {
+		first := &fakeTransport{connected: true, err: err}
+		second := &fakeTransport{connected: true, response: successResponse}
+		registry := newTestRegistry(first, second)
+		if _, got := registry.Send(context.Background(), "send_private_msg", nil); !errors.Is(got, err) {
+			t.Errorf("Send() error = %v, want %v", got, err)
+		}
+		if second.calls != 0 {
+			t.Errorf("second bot was called after %v", err)
+		}
+	}
+}
+
+func TestBotRegistryFailedResponse(t *testing.T) {
+	first := &fakeTransport{connected: true, response: retcodeResponse}
+	second := &fakeTransport{connected: true, response: successResponse}
+	registry := newTestRegistry(first, second)
+	registry.SetCooldown(time.Minute)
+
+	if _, err := registry.Send(context.Background(), "send_private_msg", nil); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if first.calls != 1 || second.calls != 1 {
+		t.Fatalf("calls = %d, %d, want 1, 1", first.calls, second.calls)
+	}
+	// 暂停使用的账号排在最后
+	if candidates := registry.candidates(); candidates[0].selfId != "2" || candidates[1].selfId != "1" {
+		t.Errorf("candidates = %v, want paused bot last", candidates)
+	}
+
+	// 非发送消息的接口失败时不切换账号
+	registry = newTestRegistry(&fakeTransport{connected: true, response: retcodeResponse}, second)
+	response, err := registry.Send(context.Background(), "get_login_info", nil)
+	if err != nil || string(response) != string(retcodeResponse) || second.calls != 1 {
+		t.Errorf("Send() = %s, %v; second bot calls = %d", response, err, second.calls)
+	}
+
+	// 所有账号都失败时返回最后一个响应
+	registry = newTestRegistry(&fakeTransport{connected: true, response: retcodeResponse})
+	if response, err := registry.Send(context.Background(), "send_group_msg", nil); err != nil || string(response) != string(retcodeResponse) {
+		t.Errorf("Send() = %s, %v", response, err)
+	}
+}
+
+func TestBotRegistryPriority(t *testing.T) {
+	first := &fakeTransport{connected: true, response: successResponse}
+	second := &fakeTransport{connected: true, response: successResponse}
+	registry := newTestRegistry(first, second)
+	registry.SetPriority([]string{"2"})
+
+	registry.Send(context.Background(), "send_private_msg", nil)
+	if first.calls != 0 || second.calls != 1 {
+		t.Errorf("calls = %d, %d, want priority bot only", first.calls, second.calls)
+	}
+
+	if _, err := newTestRegistry().Send(context.Background(), "send_private_msg", nil); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Send() without bots error = %v, want ErrNotConnected", err)
+	}
+}
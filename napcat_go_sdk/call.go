@@ -0,0 +1,60 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// OneBotError 接口调用失败：status 不为 ok/async 或 retcode 不为0
+type OneBotError struct {
+	Action  Action
+	Status  string
+	Retcode int
+	Message string
+	Wording string
+}
+
+func (e *OneBotError) Error() string {
+	message := e.Wording
+	if message == "" {
+		message = e.Message
+	}
+	return fmt.Sprintf("%s failed: status=%s retcode=%d %s", e.Action, e.Status, e.Retcode, message)
+}
+
+// Call 调用接口并等待响应，检查 retcode 后将 data 解析为 Resp
+// ctx 没有截止时间时一直等待，直到收到响应、连接断开或客户端关闭；不需要返回数据时 Resp 可以使用 json.RawMessage
+func Call[Req any, Resp any](ctx context.Context, transport Transport, action Action, params Req) (Resp, error) {
+	var result Resp
+	if transport == nil {
+		return result, ErrNotConnected
+	}
+
+	raw, err := transport.Send(ctx, action, params)
+	if err != nil {
+		return result, err
+	}
+
+	var response HttpResponse[json.RawMessage]
+	if err := response.ReceiveResponseMessage(raw); err != nil {
+		return result, fmt.Errorf("解析%s响应失败: %w", action, err)
+	}
+	if response.Retcode != 0 || (response.Status != "ok" && response.Status != "async") {
+		return result, &OneBotError{
+			Action:  action,
+			Status:  response.Status,
+			Retcode: response.Retcode,
+			Message: response.Message,
+			Wording: response.Wording,
+		}
+	}
+
+	if len(response.Data) == 0 || string(response.Data) == "null" {
+		return result, nil
+	}
+	if err := json.Unmarshal(response.Data, &result); err != nil {
+		return result, fmt.Errorf("解析%s响应数据失败: %w", action, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newNapCatServer 模拟 NapCat HTTP服务，记录最后一次请求并返回 status 和 body
+func newNapCatServer(t *testing.T, status int, body string) (*httptest.Server, *http.Request, *[]byte) {
+	t.Helper()
+	var last http.Request
+	var params []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = *r.Clone(context.Background())
+		params, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &last, &params
+}
+
+func TestCallRetcode(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		retcode int
+	}{
+		{"retcode", http.StatusOK, `{"status":"failed","retcode":1404,"message":"not found","wording":"群不存在"}`, 1404},
+		// NapCat 接口失败时HTTP状态码也可能不是200，仍然按响应体中的 retcode 返回错误
+		{"http error with body", http.StatusBadRequest, `{"status":"failed","retcode":1400,"message":"bad request"}`, 1400},
+		{"status failed", http.StatusOK, `{"status":"failed","retcode":0}`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, _ := newNapCatServer(t, tt.status, tt.body)
+			_, err := NewClient(NewHttpClient(server.URL, nil)).GetLoginInfo(context.Background())
+
+			var oneBotErr *OneBotError
+			if !errors.As(err, &oneBotErr) {
+				t.Fatalf("GetLoginInfo() error = %v, want OneBotError", err)
+			}
+			if oneBotErr.Action != GET_LOGIN_INFO || oneBotErr.Retcode != tt.retcode || oneBotErr.Status != "failed" {
+				t.Errorf("error = %+v", oneBotErr)
+			}
+		})
+	}
+
+	server, _, _ := newNapCatServer(t, http.StatusBadGateway, "bad gateway")
+	_, err := NewClient(NewHttpClient(server.URL, nil)).GetLoginInfo(context.Background())
+	var oneBotErr *OneBotError
+	if err == nil || errors.As(err, &oneBotErr) {
+		t.Errorf("GetLoginInfo() error = %v, want transport error", err)
+	}
+}
@@ -0,0 +1,173 @@
+package napcat_go_sdk
+
+// PostType 上报类型
+type PostType string
+
+const (
+	// POST_MESSAGE 消息事件
+	POST_MESSAGE PostType = "message"
+	// POST_MESSAGE_SENT bot 自身发送的消息
+	POST_MESSAGE_SENT PostType = "message_sent"
+	// POST_NOTICE 通知事件
+	POST_NOTICE PostType = "notice"
+	// POST_REQUEST 请求事件
+	POST_REQUEST PostType = "request"
+	// POST_META_EVENT 元事件
+	POST_META_EVENT PostType = "meta_event"
+)
+
+// Event 所有上报事件的公共字段
+type Event struct {
+	Time     int64    `json:"time"`
+	SelfId   int64    `json:"self_id"`
+	PostType PostType `json:"post_type"`
+}
+
+// eventFrame 用于区分上报事件与接口响应的最小结构
+type eventFrame struct {
+	PostType      PostType   `json:"post_type"`
+	MessageType   string     `json:"message_type"`
+	NoticeType    string     `json:"notice_type"`
+	RequestType   string     `json:"request_type"`
+	MetaEventType string     `json:"meta_event_type"`
+	SubType       string     `json:"sub_type"`
+	Echo          string     `json:"echo"`
+	Time          int64      `json:"time"`
+	MessageId     FlexString `json:"message_id"`
+	// Replayed 由 resume 补发的历史消息，不是上报数据中的字段
+	Replayed bool `json:"-"`
+}
+
+// detailType 返回事件的二级类型，如 group_recall、friend、heartbeat
+func (f *eventFrame) detailType() string {
+	switch f.PostType {
+	case POST_MESSAGE, POST_MESSAGE_SENT:
+		return f.MessageType
+	case POST_NOTICE:
+		return f.NoticeType
+	case POST_REQUEST:
+		return f.RequestType
+	case POST_META_EVENT:
+		return f.MetaEventType
+	}
+	return ""
+}
+
+// NoticeEvent 通用通知事件，未单独定义类型的通知可通过 OnNotice 获取
+type NoticeEvent struct {
+	Event
+	NoticeType string `json:"notice_type"`
+	SubType    string `json:"sub_type"`
+	GroupId    int64  `json:"group_id"`
+	UserId     int64  `json:"user_id"`
+	OperatorId int64  `json:"operator_id"`
+	TargetId   int64  `json:"target_id"`
+	MessageId  int64  `json:"message_id"`
+	Duration   int64  `json:"duration"`
+}
+
+// GroupRecallNotice 群消息撤回
+type GroupRecallNotice struct {
+	Event
+	GroupId    int64 `json:"group_id"`
+	UserId     int64 `json:"user_id"`
+	OperatorId int64 `json:"operator_id"`
+	MessageId  int64 `json:"message_id"`
+}
+
+// FriendRecallNotice 好友消息撤回
+type FriendRecallNotice struct {
+	Event
+	UserId    int64 `json:"user_id"`
+	MessageId int64 `json:"message_id"`
+}
+
+// FriendAddNotice 新增好友
+type FriendAddNotice struct {
+	Event
+	UserId int64 `json:"user_id"`
+}
+
+// PokeNotice 戳一戳，私聊戳一戳时 GroupId 为 0
+type PokeNotice struct {
+	Event
+	GroupId  int64 `json:"group_id"`
+	UserId   int64 `json:"user_id"`
+	TargetId int64 `json:"target_id"`
+}
+
+// GroupMemberChangeNotice 群成员增加/减少
+// 增加时 SubType 为 approve/invite，减少时为 leave/kick/kick_me
+type GroupMemberChangeNotice struct {
+	Event
+	NoticeType string `json:"notice_type"`
+	SubType    string `json:"sub_type"`
+	GroupId    int64  `json:"group_id"`
+	UserId     int64  `json:"user_id"`
+	OperatorId int64  `json:"operator_id"`
+}
+
+// GroupAdminNotice 群管理员变动，SubType 为 set/unset
+type GroupAdminNotice struct {
+	Event
+	SubType string `json:"sub_type"`
+	GroupId int64  `json:"group_id"`
+	UserId  int64  `json:"user_id"`
+}
+
+// GroupBanNotice 群禁言，SubType 为 ban/lift_ban
+type GroupBanNotice struct {
+	Event
+	SubType    string `json:"sub_type"`
+	GroupId    int64  `json:"group_id"`
+	UserId     int64  `json:"user_id"`
+	OperatorId int64  `json:"operator_id"`
+	Duration   int64  `json:"duration"`
+}
+
+// GroupUploadNotice 群文件上传
+type GroupUploadNotice struct {
+	Event
+	GroupId int64 `json:"group_id"`
+	UserId  int64 `json:"user_id"`
+	File    struct {
+		Id    string `json:"id"`
+		Name  string `json:"name"`
+		Size  int64  `json:"size"`
+		Busid int64  `json:"busid"`
+	} `json:"file"`
+}
+
+// FriendRequestEvent 加好友请求
+type FriendRequestEvent struct {
+	Event
+	UserId  int64  `json:"user_id"`
+	Comment string `json:"comment"`
+	Flag    string `json:"flag"`
+}
+
+// GroupRequestEvent 加群请求/邀请，SubType 为 add/invite
+type GroupRequestEvent struct {
+	Event
+	SubType string `json:"sub_type"`
+	GroupId int64  `json:"group_id"`
+	UserId  int64  `json:"user_id"`
+	Comment string `json:"comment"`
+	Flag    string `json:"flag"`
+}
+
+// HeartbeatEvent 心跳
+type HeartbeatEvent struct {
+	Event
+	Interval int64 `json:"interval"`
+	Status   struct {
+		Online bool `json:"online"`
+		Good   bool `json:"good"`
+	} `json:"status"`
+}
+
+// LifecycleEvent 生命周期，SubType 为 enable/disable/connect
+type LifecycleEvent struct {
+	Event
+	SubType string `json:"sub_type"`
+}
@@ -0,0 +1,153 @@
+package napcat_go_sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// EventRouter 按 post_type 及其子类型把上报事件分发到对应的回调
+//
+// 路由键由 post_type、二级类型、sub_type 逐级拼接而成，例如：
+// "notice"、"notice.group_recall"、"notice.notify.poke"。
+// 同一事件会依次匹配所有层级，因此既可以注册具体事件也可以注册整类事件。
+type EventRouter struct {
+	mu       sync.RWMutex
+	handlers map[string][]func(raw []byte) error
+}
+
+func NewEventRouter() *EventRouter {
+	return &EventRouter{handlers: make(map[string][]func(raw []byte) error)}
+}
+
+// on 注册回调，回调收到的事件由原始 JSON 解析为 T
+func on[T any](r *EventRouter, key string, fn func(event *T)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[key] = append(r.handlers[key], func(raw []byte) error {
+		var event T
+		if err := json.Unmarshal(raw, &event); err != nil {
+			return err
+		}
+		fn(&event)
+		return nil
+	})
+}
+
+// OnPrivateMessage 私聊消息
+func (r *EventRouter) OnPrivateMessage(fn func(message *ReceiveMessage)) {
+	on(r, "message.private", fn)
+}
+
+// OnGroupMessage 群聊消息
+func (r *EventRouter) OnGroupMessage(fn func(message *ReceiveMessage)) {
+	on(r, "message.group", fn)
+}
+
+// OnNotice 所有通知事件
+func (r *EventRouter) OnNotice(fn func(notice *NoticeEvent)) {
+	on(r, "notice", fn)
+}
+
+// OnGroupRecall 群消息撤回
+func (r *EventRouter) OnGroupRecall(fn func(notice *GroupRecallNotice)) {
+	on(r, "notice.group_recall", fn)
+}
+
+// OnFriendRecall 好友消息撤回
+func (r *EventRouter) OnFriendRecall(fn func(notice *FriendRecallNotice)) {
+	on(r, "notice.friend_recall", fn)
+}
+
+// OnFriendAdd 新增好友
+func (r *EventRouter) OnFriendAdd(fn func(notice *FriendAddNotice)) {
+	on(r, "notice.friend_add", fn)
+}
+
+// OnPoke 戳一戳（群聊和私聊）
+func (r *EventRouter) OnPoke(fn func(notice *PokeNotice)) {
+	on(r, "notice.notify.poke", fn)
+}
+
+// OnGroupIncrease 群成员增加
+func (r *EventRouter) OnGroupIncrease(fn func(notice *GroupMemberChangeNotice)) {
+	on(r, "notice.group_increase", fn)
+}
+
+// OnGroupDecrease 群成员减少
+func (r *EventRouter) OnGroupDecrease(fn func(notice *GroupMemberChangeNotice)) {
+	on(r, "notice.group_decrease", fn)
+}
+
+// OnGroupAdmin 群管理员变动
+func (r *EventRouter) OnGroupAdmin(fn func(notice *GroupAdminNotice)) {
+	on(r, "notice.group_admin", fn)
+}
+
+// OnGroupBan 群禁言
+func (r *EventRouter) OnGroupBan(fn func(notice *GroupBanNotice)) {
+	on(r, "notice.group_ban", fn)
+}
+
+// OnGroupUpload 群文件上传
+func (r *EventRouter) OnGroupUpload(fn func(notice *GroupUploadNotice)) {
+	on(r, "notice.group_upload", fn)
+}
+
+// OnFriendRequest 加好友请求
+func (r *EventRouter) OnFriendRequest(fn func(request *FriendRequestEvent)) {
+	on(r, "request.friend", fn)
+}
+
+// OnGroupRequest 加群请求/邀请
+func (r *EventRouter) OnGroupRequest(fn func(request *GroupRequestEvent)) {
+	on(r, "request.group", fn)
+}
+
+// OnHeartbeat 心跳元事件
+func (r *EventRouter) OnHeartbeat(fn func(event *HeartbeatEvent)) {
+	on(r, "meta_event.heartbeat", fn)
+}
+
+// OnLifecycle 生命周期元事件
+func (r *EventRouter) OnLifecycle(fn func(event *LifecycleEvent)) {
+	on(r, "meta_event.lifecycle", fn)
+}
+
+// routeKeys 计算事件匹配的全部路由键，由粗到细
+func routeKeys(frame *eventFrame) []string {
+	keys := []string{string(frame.PostType)}
+	detail := frame.detailType()
+	if detail == "" {
+		return keys
+	}
+	keys = append(keys, fmt.Sprintf("%s.%s", frame.PostType, detail))
+	if frame.SubType != "" {
+		keys = append(keys, fmt.Sprintf("%s.%s.%s", frame.PostType, detail, frame.SubType))
+	}
+	return keys
+}
+
+// Dispatch 将事件异步分发给匹配的回调
+func (r *EventRouter) Dispatch(frame *eventFrame, raw []byte) {
+	r.mu.RLock()
+	var matched []func(raw []byte) error
+	for _, key := range routeKeys(frame) {
+		matched = append(matched, r.handlers[key]...)
+	}
+	r.mu.RUnlock()
+
+	for _, handler := range matched {
+		go func(h func(raw []byte) error) {
+			// 单个回调出错不影响其他回调和读协程
+			defer func() {
+				if p := recover(); p != nil {
+					fmt.Printf("事件处理器异常: %v\n", p)
+				}
+			}()
+			if err := h(raw); err != nil {
+				fmt.Printf("解析%s事件失败: %v\n", frame.PostType, err)
+			}
+		}(handler)
+	}
+}
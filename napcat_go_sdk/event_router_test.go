@@ -0,0 +1,139 @@
+package napcat_go_sdk
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRouteKeys(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want []string
+	}{
+		{`{"post_type":"message","message_type":"group","sub_type":"normal"}`,
+			[]string{"message", "message.group", "message.group.normal"}},
+		{`{"post_type":"notice","notice_type":"notify","sub_type":"poke"}`,
+			[]string{"notice", "notice.notify", "notice.notify.poke"}},
+		{`{"post_type":"notice","notice_type":"group_recall"}`,
+			[]string{"notice", "notice.group_recall"}},
+		{`{"post_type":"request","request_type":"group","sub_type":"invite"}`,
+			[]string{"request", "request.group", "request.group.invite"}},
+		{`{"post_type":"meta_event","meta_event_type":"heartbeat"}`,
+			[]string{"meta_event", "meta_event.heartbeat"}},
+		// 没有二级类型时不拼接 sub_type
+		{`{"post_type":"notice","sub_type":"poke"}`, []string{"notice"}},
+		{`{"post_type":"unknown","sub_type":"x"}`, []string{"unknown"}},
+	}
+	for _, tt := range tests {
+		var frame eventFrame
+		if err := json.Unmarshal([]byte(tt.raw), &frame); err != nil {
+			t.Fatal(err)
+		}
+		if got := routeKeys(&frame); !slices.Equal(got, tt.want) {
+			t.Errorf("routeKeys(%s) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// dispatchRaw 解析事件并分发，与实际上报的处理方式相同
+func dispatchRaw(t *testing.T, router *EventRouter, raw string) {
+	t.Helper()
+	var frame eventFrame
+	if err := json.Unmarshal([]byte(raw), &frame); err != nil {
+		t.Fatal(err)
+	}
+	router.Dispatch(&frame, []byte(raw))
+}
+
+// receive 等待回调结果，超时视为没有调用
+func receive[T any](t *testing.T, ch <-chan T, name string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatalf("%s not called", name)
+	}
+	var zero T
+	return zero
+}
+
+func TestEventRouterDispatch(t *testing.T) {
+	router := NewEventRouter()
+	pokes := make(chan *PokeNotice, 1)
+	notices := make(chan *NoticeEvent, 4)
+	recalls := make(chan *GroupRecallNotice, 1)
+	requests := make(chan *GroupRequestEvent, 1)
+	heartbeats := make(chan *HeartbeatEvent, 1)
+	router.OnPoke(func(n *PokeNotice) { pokes <- n })
+	router.OnNotice(func(n *NoticeEvent) { notices <- n })
+	router.OnGroupRecall(func(n *GroupRecallNotice) { recalls <- n })
+	router.OnGroupRequest(func(r *GroupRequestEvent) { requests <- r })
+	router.OnHeartbeat(func(e *HeartbeatEvent) { heartbeats <- e })
+
+	tests := []struct {
+		name  string
+		raw   string
+		check func(t *testing.T)
+	}{
+		{"poke", `{"post_type":"notice","notice_type":"notify","sub_type":"poke","self_id":1,"group_id":100,"user_id":2,"target_id":1}`,
+			func(t *testing.T) {
+				if poke := receive(t, pokes, "OnPoke"); poke.GroupId != 100 || poke.TargetId != 1 || poke.SelfId != 1 {
+					t.Errorf("poke = %+v", poke)
+				}
+				// 具体事件同时匹配整类事件
+				if notice := receive(t, notices, "OnNotice"); notice.NoticeType != "notify" || notice.SubType != "poke" {
+					t.Errorf("notice = %+v", notice)
+				}
+			}},
+		{"group recall", `{"post_type":"notice","notice_type":"group_recall","group_id":100,"operator_id":3,"message_id":42}`,
+			func(t *testing.T) {
+				if recall := receive(t, recalls, "OnGroupRecall"); recall.MessageId != 42 || recall.OperatorId != 3 {
+					t.Errorf("recall = %+v", recall)
+				}
+				receive(t, notices, "OnNotice")
+			}},
+		{"unregistered notice", `{"post_type":"notice","notice_type":"group_card","group_id":100,"user_id":2}`,
+			func(t *testing.T) {
+				if notice := receive(t, notices, "OnNotice"); notice.NoticeType != "group_card" || notice.UserId != 2 {
+					t.Errorf("notice = %+v", notice)
+				}
+			}},
+		{"group request", `{"post_type":"request","request_type":"group","sub_type":"invite","group_id":100,"comment":"hi","flag":"f"}`,
+			func(t *testing.T) {
+				if request := receive(t, requests, "OnGroupRequest"); request.SubType != "invite" || request.Flag != "f" {
+					t.Errorf("request = %+v", request)
+				}
+			}},
+		{"heartbeat", `{"post_type":"meta_event","meta_event_type":"heartbeat","interval":5000,"status":{"online":true,"good":true}}`,
+			func(t *testing.T) {
+				if heartbeat := receive(t, heartbeats, "OnHeartbeat"); heartbeat.Interval != 5000 || !heartbeat.Status.Online {
+					t.Errorf("heartbeat = %+v", heartbeat)
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatchRaw(t, router, tt.raw)
+			tt.check(t)
+		})
+	}
+}
+
+func TestEventRouterRecoversPanic(t *testing.T) {
+	router := NewEventRouter()
+	recalls := make(chan int64, 2)
+	router.OnGroupRecall(func(*GroupRecallNotice) { panic("handler bug") })
+	router.OnGroupRecall(func(n *GroupRecallNotice) { recalls <- n.MessageId })
+
+	// 回调 panic 不影响同一事件的其他回调和之后的事件
+	dispatchRaw(t, router, `{"post_type":"notice","notice_type":"group_recall","message_id":1}`)
+	dispatchRaw(t, router, `{"post_type":"notice","notice_type":"group_recall","message_id":2}`)
+	got := []int64{receive(t, recalls, "OnGroupRecall"), receive(t, recalls, "OnGroupRecall")}
+	slices.Sort(got)
+	if !slices.Equal(got, []int64{1, 2}) {
+		t.Errorf("recalls = %v", got)
+	}
+}
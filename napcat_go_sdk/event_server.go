@@ -0,0 +1,178 @@
+package napcat_go_sdk
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"snail.local/snailllllll/utils"
+)
+
+// webhook 请求体的最大长度
+const maxWebhookBody = 10 << 20
+
+var (
+	eventServerInstance *EventServer
+	eventServerOnce     sync.Once
+)
+
+// EventServer 接收 NapCat 推送的事件：反向WebSocket和HTTP上报
+// 多个 bot 账号可以同时连接，按 self_id 区分；所有事件进入同一条处理器链
+// 处理器需要在挂载到路由之前注册
+type EventServer struct {
+	Handler []HandlerMessage //消息处理器
+	Events  *EventRouter     //按事件类型分发的路由
+
+	token    string
+	registry *BotRegistry //bot 首次连接时注册到的账号列表，为空时不注册
+	mu       sync.RWMutex
+	bots     map[string]*ReverseWebSocket //按 self_id 保存的反向WebSocket连接
+	order    []string                     //bot 首次连接的顺序
+	closed   bool
+}
+
+func NewEventServer(token string) *EventServer {
+	return &EventServer{
+		Handler: make([]HandlerMessage, 0),
+		Events:  NewEventRouter(),
+		token:   token,
+		bots:    make(map[string]*ReverseWebSocket),
+	}
+}
+
+// GetEventServer 返回全局唯一的 EventServer，使用 napcat.token 鉴权并注册 BaseHandler
+// 反向WebSocket连接的账号会注册到 GetBotRegistry
+func GetEventServer() *EventServer {
+	eventServerOnce.Do(func() {
+		eventServerInstance = NewEventServer(utils.Config.NapCat.Token)
+		eventServerInstance.Handler = append(eventServerInstance.Handler, &(BaseHandler{}))
+		eventServerInstance.registry = GetBotRegistry()
+	})
+	return eventServerInstance
+}
+
+// ServeWebSocket 反向WebSocket入口，NapCat 通过 X-Self-ID 请求头标明 bot 账号
+func (server *EventServer) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !checkAccessToken(r, server.token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	selfId := r.Header.Get("X-Self-ID")
+	if _, err := strconv.ParseInt(selfId, 10, 64); err != nil {
+		http.Error(w, "invalid X-Self-ID", http.StatusBadRequest)
+		return
+	}
+
+	bot, err := server.bot(selfId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	bot.serve(w, r)
+}
+
+// ServeWebhook HTTP上报入口，支持 X-Signature（HMAC-SHA1）或 access token 鉴权
+func (server *EventServer) ServeWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if !server.checkWebhook(r, body) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var frame eventFrame
+	if err := json.Unmarshal(body, &frame); err != nil || frame.PostType == "" {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+	if err := dispatchEvent(server.Handler, server.Events, &frame, body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 不使用快速操作
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkWebhook NapCat 配置了 secret 时使用 X-Signature: sha1=<hmac>，否则使用 access token
+func (server *EventServer) checkWebhook(r *http.Request, body []byte) bool {
+	signature := r.Header.Get("X-Signature")
+	if signature == "" {
+		return checkAccessToken(r, server.token)
+	}
+	if server.token == "" {
+		return false
+	}
+	mac := hmac.New(sha1.New, []byte(server.token))
+	mac.Write(body)
+	expected := "sha1=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(strings.ToLower(signature)), []byte(expected))
+}
+
+// bot 获取 self_id 对应的连接，首次连接时创建
+func (server *EventServer) bot(selfId string) (*ReverseWebSocket, error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.closed {
+		return nil, ErrClientClosed
+	}
+	if bot, ok := server.bots[selfId]; ok {
+		return bot, nil
+	}
+	bot := NewReverseWebSocket(server.token)
+	bot.Handler = server.Handler
+	bot.Events = server.Events
+	server.bots[selfId] = bot
+	server.order = append(server.order, selfId)
+	if server.registry != nil {
+		server.registry.Register(selfId, NewClient(bot))
+	}
+	return bot, nil
+}
+
+// Bot 返回 self_id 对应的反向WebSocket连接
+func (server *EventServer) Bot(selfId string) (*ReverseWebSocket, bool) {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	bot, ok := server.bots[selfId]
+	return bot, ok
+}
+
+// SelfIds 按首次连接顺序返回所有连接过的 bot 账号
+func (server *EventServer) SelfIds() []string {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	return append([]string(nil), server.order...)
+}
+
+// Close 断开所有 bot 并拒绝新的连接
+func (server *EventServer) Close() error {
+	server.mu.Lock()
+	server.closed = true
+	bots := make([]*ReverseWebSocket, 0, len(server.bots))
+	for _, bot := range server.bots {
+		bots = append(bots, bot)
+	}
+	server.mu.Unlock()
+
+	var errs []error
+	for _, bot := range bots {
+		if err := bot.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("close event server: %w", err)
+	}
+	return nil
+}
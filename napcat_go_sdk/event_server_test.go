@@ -0,0 +1,123 @@
+package napcat_go_sdk
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testEvent = `{"post_type":"notice","notice_type":"group_recall","group_id":100,"message_id":42}`
+
+// sign 按 NapCat 的方式计算 X-Signature
+func sign(secret, body string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestServeWebhook(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header map[string]string
+		query  string
+		want   int
+	}{
+		{"signature", "secret", map[string]string{"X-Signature": sign("secret", testEvent)}, "", http.StatusNoContent},
+		{"uppercase signature", "secret", map[string]string{"X-Signature": strings.ToUpper(sign("secret", testEvent))}, "", http.StatusNoContent},
+		{"wrong signature", "secret", map[string]string{"X-Signature": sign("other", testEvent)}, "", http.StatusUnauthorized},
+		// 签名错误时不再尝试 access token
+		{"wrong signature with token", "secret", map[string]string{"X-Signature": "sha1=00", "Authorization": "Bearer secret"}, "", http.StatusUnauthorized},
+		{"bearer token", "secret", map[string]string{"Authorization": "Bearer secret"}, "", http.StatusNoContent},
+		{"query token", "secret", nil, "?access_token=secret", http.StatusNoContent},
+		{"wrong token", "secret", map[string]string{"Authorization": "Bearer other"}, "", http.StatusUnauthorized},
+		{"no credentials", "secret", nil, "", http.StatusUnauthorized},
+		// 未配置 token 时拒绝所有上报
+		{"no token configured", "", map[string]string{"X-Signature": sign("", testEvent)}, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewEventServer(tt.token)
+			recalls := make(chan *GroupRecallNotice, 1)
+			server.Events.OnGroupRecall(func(n *GroupRecallNotice) { recalls <- n })
+
+			r := httptest.NewRequest(http.MethodPost, "/onebot/event"+tt.query, strings.NewReader(testEvent))
+			for key, value := range tt.header {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			server.ServeWebhook(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+
+			select {
+			case recall := <-recalls:
+				if tt.want != http.StatusNoContent {
+					t.Error("rejected event was dispatched")
+				} else if recall.MessageId != 42 {
+					t.Errorf("recall = %+v", recall)
+				}
+			case <-time.After(50 * time.Millisecond):
+				if tt.want == http.StatusNoContent {
+					t.Error("accepted event was not dispatched")
+				}
+			}
+		})
+	}
+}
+
+func TestServeWebSocketToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header http.Header
+		want   int
+	}{
+		{"no token configured", "", http.Header{"X-Self-ID": {"10001"}}, http.StatusUnauthorized},
+		{"missing token", "secret", http.Header{"X-Self-ID": {"10001"}}, http.StatusUnauthorized},
+		{"wrong token", "secret", http.Header{"X-Self-ID": {"10001"}, "Authorization": {"Bearer other"}}, http.StatusUnauthorized},
+		{"invalid self id", "secret", http.Header{"X-Self-ID": {"bot"}, "Authorization": {"Bearer secret"}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewEventServer(tt.token)
+			httpServer := httptest.NewServer(http.HandlerFunc(server.ServeWebSocket))
+			defer httpServer.Close()
+
+			conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), tt.header)
+			if err == nil {
+				conn.Close()
+				t.Fatal("connection was accepted")
+			}
+			if resp == nil || resp.StatusCode != tt.want {
+				t.Fatalf("response = %v, want status %d", resp, tt.want)
+			}
+			if len(server.SelfIds()) != 0 {
+				t.Errorf("rejected bot registered: %v", server.SelfIds())
+			}
+		})
+	}
+
+	// token 正确时按 X-Self-ID 注册 bot
+	server := NewEventServer("secret")
+	httpServer := httptest.NewServer(http.HandlerFunc(server.ServeWebSocket))
+	defer httpServer.Close()
+	defer server.Close()
+	header := http.Header{"X-Self-ID": {"10001"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"?access_token=secret", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, ok := server.Bot("10001"); !ok {
+		t.Error("bot 10001 not registered")
+	}
+}
@@ -0,0 +1,66 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxForwardDepth 合并转发最多展开的层数，顶层转发为第1层
+const maxForwardDepth = 5
+
+// fetchForwardMessages 获取合并转发中的消息
+// 嵌套转发的内容通常已随上层消息下发，没有时再通过收到消息的 bot 调用 get_forward_msg 获取
+func fetchForwardMessages(client *Client, msg *MessageList) ([]ReceiveMessage, error) {
+	if len(msg.Data.Content) > 0 {
+		return msg.Data.Content, nil
+	}
+	if client == nil {
+		return nil, ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTimeout)
+	defer cancel()
+	return client.GetForwardMsg(ctx, string(msg.Data.Id))
+}
+
+// archiveForward 归档一条合并转发中的消息，嵌套的转发保存在对应消息段的 Forward 中
+// client 为收到消息的 bot，depth 为当前转发所在层数，ancestors 为当前路径上已展开的转发ID，用于防止循环引用
+func archiveForward(client *Client, messages []ReceiveMessage, depth int, ancestors map[string]bool) []MessageView {
+	views := make([]MessageView, 0, len(messages))
+	for i := range messages {
+		inner := &messages[i]
+		inner.archiveSegments(client)
+		for j, msg := range inner.Message {
+			if msg.Type != FORWARD {
+				continue
+			}
+			// archiveSegments 为每条消息生成一一对应的消息段
+			segment := &inner.segments[j]
+			forwardId := string(msg.Data.Id)
+			switch {
+			case depth >= maxForwardDepth:
+				fmt.Printf("合并转发嵌套超过%d层，不再展开: %s\n", maxForwardDepth, forwardId)
+				segment.Truncated = true
+				continue
+			case forwardId != "" && ancestors[forwardId]:
+				fmt.Printf("合并转发存在循环引用，不再展开: %s\n", forwardId)
+				segment.Truncated = true
+				continue
+			}
+
+			nested, err := fetchForwardMessages(client, &msg)
+			if err != nil {
+				fmt.Printf("获取嵌套合并转发失败 %s: %v\n", forwardId, err)
+				segment.Truncated = true
+				continue
+			}
+			if forwardId != "" {
+				ancestors[forwardId] = true
+			}
+			segment.Forward = archiveForward(client, nested, depth+1, ancestors)
+			delete(ancestors, forwardId)
+		}
+		views = append(views, inner.ToView())
+	}
+	return views
+}
@@ -5,6 +5,13 @@ go 1.24.2
 require (
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
+	snail.local/snailllllll/utils v0.0.0-00010101000000-000000000000
 )
 
-replace snail.local/snailllllll/utils => ../utils
\ No newline at end of file
+require (
+	github.com/joho/godotenv v1.5.1 // indirect
+	github.com/pelletier/go-toml/v2 v2.2.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace snail.local/snailllllll/utils => ../utils
@@ -0,0 +1,65 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"memento_backend/db"
+)
+
+// SyncGroupMembers 从所有在线的 bot 账号同步所在群的成员列表，用于判断群成员可见的记录
+// 多个账号在同一个群时重复同步不影响结果
+func SyncGroupMembers(ctx context.Context) error {
+	service := db.NewGroupMemberService()
+	registry := GetBotRegistry()
+	for _, selfId := range registry.SelfIds() {
+		client, ok := registry.Get(selfId)
+		if !ok || !client.IsConnected() {
+			continue
+		}
+		groups, err := client.GetGroupList(ctx, true)
+		if err != nil {
+			return fmt.Errorf("bot账号 %s 获取群列表失败: %w", selfId, err)
+		}
+		for _, group := range groups {
+			members, err := client.GetGroupMemberList(ctx, group.GroupId, true)
+			if err != nil {
+				// 单个群失败时保留原有成员，继续同步其他群
+				fmt.Printf("获取群 %d 成员失败: %v\n", group.GroupId, err)
+				continue
+			}
+			qqs := make([]string, 0, len(members))
+			for _, member := range members {
+				qqs = append(qqs, strconv.FormatInt(member.UserId, 10))
+			}
+			if err := service.ReplaceGroup(ctx, group.GroupId, qqs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 启动后首次同步前的等待时间，等待 bot 账号连接和注册
+const groupMemberSyncDelay = time.Minute
+
+// StartGroupMemberSync 定期同步群成员，ctx 取消时停止
+func StartGroupMemberSync(ctx context.Context, interval time.Duration) {
+	go func() {
+		next := time.NewTimer(groupMemberSyncDelay)
+		defer next.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-next.C:
+			}
+			if err := SyncGroupMembers(ctx); err != nil && ctx.Err() == nil {
+				fmt.Printf("同步群成员失败: %v\n", err)
+			}
+			next.Reset(interval)
+		}
+	}()
+}
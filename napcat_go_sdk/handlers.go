@@ -1,9 +1,17 @@
 package napcat_go_sdk
 
-
+import "fmt"
 
 type BaseHandler struct{}
 
 func (h *BaseHandler) HandleMessage(receiveMessage *ReceiveMessage) {
 	go receiveMessage.ParseMessage()
 }
+
+func (h *BaseHandler) OnConnect(client *WebSocketClient) {
+	fmt.Printf("NapCat WebSocket已连接\n")
+}
+
+func (h *BaseHandler) OnDisconnect(client *WebSocketClient, err error) {
+	fmt.Printf("NapCat WebSocket已断开: %v\n", err)
+}
@@ -2,25 +2,28 @@ package napcat_go_sdk
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
+	"strings"
+	"sync/atomic"
 )
 
+// HttpClient 通过 NapCat 的HTTP服务调用接口：POST {baseUrl}/{action}，请求体为参数
 type HttpClient struct {
-	url    string
-	token  *string
-	client *http.Client
+	baseUrl string
+	token   *string
+	client  *http.Client
+	pending atomic.Int64
 }
 
-func NewHttpClient(url string, token *string) *HttpClient {
+func NewHttpClient(baseUrl string, token *string) *HttpClient {
 	return &HttpClient{
-		url:    url,
-		token:  token,
-		client: &http.Client{},
+		baseUrl: strings.TrimRight(baseUrl, "/"),
+		token:   token,
+		client:  &http.Client{},
 	}
 }
 
@@ -38,44 +41,56 @@ func (h *HttpResponse[T]) ReceiveResponseMessage(bytes []byte) error {
 	return json.Unmarshal(bytes, h)
 }
 
-func (msg *Message[any]) SendHttpMsg() interface{} {
-	return msg.Params
-}
+// Send 调用接口并返回响应体，ctx 取消或到期时立即返回
+func (c *HttpClient) Send(ctx context.Context, action Action, params any) ([]byte, error) {
+	c.pending.Add(1)
+	defer c.pending.Add(-1)
 
-func (c *HttpClient) SendMessage(message SendMsg, receiveMessage ReceiveResponseMessage) error {
-	marshal, err := json.Marshal(message.SendHttpMsg())
+	if params == nil {
+		params = struct{}{}
+	}
+	marshal, err := json.Marshal(params)
 	if err != nil {
-		log.Fatal(err)
-		return err
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseUrl+"/"+string(action), bytes.NewReader(marshal))
+	if err != nil {
+		return nil, err
 	}
-	req, err := http.NewRequest("POST", c.url, bytes.NewBuffer(marshal))
-
 	req.Header.Set("Content-Type", "application/json")
-	if c.token != nil {
+	if c.token != nil && *c.token != "" {
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", *c.token))
 	}
 
-	do, err := c.client.Do(req)
+	resp, err := c.client.Do(req)
 	if err != nil {
-		log.Fatal(err)
-		return err
+		return nil, fmt.Errorf("%s: %w", action, err)
 	}
-	defer func(Body io.ReadCloser) {
-		err = Body.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}(do.Body)
+	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(do.Body)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatal(err)
-		return err
+		return nil, fmt.Errorf("%s: %w", action, err)
 	}
-
-	err = receiveMessage.ReceiveResponseMessage(body)
-	if err != nil {
-		return err
+	// 接口失败时 NapCat 仍会返回带 retcode 的响应体，交给调用方检查
+	if resp.StatusCode != http.StatusOK && !json.Valid(body) {
+		return nil, fmt.Errorf("%s: unexpected status %s", action, resp.Status)
 	}
+	return body, nil
+}
+
+// IsConnected HTTP 没有连接状态，总是返回 true
+func (c *HttpClient) IsConnected() bool {
+	return true
+}
+
+// PendingRequests 还未返回的请求数量
+func (c *HttpClient) PendingRequests() int {
+	return int(c.pending.Load())
+}
+
+// Close 关闭空闲连接
+func (c *HttpClient) Close() error {
+	c.client.CloseIdleConnections()
 	return nil
 }
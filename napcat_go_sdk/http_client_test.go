@@ -0,0 +1,37 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHttpClientCall(t *testing.T) {
+	server, request, params := newNapCatServer(t, http.StatusOK,
+		`{"status":"ok","retcode":0,"data":[{"group_id":100,"group_name":"测试群"}]}`)
+	token := "secret"
+	client := NewClient(NewHttpClient(server.URL+"/", &token))
+
+	groups, err := client.GetGroupList(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].GroupId != 100 {
+		t.Errorf("groups = %+v", groups)
+	}
+
+	if request.Method != http.MethodPost || request.URL.Path != "/get_group_list" {
+		t.Errorf("request = %s %s", request.Method, request.URL.Path)
+	}
+	if got := request.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := request.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(*params, &body); err != nil || body["no_cache"] != true {
+		t.Errorf("body = %s", *params)
+	}
+}
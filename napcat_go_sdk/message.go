@@ -155,6 +155,11 @@ type ReceiveMessage struct {
 		SourceType       int         `json:"sourceType"`
 		Id               int         `json:"id"`
 	} `json:"raw"`
+	// Replayed 重连后通过历史消息补发的消息，可能已经过去较长时间
+	// 补发的消息只交给 HandleMessage 归档，执行命令或回复的处理器应当跳过
+	Replayed bool `json:"-" bson:"-"`
+	// segments ParseMessage 生成的结构化消息段，不参与序列化
+	segments []Segment
 }
 
 type MsgType string
@@ -170,6 +175,10 @@ const (
 	DICE   MsgType = "dice"
 	RPS    MsgType = "rps"
 	NODE   MsgType = "node"
+	FILE   MsgType = "file"
+	// 商城表情
+	MFACE   MsgType = "mface"
+	FORWARD MsgType = "forward"
 )
 
 type Action string
@@ -193,7 +202,52 @@ const (
 	GET_IMAGE Action = "get_image"
 	// 获取合并转发消息
 	GET_FORWARD_MESSAGE Action = "get_forward_msg"
-
+	// 获取语音
+	GET_RECORD Action = "get_record"
+	// 获取文件（视频、群文件、私聊文件）
+	GET_FILE Action = "get_file"
+	// 获取消息详情
+	GET_MSG Action = "get_msg"
+	// 获取群历史消息
+	GET_GROUP_MSG_HISTORY Action = "get_group_msg_history"
+	// 获取私聊历史消息
+	GET_FRIEND_MSG_HISTORY Action = "get_friend_msg_history"
+	// 获取登录号信息
+	GET_LOGIN_INFO Action = "get_login_info"
+	// 获取陌生人信息
+	GET_STRANGER_INFO Action = "get_stranger_info"
+	// 获取好友列表
+	GET_FRIEND_LIST Action = "get_friend_list"
+	// 获取群信息
+	GET_GROUP_INFO Action = "get_group_info"
+	// 获取群列表
+	GET_GROUP_LIST Action = "get_group_list"
+	// 获取群成员信息
+	GET_GROUP_MEMBER_INFO Action = "get_group_member_info"
+	// 获取群成员列表
+	GET_GROUP_MEMBER_LIST Action = "get_group_member_list"
+	// 群禁言，duration 为0时解除
+	SET_GROUP_BAN Action = "set_group_ban"
+	// 全员禁言
+	SET_GROUP_WHOLE_BAN Action = "set_group_whole_ban"
+	// 踢出群成员
+	SET_GROUP_KICK Action = "set_group_kick"
+	// 设置群名片
+	SET_GROUP_CARD Action = "set_group_card"
+	// 设置群名
+	SET_GROUP_NAME Action = "set_group_name"
+	// 设置精华消息
+	SET_ESSENCE_MSG Action = "set_essence_msg"
+	// 移出精华消息
+	DELETE_ESSENCE_MSG Action = "delete_essence_msg"
+	// 获取精华消息列表
+	GET_ESSENCE_MSG_LIST Action = "get_essence_msg_list"
+	// 点赞
+	SEND_LIKE Action = "send_like"
+	// 获取运行状态
+	GET_STATUS Action = "get_status"
+	// 获取版本信息
+	GET_VERSION_INFO Action = "get_version_info"
 )
 
 type MessageFrom string
@@ -219,7 +273,7 @@ type MsgData struct {
 	UserId   *string `json:"user_id"`
 	NickName *string `json:"nickname"`
 	Content  []Msg   `json:"content"`
-	Url 	 *string `json:"url"`
+	Url      *string `json:"url"`
 	FileSize *string `json:"file_size"`
 }
 
@@ -442,11 +496,17 @@ type MessageList struct {
 	Type MsgType `json:"type"`
 	Data struct {
 		Text     string           `json:"text"`
-		Id       string           `json:"id"`
+		Id       FlexString       `json:"id"`
 		File     string           `json:"file"`
 		Content  []ReceiveMessage `json:"content"`
 		Url      string           `json:"url"`
-		FileSize string           `json:"file_size"`
+		FileSize FlexString       `json:"file_size"`
+		FileId   string           `json:"file_id"`
+		Path     string           `json:"path"`
+		Name     string           `json:"name"`
+		Summary  string           `json:"summary"`
+		Qq       FlexString       `json:"qq"`
+		Result   FlexString       `json:"result"`
 	} `json:"data"`
 }
 
@@ -458,5 +518,6 @@ type MessageView struct {
 		Nickname string `json:"nickname"`
 		Card     string `json:"card"`
 	} `json:"sender"`
-	RawMessage string `json:"raw_message"`
+	RawMessage string    `json:"raw_message"`
+	Segments   []Segment `json:"segments" bson:"segments,omitempty"`
 }
@@ -1,12 +1,13 @@
 package napcat_go_sdk
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
+	"strconv"
 	"time"
 
 	"memento_backend/db"
@@ -19,73 +20,115 @@ import (
 var ForwardMessages [][]ReceiveMessage
 var ForwardMessagesView [][]MessageView
 
-type ForwardResponse struct {
-	Status  string `json:"status"`
-	Retcode int    `json:"retcode"`
-	Data    struct {
-		Messages []ReceiveMessage `json:"messages"`
-	} `json:"data"`
-}
-
 func (receiveMessage *ReceiveMessage) ToView() MessageView {
 	return MessageView{
 		Time:        receiveMessage.Time,
 		MessageType: receiveMessage.MessageType,
 		Sender:      receiveMessage.Sender,
 		RawMessage:  receiveMessage.RawMessage,
+		Segments:    receiveMessage.segments,
+	}
+}
+
+// mediaSource 记录媒体文件来源消息
+func (receiveMessage *ReceiveMessage) mediaSource(url string) db.MediaSource {
+	source := db.MediaSource{
+		MessageId: int64(receiveMessage.MessageId),
+		SenderId:  int64(receiveMessage.Sender.UserId),
+		URL:       url,
+	}
+	if receiveMessage.GroupId != nil {
+		source.GroupId = int64(*receiveMessage.GroupId)
+	}
+	return source
+}
+
+// groupId 来源群号，私聊消息返回0
+func (receiveMessage *ReceiveMessage) groupId() int64 {
+	if receiveMessage.GroupId == nil {
+		return 0
+	}
+	return int64(*receiveMessage.GroupId)
+}
+
+// receiverClient 返回收到消息的 bot，未注册时使用全局客户端
+func (receiveMessage *ReceiveMessage) receiverClient() *Client {
+	if client, err := GetBot(strconv.Itoa(receiveMessage.SelfId)); err == nil {
+		return client
 	}
+	client, _ := GetClient()
+	return client
 }
+
 func (receiveMessage *ReceiveMessage) ISSenderBot() bool {
-	// 过滤bot发送的信息和心跳包
-	return receiveMessage.SelfId == receiveMessage.Sender.UserId || receiveMessage.MetaEventType == "heartbeat"
+	// 过滤bot发送的信息和心跳包，包括同一个群里其他 bot 账号发送的通知
+	if receiveMessage.SelfId == receiveMessage.Sender.UserId || receiveMessage.MetaEventType == "heartbeat" {
+		return true
+	}
+	_, err := GetBot(strconv.Itoa(receiveMessage.Sender.UserId))
+	return err == nil
+}
+
+// claimArchive 多个 bot 在同一个群里时同一条消息会被每个 bot 收到，只由最先收到的 bot 归档
+// 不同账号收到的 message_id 不同，按群号、发送人、时间和内容识别同一条消息
+// 没有合并转发和需要保存的媒体的消息不需要归档，也不占用锁
+func (receiveMessage *ReceiveMessage) claimArchive() bool {
+	if !receiveMessage.needsArchive() {
+		return false
+	}
+	if receiveMessage.GroupId == nil {
+		return true
+	}
+	digest := sha1.Sum([]byte(receiveMessage.RawMessage))
+	key := fmt.Sprintf("archive:%d:%d:%d:%s", *receiveMessage.GroupId, receiveMessage.Sender.UserId, receiveMessage.Time, hex.EncodeToString(digest[:]))
+	if _, err := utils.TryLock(key, 10*time.Minute); err != nil {
+		if errors.Is(err, utils.ErrLocked) {
+			return false
+		}
+		// 锁不可用时宁可重复归档
+		fmt.Printf("获取归档锁失败: %v\n", err)
+	}
+	return true
 }
 func (receiveMessage *ReceiveMessage) ParseMessage() {
 	// 解析消息：存储图片和表情
-	if receiveMessage.ISSenderBot() {
+	if receiveMessage.MetaEventType == "heartbeat" {
+		return
+	}
+	// 所有消息都生成结构化消息段，包括 bot 发送的消息；只有其他用户的消息会保存媒体和合并转发
+	receiveMessage.buildSegments()
+	if receiveMessage.ISSenderBot() || !receiveMessage.claimArchive() {
 		return
 	}
 
-	//fmt.Printf("原始文本: %v\n", receiveMessage.RawMessage)
-	// 遍历receiveMessage.Message
-	//
-	for _, msg := range receiveMessage.Message {
+	// 媒体和合并转发只能通过收到消息的 bot 获取
+	client := receiveMessage.receiverClient()
+
+	// 保存图片、语音、视频和文件，生成结构化消息段
+	receiveMessage.archiveSegments(client)
+
+	for i := range receiveMessage.Message {
+		msg := &receiveMessage.Message[i]
 		fmt.Printf("消息类型: %v\n", msg.Type)
-		if msg.Type == "image" {
-			//fmt.Printf("消息内容: %v\n", msg.Data)
-			// 获取图片真实url
-			url := msg.Data.Url
-			filename := msg.Data.File
-			// 从 url 下载filename的图片
-			err := utils.DownloadImageFromURL(url, filename)
+		// 处理合并转发消息，嵌套的转发作为消息段保存在同一条记录中
+		if msg.Type == FORWARD {
+			messages, err := fetchForwardMessages(client, msg)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Printf("获取合并转发失败: %v\n", err)
 				continue
 			}
-		}
-		// 处理合并转发消息
-		// 解析转发消息中的图片
-		if msg.Type == "forward" {
-			msg_id := msg.Data.Id
-			send_msg := Message[any]{
-				Action: GET_FORWARD_MESSAGE,
-				Params: MessageId{MessageId: msg_id},
-			}
-			response, _ := wsClientInstance.SendMessage(send_msg)
-			var forward_response ForwardResponse
-			err := json.Unmarshal([]byte(response), &forward_response)
-			if err != nil {
-				fmt.Printf("解析JSON失败: %v", err)
-				continue
+			origin_message_record, _ := SaveReceiveMessagesToDB(messages)
+			ancestors := map[string]bool{string(msg.Data.Id): true}
+			forward_views := archiveForward(client, messages, 1, ancestors)
+			view_record, err := SaveMessageViewsToDB(forward_views, int64(receiveMessage.SelfId), receiveMessage.groupId())
+			if err == nil {
+				forwardsArchived.Inc()
 			}
-			var forward_views []MessageView
-			origin_message_record, _ := SaveReceiveMessagesToDB(forward_response.Data.Messages)
-			for _, msg := range forward_response.Data.Messages {
-				msg.ParseMessage()
-				forward_views = append(forward_views, msg.ToView())
+			// 保存消息记录发送人，上传者一定是来源群的成员
+			InsertSender(view_record, receiveMessage.Sender.Nickname, strconv.Itoa(receiveMessage.Sender.UserId))
+			if err := db.NewGroupMemberService().Add(context.Background(), receiveMessage.groupId(), strconv.Itoa(receiveMessage.Sender.UserId)); err != nil {
+				fmt.Printf("记录群成员失败: %v\n", err)
 			}
-			view_record, _ := SaveMessageViewsToDB(forward_views)
-			// 保存消息记录发送人 
-			InsertSender(view_record,receiveMessage.Sender.Nickname)
 			// 保存消息和视图的关联关系
 			collection := db.Collection("message_db", "message_relations")
 			doc := map[string]interface{}{
@@ -98,20 +141,25 @@ func (receiveMessage *ReceiveMessage) ParseMessage() {
 				log.Printf("保存消息关联关系失败: %v", err)
 			}
 
-			// 生成标题
-			go ProcessForwardViewsToDB(view_record)
+			// 添加标题生成任务
+			EnqueueTitleJob(view_record)
 		}
 	}
 
 }
 
-// 保存消息视图切片到数据库
-func SaveMessageViewsToDB(messageViews []MessageView) (string, error) {
+// 保存消息视图切片到数据库，selfId 为收到这条记录的 bot 账号，groupId 为来源群，私聊时为0
+func SaveMessageViewsToDB(messageViews []MessageView, selfId int64, groupId int64) (string, error) {
 	collection := db.Collection("message_db", "forward_views")
-	// 将整个切片作为单个文档插入
+	// 将整个切片作为单个文档插入，创建时间使用 _id 中的时间戳
 	doc := map[string]interface{}{
-		"messages": messageViews,
-		"count":    len(messageViews),
+		"messages":   messageViews,
+		"count":      len(messageViews),
+		"self_id":    selfId,
+		"visibility": db.VisibilityMembers,
+	}
+	if groupId != 0 {
+		doc["group_id"] = groupId
 	}
 	result, err := collection.InsertOne(context.Background(), doc)
 	if err != nil {
@@ -148,8 +196,8 @@ func toInterfaceSlice[T any](slice []T) []interface{} {
 	return result
 }
 
-//向MessageViews注入发送人信息
-func InsertSender(forward_id string, sender string) {
+// 向MessageViews注入发送人信息，owner 为上传者QQ号，用于权限判断
+func InsertSender(forward_id string, sender string, owner string) {
 	// 获取forward_views数据
 	collection := db.Collection("message_db", "forward_views")
 	var fv ForwardView
@@ -165,69 +213,64 @@ func InsertSender(forward_id string, sender string) {
 	}
 
 	// 更新数据库中的sender
-	update := bson.M{"$set": bson.M{"sender": sender}}
+	update := bson.M{"$set": bson.M{"sender": sender, "owner": owner}}
 	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
 	if err != nil {
 		fmt.Printf("failed to update forward view sender: %v", err)
 		return
 	}
 	fmt.Printf("更新sender成功: %v", sender)
+
+	// 更新检索索引
+	if err := db.NewSearchService().IndexForwardView(context.Background(), forward_id); err != nil {
+		fmt.Printf("更新检索索引失败: %v\n", err)
+	}
 }
 
 // 提取MessageViews的消息并转换为json，生成幽默标题并更新到数据库
-func ProcessForwardViewsToDB(forward_id string) (string, error) {
+// ctx 取消时（如任务超时或进程退出）停止生成，由任务队列稍后重试
+func ProcessForwardViewsToDB(ctx context.Context, forward_id string) (string, error) {
 
 	// 获取forward_views数据
 	collection := db.Collection("message_db", "forward_views")
-	var forwardView bson.M
+	var forwardView struct {
+		Messages   []MessageView `bson:"messages"`
+		Sender     string        `bson:"sender"`
+		Visibility db.Visibility `bson:"visibility"`
+	}
 	id, err := primitive.ObjectIDFromHex(forward_id)
 	if err != nil {
 		return "", fmt.Errorf("invalid forward ID")
 	}
 
-	if err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&forwardView); err != nil {
+	if err := collection.FindOne(ctx, bson.M{"_id": id}).Decode(&forwardView); err != nil {
 		return "", fmt.Errorf("forward view not found")
 	}
 
-	// 将forward_views转换为JSON并发送到API
-	jsonData, err := json.Marshal(forwardView)
+	// 生成标题，配置的生成器失败时自动尝试下一个，每个生成器单独计算超时
+	title, err := GetTitleGenerator().GenerateTitle(ctx, forwardView.Messages)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal forward view")
-	}
-    // TODO：发送请求到API，url 从配置文件中读取
-	resp, err := http.Post("http://14.103.138.175:8888/api/qq-humor-title", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to send request to humor title API")
-	}
-	defer resp.Body.Close()
-
-	// 解析API响应
-	var result struct {
-		Success bool   `json:"success"`
-		Title   string `json:"title"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode API response")
-	}
-
-	if !result.Success {
-		return "", fmt.Errorf("humor title API returned failure")
+		return "", fmt.Errorf("failed to generate title: %v", err)
 	}
 
 	// 更新数据库中的title
-	update := bson.M{"$set": bson.M{"title": result.Title}}
-	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	update := bson.M{"$set": bson.M{"title": title}}
+	_, err = collection.UpdateOne(ctx, bson.M{"_id": id}, update)
 	if err != nil {
 		return "", fmt.Errorf("failed to update forward view title")
 	}
 
-	senderStr, ok := forwardView["sender"].(string)
-	if !ok {
-		senderStr = ""
+	// 标题变化后更新检索索引
+	if err := db.NewSearchService().IndexForwardView(ctx, forward_id); err != nil {
+		fmt.Printf("更新检索索引失败: %v\n", err)
+	}
+
+	// 私有记录不在群内通知，避免泄露标题
+	if forwardView.Visibility != db.VisibilityPrivate {
+		groupStr := utils.Config.NapCat.InformGroup
+		NewMessageGroupInform(&title, &forwardView.Sender, &groupStr, &forward_id)
 	}
-	groupStr  := utils.GetConfig("INFORM_GROUP", "")
-	NewMessageGroupInform(&result.Title, &senderStr, &groupStr, &forward_id)
-	return result.Title, nil
+	return title, nil
 }
 
 // ForwardView 定义转发视图结构
@@ -236,7 +279,8 @@ type ForwardView struct {
 	Title string             `bson:"title"`
 }
 
-// ProcessEmptyTitleForwardViews 处理所有title为空的forward_views
+// ProcessEmptyTitleForwardViews 为所有title为空的forward_views添加标题生成任务
+// 单条记录失败不影响其他记录，失败的任务由任务队列重试
 func ProcessEmptyTitleForwardViews() error {
 	// 初始化collection
 	fmt.Printf("开始更新title=====================================================\n")
@@ -251,20 +295,21 @@ func ProcessEmptyTitleForwardViews() error {
 	if err != nil {
 		return fmt.Errorf("failed to find forward views with empty title")
 	}
-	fmt.Printf("Found %d forward views with empty title\n", cursor.RemainingBatchLength())
 	defer cursor.Close(context.Background())
 
 	// 遍历处理每个forward_view
+	enqueued := 0
 	for cursor.Next(context.Background()) {
 		var fv ForwardView
 		if err := cursor.Decode(&fv); err != nil {
-			return fmt.Errorf("failed to decode forward view")
+			fmt.Printf("failed to decode forward view: %v\n", err)
+			continue
 		}
-		fmt.Printf("Processing forward view %s\n", fv.ID.Hex())
-		if _, err := ProcessForwardViewsToDB(fv.ID.Hex()); err != nil {
-			return fmt.Errorf("failed to process forward view: %v", err)
+		if _, created, err := EnqueueTitleJob(fv.ID.Hex()); err == nil && created {
+			enqueued++
 		}
 	}
+	fmt.Printf("Enqueued %d title jobs for forward views with empty title\n", enqueued)
 
 	if err := cursor.Err(); err != nil {
 		return fmt.Errorf("cursor error: %v", err)
@@ -0,0 +1,33 @@
+package napcat_go_sdk
+
+import "snail.local/snailllllll/utils"
+
+var (
+	forwardsArchived = utils.NewCounter("memento_forwards_archived_total", "已归档的合并转发数量")
+	mediaDownloaded  = utils.NewCounter("memento_media_downloaded_total", "下载并保存的媒体文件数量，type 为 image、record、video、file", "type", "result")
+	titleGenerations = utils.NewCounter("memento_title_generations_total", "标题生成次数", "result")
+)
+
+func init() {
+	utils.NewGaugeFunc("memento_napcat_connected", "NapCat 是否已连接", func() float64 {
+		if client, err := GetClient(); err == nil && client.IsConnected() {
+			return 1
+		}
+		return 0
+	})
+	utils.NewGaugeFunc("memento_napcat_pending_requests", "等待 NapCat 响应的请求数量", func() float64 {
+		client, err := GetClient()
+		if err != nil {
+			return 0
+		}
+		return float64(client.PendingRequests())
+	})
+}
+
+// metricResult 计数器中 result 标签的值
+func metricResult(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
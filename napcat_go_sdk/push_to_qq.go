@@ -106,48 +106,44 @@ func PushMessageViewToQQ(forward_id string) error {
 
 	Send_forward_message_to_group(result.Messages, title)
 	return nil
-	return nil
 }
 
 func prasemessages(result []ReceiveMessage) {
 	var api_host, port, pic_host string
-	api_host = utils.GetConfig("API_HOST", "")
-	port = utils.GetConfig("PORT", "")
+	api_host = utils.Config.Server.APIHost
+	port = utils.Config.Server.Port
 	pic_host = fmt.Sprintf("http://%s:%s/pic/", api_host, port)
 	// 遍历ReceiveMessage，将图片消息的Url替换为翻旧账地址
 	for i := range result {
 		for j := range result[i].Message {
 			msg := &result[i].Message[j]
 			if msg.Type == "image" {
-				msg.Data.Url = pic_host + msg.Data.File
+				// 图片只对有权限的用户开放，推送时附带临时签名供 NapCat 下载
+				msg.Data.Url = pic_host + msg.Data.File + "?" + utils.SignMediaQuery(msg.Data.File, time.Hour)
 			}
 		}
 	}
 }
 func Send_forward_message_to_group(result []ReceiveMessage, title string) {
-	ws, _ := GetExistWSClient()
-	group := utils.GetConfig("INFORM_GROUP", "")
+	client, _ := GetClient()
+	group := utils.Config.NapCat.InformGroup
 	promt := "翻旧账推送"
 	summary := "summary"
 	source := title
-	send_forward_message(result, group, promt, summary, source, ws)
+	send_forward_message(result, group, promt, summary, source, client)
 
 }
-func send_forward_message(result []ReceiveMessage, group, promt, summary, source string, ws *WebSocketClient) {
-	msg := Message[any]{
-		Action: "send_forward_msg",
-		Params: ForwardMsgContent{
-			UserGroupId: UserGroupId{GroupId: &group},
-			Messages:    convertToNodeMsgList(result),
-			News: []struct {
-				Text *string `json:"text"`
-			}{}, // 初始化为空切片
-			Prompt:  promt,   // 新增字段
-			Summary: summary, // 新增字段
-			Source:  source,  // 新增字段
-		},
-	}
-	ws.SendMessage(msg)
+func send_forward_message(result []ReceiveMessage, group, promt, summary, source string, client *Client) {
+	sendAction(client, "send_forward_msg", ForwardMsgContent{
+		UserGroupId: UserGroupId{GroupId: &group},
+		Messages:    convertToNodeMsgList(result),
+		News: []struct {
+			Text *string `json:"text"`
+		}{}, // 初始化为空切片
+		Prompt:  promt,   // 新增字段
+		Summary: summary, // 新增字段
+		Source:  source,  // 新增字段
+	})
 }
 
 // 将ReceiveMessage转换为节点消息
@@ -178,7 +174,7 @@ func convertMessageListToMsg(messageList []MessageList) []Msg {
 				Text:     &msgItem.Data.Text,
 				File:     &msgItem.Data.File,
 				Url:      &msgItem.Data.Url,
-				FileSize: &msgItem.Data.FileSize,
+				FileSize: (*string)(&msgItem.Data.FileSize),
 			},
 		}
 		//fmt.Println(msgItem.Data.Url)
@@ -1,41 +1,53 @@
 package napcat_go_sdk
 
 import (
+	"errors"
 	"fmt"
-	"time"
 
 	"snail.local/snailllllll/utils"
 )
 
-func Rebuild_title(id string, username string) error {
-	lockKey := "rebuild_title_" + id
+// rebuildTitleLockKey 重命名锁的键
+func rebuildTitleLockKey(id string) string {
+	return "rebuild_title_" + id
+}
 
-	// 检查锁是否存在
-	if utils.LockExists(lockKey) {
-		return fmt.Errorf("对话 %s 的重命名任务已在进行中，请耐心等待", id)
-	}
+// Rebuild_title 发起重命名，返回标题生成任务的ID
+func Rebuild_title(id string, username string) (string, error) {
+	lockKey := rebuildTitleLockKey(id)
 
-	// 获取锁
-	utils.SetLock(lockKey, 300*time.Second)
+	// 原子性的获取锁，任务结束时由任务处理函数凭 token 释放
+	lockToken, err := utils.TryLock(lockKey, rebuildTitleLockTTL)
+	if err != nil {
+		if errors.Is(err, utils.ErrLocked) {
+			return "", fmt.Errorf("对话 %s 的重命名任务已在进行中，请耐心等待", id)
+		}
+		return "", fmt.Errorf("获取重命名锁失败: %v", err)
+	}
 
-	// 使用goroutine异步执行重命名
-	go func() {
-		// 确保在goroutine结束时释放锁
-		defer utils.DeleteLock(lockKey)
+	// 使用GetMessageViewTitle方法获取title
+	title, err := GetMessageViewTitle(id)
+	if err != nil {
+		utils.DeleteLock(lockKey, lockToken)
+		return "", fmt.Errorf("获取对话标题失败: %v", err)
+	}
 
-		// 使用GetMessageViewTitle方法获取title
-		title, err := GetMessageViewTitle(id)
-		if err != nil {
-			// 记录错误但不影响锁的释放
-			fmt.Printf("获取对话标题失败: %v\n", err)
-			return
-		}
+	// 添加到任务队列，进程重启后仍会继续执行
+	jobId, created, err := enqueueTitleJob(id, lockToken)
+	if err != nil {
+		utils.DeleteLock(lockKey, lockToken)
+		return "", fmt.Errorf("添加重命名任务失败: %v", err)
+	}
+	if !created {
+		// 已有的任务不持有本次的锁，由任务去重保证不会重复生成
+		utils.DeleteLock(lockKey, lockToken)
+		return jobId, fmt.Errorf("对话 %s 的重命名任务已在进行中，请耐心等待", id)
+	}
 
-		// 执行重命名操作
-		RebuildTitleInform(&title, &utils.Config.InformGroup, &username)
-		ProcessForwardViewsToDB(id)
-	}()
+	// 群通知可能较慢，不阻塞请求
+	group := utils.Config.NapCat.InformGroup
+	go RebuildTitleInform(&title, &group, &username)
 
 	// 立即返回成功发起消息
-	return nil
+	return jobId, nil
 }
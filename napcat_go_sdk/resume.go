@@ -0,0 +1,108 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// 重连后每个群补拉的历史消息条数
+	resumeHistoryCount = 50
+	// 记录最近分发的消息ID数量，用于补发时去重
+	resumeSeenSize = 1024
+	// 补发的总超时时间
+	resumeTimeout = 2 * time.Minute
+)
+
+// eventCursor 记录最近分发的消息，重连后只补发断线之后的消息
+type eventCursor struct {
+	mu       sync.Mutex
+	lastTime int64
+	seen     map[string]struct{}
+	order    []string
+}
+
+// mark 记录一条消息，已经分发过时返回 false
+func (c *eventCursor) mark(frame *eventFrame) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if frame.Time > c.lastTime {
+		c.lastTime = frame.Time
+	}
+	id := string(frame.MessageId)
+	if id == "" {
+		return true
+	}
+	if c.seen == nil {
+		c.seen = make(map[string]struct{}, resumeSeenSize)
+	}
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+	c.seen[id] = struct{}{}
+	c.order = append(c.order, id)
+	if len(c.order) > resumeSeenSize {
+		delete(c.seen, c.order[0])
+		c.order = c.order[1:]
+	}
+	return true
+}
+
+// since 最后一条消息的时间，还没有收到过消息时为0
+func (c *eventCursor) since() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastTime
+}
+
+// rawMessageHistory 保留原始 JSON 的历史消息，补发时与实时上报走同一条分发流程
+type rawMessageHistory struct {
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// resume 重连后通过 get_group_msg_history 补发断线期间的群消息
+// 只补拉每个群最近 resumeHistoryCount 条，私聊消息和更早的消息不会补发
+func (client *WebSocketClient) resume() {
+	since := client.cursor.since()
+	if since == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resumeTimeout)
+	defer cancel()
+
+	groups, err := Call[NoCacheRequest, []GroupInfo](ctx, client, GET_GROUP_LIST, NoCacheRequest{})
+	if err != nil {
+		fmt.Printf("补发断线期间的消息失败: %v\n", err)
+		return
+	}
+
+	resumed := 0
+	for _, group := range groups {
+		request := GroupMsgHistoryRequest{GroupId: group.GroupId, Count: resumeHistoryCount}
+		history, err := Call[GroupMsgHistoryRequest, rawMessageHistory](ctx, client, GET_GROUP_MSG_HISTORY, request)
+		if err != nil {
+			fmt.Printf("获取群 %d 历史消息失败: %v\n", group.GroupId, err)
+			continue
+		}
+		for _, raw := range history.Messages {
+			var frame eventFrame
+			if err := json.Unmarshal(raw, &frame); err != nil || frame.Time < since {
+				continue
+			}
+			if frame.PostType == "" {
+				frame.PostType = POST_MESSAGE
+			}
+			if frame.PostType != POST_MESSAGE || !client.cursor.mark(&frame) {
+				continue
+			}
+			frame.Replayed = true
+			if err := dispatchEvent(client.Handler, client.Events, &frame, raw); err == nil {
+				resumed++
+			}
+		}
+	}
+	fmt.Printf("已检查断线期间的群消息，补发 %d 条\n", resumed)
+}
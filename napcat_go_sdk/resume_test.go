@@ -0,0 +1,83 @@
+package napcat_go_sdk
+
+import (
+	"testing"
+	"time"
+)
+
+// recordingHandler 记录收到的消息和按来源分发的消息事件
+type recordingHandler struct {
+	messages chan *ReceiveMessage
+	events   chan string
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{messages: make(chan *ReceiveMessage, 4), events: make(chan string, 4)}
+}
+
+func (h *recordingHandler) HandleMessage(message *ReceiveMessage) { h.messages <- message }
+func (h *recordingHandler) PrivateMessageEvent(*ReceiveMessage)   { h.events <- "private" }
+func (h *recordingHandler) GroupMessageEvent(*ReceiveMessage)     { h.events <- "group" }
+
+func TestDispatchReplayed(t *testing.T) {
+	raw := []byte(`{"post_type":"message","message_type":"group","message_id":1,"group_id":100,"raw_message":"/help"}`)
+
+	for _, replayed := range []bool{false, true} {
+		handler := newRecordingHandler()
+		router := NewEventRouter()
+		routed := make(chan struct{}, 1)
+		router.OnGroupMessage(func(*ReceiveMessage) { routed <- struct{}{} })
+
+		frame := &eventFrame{PostType: POST_MESSAGE, MessageType: "group", Replayed: replayed}
+		if err := dispatchEvent([]HandlerMessage{handler}, router, frame, raw); err != nil {
+			t.Fatal(err)
+		}
+
+		// 补发的消息仍然交给 HandleMessage 归档，并带有补发标记
+		select {
+		case message := <-handler.messages:
+			if message.Replayed != replayed {
+				t.Errorf("replayed=%v: message.Replayed = %v", replayed, message.Replayed)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("replayed=%v: HandleMessage not called", replayed)
+		}
+
+		// 只有实时消息触发消息事件和事件路由
+		wait := time.Second
+		if replayed {
+			wait = 50 * time.Millisecond
+		}
+		select {
+		case <-handler.events:
+			if replayed {
+				t.Error("replayed message dispatched to GroupMessageEvent")
+			}
+		case <-time.After(wait):
+			if !replayed {
+				t.Error("GroupMessageEvent not called")
+			}
+		}
+		select {
+		case <-routed:
+			if replayed {
+				t.Error("replayed message dispatched to the event router")
+			}
+		case <-time.After(wait):
+			if !replayed {
+				t.Error("event router not called")
+			}
+		}
+	}
+}
+
+func TestEventCursorMark(t *testing.T) {
+	var cursor eventCursor
+	first := &eventFrame{Time: 100, MessageId: "1"}
+	if !cursor.mark(first) || cursor.mark(first) {
+		t.Error("mark() should accept a message only once")
+	}
+	if !cursor.mark(&eventFrame{Time: 90, MessageId: "2"}) || cursor.since() != 100 {
+		t.Errorf("since() = %d, want 100", cursor.since())
+	}
+}
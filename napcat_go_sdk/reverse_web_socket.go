@@ -0,0 +1,81 @@
+package napcat_go_sdk
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// ReverseWebSocket 反向WebSocket：NapCat 主动连接本服务，接口调用和事件上报共用这一条连接
+// 作为 http.Handler 挂载到路由上，新的连接会替换旧连接；断开后由 NapCat 负责重连
+// 多个 bot 账号通过 EventServer 按 self_id 管理
+type ReverseWebSocket struct {
+	*WebSocketClient
+	token string
+}
+
+var upgrader = websocket.Upgrader{
+	// NapCat 不是浏览器，不检查 Origin
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func NewReverseWebSocket(token string) *ReverseWebSocket {
+	return &ReverseWebSocket{
+		WebSocketClient: &WebSocketClient{
+			Handler: make([]HandlerMessage, 0),
+			Events:  NewEventRouter(),
+			done:    make(chan struct{}),
+		},
+		token: token,
+	}
+}
+
+// ServeHTTP 校验 access token 后升级为 WebSocket，并持续读取直到连接断开
+func (reverse *ReverseWebSocket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !checkAccessToken(r, reverse.token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	reverse.serve(w, r)
+}
+
+// serve 升级为 WebSocket 并读取到连接断开，调用方负责鉴权
+func (reverse *ReverseWebSocket) serve(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-reverse.done:
+		http.Error(w, ErrClientClosed.Error(), http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade 已经写入了错误响应
+		fmt.Printf("反向WebSocket升级失败: %v\n", err)
+		return
+	}
+	fmt.Printf("NapCat 反向WebSocket已连接: %s (self_id=%s)\n", r.RemoteAddr, r.Header.Get("X-Self-ID"))
+	reverse.attach(conn)
+	reverse.notifyConnect()
+	go reverse.resume()
+
+	for reverse.currentConn() == conn {
+		_, _ = reverse.readFrom(conn)
+	}
+}
+
+// checkAccessToken 校验 Authorization: Bearer <token> 或 access_token 查询参数
+// 未配置 token 时拒绝所有请求，避免任何人都能冒充 NapCat 上报事件
+func checkAccessToken(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if got == "" {
+		got = r.URL.Query().Get("access_token")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
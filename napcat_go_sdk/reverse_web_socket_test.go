@@ -0,0 +1,20 @@
+package napcat_go_sdk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReverseWebSocketToken(t *testing.T) {
+	for _, token := range []string{"", "secret"} {
+		reverse := NewReverseWebSocket(token)
+		r := httptest.NewRequest(http.MethodGet, "/onebot/ws", nil)
+		r.Header.Set("Authorization", "Bearer wrong")
+		w := httptest.NewRecorder()
+		reverse.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, w.Code)
+		}
+	}
+}
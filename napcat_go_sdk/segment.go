@@ -0,0 +1,243 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"memento_backend/db"
+
+	"snail.local/snailllllll/utils"
+)
+
+// FlexString 兼容 NapCat 在不同版本中以数字或字符串上报的字段
+type FlexString string
+
+func (f *FlexString) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*f = FlexString(s)
+		return nil
+	}
+	if string(data) == "null" {
+		*f = ""
+		return nil
+	}
+	*f = FlexString(data)
+	return nil
+}
+
+// Segment 结构化的消息段，前端据此还原回复、@、语音等内容
+type Segment struct {
+	Type     MsgType `json:"type" bson:"type"`
+	Text     string  `json:"text,omitempty" bson:"text,omitempty"`         // text
+	FaceId   string  `json:"face_id,omitempty" bson:"face_id,omitempty"`   // face/mface 表情ID
+	ReplyTo  string  `json:"reply_to,omitempty" bson:"reply_to,omitempty"` // reply 被回复的消息ID
+	AtQQ     string  `json:"at_qq,omitempty" bson:"at_qq,omitempty"`       // at 对象QQ，all 表示全体成员
+	Result   string  `json:"result,omitempty" bson:"result,omitempty"`     // dice/rps 结果
+	Name     string  `json:"name,omitempty" bson:"name,omitempty"`         // file 文件名
+	Summary  string  `json:"summary,omitempty" bson:"summary,omitempty"`   // 图片/表情摘要
+	File     string  `json:"file,omitempty" bson:"file,omitempty"`         // QQ 提供的文件名
+	Url      string  `json:"url,omitempty" bson:"url,omitempty"`           // 原始URL，可能已过期
+	Size     int64   `json:"size,omitempty" bson:"size,omitempty"`         // 文件大小
+	Media    string  `json:"media,omitempty" bson:"media,omitempty"`       // 媒体存储key，可通过 /media/:key 访问
+	MimeType string  `json:"mime,omitempty" bson:"mime,omitempty"`
+
+	ForwardId string        `json:"forward_id,omitempty" bson:"forward_id,omitempty"` // forward 合并转发ID
+	Forward   []MessageView `json:"forward,omitempty" bson:"forward,omitempty"`       // forward 嵌套转发中的消息
+	Truncated bool          `json:"truncated,omitempty" bson:"truncated,omitempty"`   // forward 超过层数限制或获取失败，未展开
+}
+
+// ToSegment 转换为结构化消息段（不含媒体存储信息）
+func (msg *MessageList) ToSegment() Segment {
+	segment := Segment{Type: msg.Type}
+	switch msg.Type {
+	case TEXT:
+		segment.Text = msg.Data.Text
+	case FACE, MFACE:
+		segment.FaceId = string(msg.Data.Id)
+		segment.Summary = msg.Data.Summary
+		segment.Url = msg.Data.Url
+	case REPLY:
+		segment.ReplyTo = string(msg.Data.Id)
+	case AT:
+		segment.AtQQ = string(msg.Data.Qq)
+		segment.Text = msg.Data.Name
+	case DICE, RPS:
+		segment.Result = string(msg.Data.Result)
+	case IMAGE, RECORD, VIDEO, FILE:
+		segment.File = msg.Data.File
+		segment.Name = msg.Data.Name
+		segment.Summary = msg.Data.Summary
+		segment.Url = msg.Data.Url
+		segment.Size, _ = strconv.ParseInt(string(msg.Data.FileSize), 10, 64)
+	case FORWARD:
+		segment.ForwardId = string(msg.Data.Id)
+	}
+	return segment
+}
+
+// buildSegments 生成结构化消息段，不下载媒体
+func (receiveMessage *ReceiveMessage) buildSegments() {
+	segments := make([]Segment, 0, len(receiveMessage.Message))
+	for i := range receiveMessage.Message {
+		segments = append(segments, receiveMessage.Message[i].ToSegment())
+	}
+	receiveMessage.segments = segments
+}
+
+// archiveSegments 保存消息中的图片、语音、视频和文件，生成结构化消息段
+// client 为收到消息的 bot；单个媒体保存失败时仍保留消息段，只是没有媒体存储信息
+func (receiveMessage *ReceiveMessage) archiveSegments(client *Client) {
+	receiveMessage.buildSegments()
+	for i := range receiveMessage.Message {
+		msg := &receiveMessage.Message[i]
+		segment := &receiveMessage.segments[i]
+
+		switch msg.Type {
+		case IMAGE, RECORD, VIDEO, FILE:
+			if !shouldDownload(msg.Type, segment.Size) {
+				break
+			}
+			data, err := fetchSegmentMedia(client, msg)
+			if err != nil {
+				mediaDownloaded.Inc(string(msg.Type), metricResult(err))
+				fmt.Printf("获取%s消息段失败: %v\n", msg.Type, err)
+				break
+			}
+			// 群文件的 file 字段是内部ID，原始文件名在 name 中
+			filename := msg.Data.File
+			if msg.Type == FILE && msg.Data.Name != "" {
+				filename = msg.Data.Name
+			}
+			media, err := db.GetMediaService().Save(context.Background(), data, filename, receiveMessage.mediaSource(msg.Data.Url))
+			mediaDownloaded.Inc(string(msg.Type), metricResult(err))
+			if err != nil {
+				fmt.Printf("保存%s消息段失败: %v\n", msg.Type, err)
+				break
+			}
+			segment.Media = media.Key
+			segment.MimeType = media.MimeType
+			segment.Size = media.Size
+		}
+	}
+}
+
+// shouldDownload 按配置判断是否保存该类型的媒体，消息中已给出大小时提前排除过大的文件
+func shouldDownload(msgType MsgType, size int64) bool {
+	if !downloadEnabled(msgType) {
+		return false
+	}
+	if !withinMediaLimit(size) {
+		fmt.Printf("%s消息段大小 %d 超过上限，不保存\n", msgType, size)
+		return false
+	}
+	return true
+}
+
+// downloadEnabled 配置中是否保存该类型的媒体
+func downloadEnabled(msgType MsgType) bool {
+	for _, t := range utils.Config.Media.DownloadTypes() {
+		if MsgType(t) == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+// withinMediaLimit 文件大小是否在上限以内，大小未知时为0
+func withinMediaLimit(size int64) bool {
+	limit := utils.Config.Media.MaxBytes()
+	return limit <= 0 || size <= limit
+}
+
+// needsArchive 消息中是否有需要归档的内容：合并转发或按配置需要保存的媒体
+func (receiveMessage *ReceiveMessage) needsArchive() bool {
+	for i := range receiveMessage.Message {
+		msg := &receiveMessage.Message[i]
+		switch msg.Type {
+		case FORWARD:
+			return true
+		case IMAGE, RECORD, VIDEO, FILE:
+			if downloadEnabled(msg.Type) && withinMediaLimit(msg.ToSegment().Size) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fetchSegmentMedia 获取媒体消息段的文件内容，超过大小上限时返回 utils.ErrMediaTooLarge
+// 图片直接下载URL；语音通过 get_record 转为mp3；视频和文件优先下载URL，失败时通过 get_file 获取
+func fetchSegmentMedia(client *Client, msg *MessageList) ([]byte, error) {
+	limit := utils.Config.Media.MaxBytes()
+	if msg.Type == IMAGE || msg.Type == VIDEO {
+		if strings.HasPrefix(msg.Data.Url, "http") {
+			data, err := utils.DownloadBytesLimit(msg.Data.Url, limit)
+			if err == nil || msg.Type == IMAGE || errors.Is(err, utils.ErrMediaTooLarge) {
+				return data, err
+			}
+		}
+	}
+
+	if client == nil {
+		return nil, ErrNotConnected
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTimeout)
+	defer cancel()
+
+	var (
+		file FileInfo
+		err  error
+	)
+	switch msg.Type {
+	case RECORD:
+		file, err = client.GetRecord(ctx, msg.Data.File, "mp3")
+	case VIDEO, FILE:
+		request := GetFileRequest{File: msg.Data.File}
+		if msg.Data.FileId != "" {
+			request = GetFileRequest{FileId: msg.Data.FileId}
+		}
+		file, err = client.GetFile(ctx, request)
+	default:
+		return nil, fmt.Errorf("unsupported segment type: %s", msg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readMediaFileData(&file, limit)
+}
+
+// readMediaFileData 按 base64、URL、本地路径的顺序读取文件内容，limit 大于0时限制文件大小
+// 本地路径只在 NapCat 与本服务部署在同一台机器上时可用
+func readMediaFileData(data *FileInfo, limit int64) ([]byte, error) {
+	if size, err := strconv.ParseInt(string(data.FileSize), 10, 64); err == nil && limit > 0 && size > limit {
+		return nil, utils.ErrMediaTooLarge
+	}
+	if data.Base64 != "" {
+		if limit > 0 && int64(base64.StdEncoding.DecodedLen(len(data.Base64))) > limit+2 {
+			return nil, utils.ErrMediaTooLarge
+		}
+		return base64.StdEncoding.DecodeString(data.Base64)
+	}
+	if strings.HasPrefix(data.Url, "http") {
+		return utils.DownloadBytesLimit(data.Url, limit)
+	}
+	if data.File != "" {
+		if info, err := os.Stat(data.File); err == nil && limit > 0 && info.Size() > limit {
+			return nil, utils.ErrMediaTooLarge
+		}
+		if content, err := os.ReadFile(data.File); err == nil {
+			return content, nil
+		}
+	}
+	return nil, errors.New("no accessible file content in response")
+}
@@ -0,0 +1,41 @@
+package napcat_go_sdk
+
+import (
+	"testing"
+
+	"snail.local/snailllllll/utils"
+)
+
+func TestNeedsArchive(t *testing.T) {
+	old := utils.Config.Media
+	utils.Config.Media.Download = "image,file"
+	utils.Config.Media.MaxSize = 1
+	t.Cleanup(func() { utils.Config.Media = old })
+
+	segment := func(msgType MsgType, size string) MessageList {
+		var msg MessageList
+		msg.Type = msgType
+		msg.Data.File = "a"
+		msg.Data.FileSize = FlexString(size)
+		return msg
+	}
+	tests := []struct {
+		name     string
+		messages []MessageList
+		want     bool
+	}{
+		{"text", []MessageList{segment(TEXT, "")}, false},
+		{"forward", []MessageList{segment(TEXT, ""), segment(FORWARD, "")}, true},
+		{"image", []MessageList{segment(IMAGE, "1024")}, true},
+		{"image without size", []MessageList{segment(IMAGE, "")}, true},
+		// 未配置保存的类型和超过大小上限的文件不会下载
+		{"video not enabled", []MessageList{segment(VIDEO, "1024")}, false},
+		{"file too large", []MessageList{segment(FILE, "2097152")}, false},
+	}
+	for _, tt := range tests {
+		message := &ReceiveMessage{Message: tt.messages}
+		if got := message.needsArchive(); got != tt.want {
+			t.Errorf("%s: needsArchive() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
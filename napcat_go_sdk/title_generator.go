@@ -0,0 +1,322 @@
+package napcat_go_sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"snail.local/snailllllll/utils"
+)
+
+const (
+	// 标题最大长度（字符数）
+	maxTitleLength = 20
+	// 每个生成器单次生成的超时时间，推理模型通常较慢
+	titleTimeout = 3 * time.Minute
+)
+
+// TitleGenerator 聊天记录标题生成器
+type TitleGenerator interface {
+	// Name 生成器名称，用于配置和日志
+	Name() string
+	// GenerateTitle 根据聊天记录生成标题
+	GenerateTitle(ctx context.Context, views []MessageView) (string, error)
+}
+
+var (
+	titleGeneratorInstance TitleGenerator
+	titleGeneratorOnce     sync.Once
+)
+
+// GetTitleGenerator 返回根据配置创建的全局标题生成器
+func GetTitleGenerator() TitleGenerator {
+	titleGeneratorOnce.Do(func() {
+		titleGeneratorInstance = NewTitleGeneratorFromConfig()
+	})
+	return titleGeneratorInstance
+}
+
+// NewTitleGeneratorFromConfig 按 TITLE_GENERATORS 配置的顺序（逗号分隔）创建生成器链，
+// 前一个失败时依次尝试后一个；本地生成器始终作为最后的兜底
+func NewTitleGeneratorFromConfig() TitleGenerator {
+	var generators []TitleGenerator
+	hasLocal := false
+	for _, name := range utils.Config.Title.GeneratorNames() {
+		switch name {
+		case "openai":
+			if utils.Config.Title.LLMAPIKey == "" {
+				fmt.Printf("未配置LLM_APIKEY，跳过openai标题生成器\n")
+				continue
+			}
+			generators = append(generators, &OpenAITitleGenerator{
+				BaseURL: utils.Config.Title.LLMBaseURL,
+				APIKey:  utils.Config.Title.LLMAPIKey,
+				Model:   utils.Config.Title.LLMModel,
+			})
+		case "legacy":
+			if utils.Config.Title.APIURL == "" {
+				fmt.Printf("未配置TITLE_API_URL，跳过legacy标题生成器\n")
+				continue
+			}
+			generators = append(generators, &LegacyTitleGenerator{URL: utils.Config.Title.APIURL})
+		case "local":
+			generators = append(generators, &LocalTitleGenerator{})
+			hasLocal = true
+		default:
+			fmt.Printf("未知的标题生成器: %s\n", name)
+		}
+	}
+	if !hasLocal {
+		generators = append(generators, &LocalTitleGenerator{})
+	}
+	return &FallbackTitleGenerator{Generators: generators, Timeout: titleTimeout}
+}
+
+// FallbackTitleGenerator 依次尝试多个生成器，返回第一个成功的结果
+// 每个生成器单独计算超时，前一个超时不会占用后面生成器的时间
+type FallbackTitleGenerator struct {
+	Generators []TitleGenerator
+	Timeout    time.Duration // 每个生成器的超时时间，为0时只受调用方 ctx 限制
+}
+
+func (g *FallbackTitleGenerator) Name() string {
+	names := make([]string, len(g.Generators))
+	for i, generator := range g.Generators {
+		names[i] = generator.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (g *FallbackTitleGenerator) GenerateTitle(ctx context.Context, views []MessageView) (string, error) {
+	var errs []error
+	for _, generator := range g.Generators {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		title, err := g.generate(ctx, generator, views)
+		if err == nil && title != "" {
+			return title, nil
+		}
+		if err == nil {
+			err = errors.New("empty title")
+		}
+		fmt.Printf("标题生成器 %s 失败: %v\n", generator.Name(), err)
+		errs = append(errs, fmt.Errorf("%s: %w", generator.Name(), err))
+	}
+	return "", errors.Join(errs...)
+}
+
+// generate 使用单独的超时调用一个生成器
+func (g *FallbackTitleGenerator) generate(ctx context.Context, generator TitleGenerator, views []MessageView) (string, error) {
+	if g.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Timeout)
+		defer cancel()
+	}
+	return generator.GenerateTitle(ctx, views)
+}
+
+// humorPrompt 幽默标题生成 prompt 模板
+const humorPrompt = `你是一个擅长用幽默方式概括对话的助手。用户将提供一段JSON格式的对话数据，包含对话双方的内容。请执行以下任务：
+1. 分析对话的核心主题和笑点
+2. 生成一个不超过 20个字的标题
+3. 标题要求：
+ - 用谐音梗、双关语或网络热梗
+ - 突出对话中最荒诞/搞笑的部分
+ - 避免直白描述（如"关于XX的对话"），但是如果对话中包含🦐/虾姐/饭姐/曹姐/咩/新/公主等要素，可以突出这一元素的存在。
+
+输出格式：
+只需返回标题本身，不要包含任何解释、标点或额外文本。
+
+示例：
+输入：{"dialogue":[{"role":"A","content":"为什么用微波炉加热葡萄会冒火花？"},{"role":"B","content":"因为葡萄在蹦迪！"}]}
+输出：葡星撞地球
+
+现在处理以下JSON对话：
+{{user_dialogue}}
+`
+
+// dialogueLine prompt 中的一句对话
+type dialogueLine struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// buildDialogue 过滤图片和过期消息，提取有效对话
+func buildDialogue(views []MessageView) []dialogueLine {
+	dialogue := make([]dialogueLine, 0, len(views))
+	for _, view := range views {
+		if strings.HasPrefix(view.RawMessage, "[CQ:image") || strings.Contains(view.RawMessage, "已过期") {
+			continue
+		}
+		dialogue = append(dialogue, dialogueLine{Role: view.Sender.Nickname, Content: view.RawMessage})
+	}
+	return dialogue
+}
+
+// thinkPattern 推理模型输出中的思考过程
+var thinkPattern = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+// cleanTitle 去掉思考过程、引号和多余空白，并限制长度
+func cleanTitle(title string) string {
+	title = thinkPattern.ReplaceAllString(title, "")
+	title = strings.TrimSpace(strings.SplitN(strings.TrimSpace(title), "\n", 2)[0])
+	title = strings.TrimSpace(strings.Trim(title, "\"'“”「」《》【】"))
+	return truncateRunes(title, maxTitleLength)
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// postJSON 发送JSON请求并解析JSON响应
+func postJSON(ctx context.Context, url string, headers map[string]string, body, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %s: %s", resp.Status, data)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// OpenAITitleGenerator 调用 OpenAI 兼容的 chat completions 接口生成标题
+type OpenAITitleGenerator struct {
+	BaseURL string // 如 https://api-inference.modelscope.cn/v1/
+	APIKey  string
+	Model   string
+}
+
+func (g *OpenAITitleGenerator) Name() string {
+	return "openai"
+}
+
+func (g *OpenAITitleGenerator) GenerateTitle(ctx context.Context, views []MessageView) (string, error) {
+	dialogue, err := json.Marshal(map[string]interface{}{"dialogue": buildDialogue(views)})
+	if err != nil {
+		return "", err
+	}
+	prompt := strings.Replace(humorPrompt, "{{user_dialogue}}", string(dialogue), 1)
+
+	request := map[string]interface{}{
+		"model": g.Model,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+		"stream": false,
+	}
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	url := strings.TrimRight(g.BaseURL, "/") + "/chat/completions"
+	headers := map[string]string{"Authorization": "Bearer " + g.APIKey}
+	if err := postJSON(ctx, url, headers, request, &response); err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", errors.New("no choices in response")
+	}
+	return cleanTitle(response.Choices[0].Message.Content), nil
+}
+
+// LegacyTitleGenerator 调用原有的 ainame.py 幽默标题服务
+type LegacyTitleGenerator struct {
+	URL string
+}
+
+func (g *LegacyTitleGenerator) Name() string {
+	return "legacy"
+}
+
+func (g *LegacyTitleGenerator) GenerateTitle(ctx context.Context, views []MessageView) (string, error) {
+	// ainame.py 使用 MongoDB 文档中的字段名
+	type legacyMessage struct {
+		MessageType MessageFrom `json:"messagetype"`
+		RawMessage  string      `json:"rawmessage"`
+		Sender      struct {
+			Nickname string `json:"nickname"`
+			UserId   int    `json:"userid"`
+			Card     string `json:"card"`
+		} `json:"sender"`
+		Time int `json:"time"`
+	}
+	messages := make([]legacyMessage, len(views))
+	for i, view := range views {
+		messages[i].MessageType = view.MessageType
+		messages[i].RawMessage = view.RawMessage
+		messages[i].Sender.Nickname = view.Sender.Nickname
+		messages[i].Sender.UserId = view.Sender.UserId
+		messages[i].Sender.Card = view.Sender.Card
+		messages[i].Time = view.Time
+	}
+
+	var result struct {
+		Success bool   `json:"success"`
+		Title   string `json:"title"`
+		Error   string `json:"error"`
+	}
+	if err := postJSON(ctx, g.URL, nil, map[string]interface{}{"messages": messages}, &result); err != nil {
+		return "", err
+	}
+	if !result.Success {
+		return "", fmt.Errorf("humor title API returned failure: %s", result.Error)
+	}
+	return cleanTitle(result.Title), nil
+}
+
+// LocalTitleGenerator 不依赖外部服务，用第一条文本消息生成确定的标题
+type LocalTitleGenerator struct{}
+
+func (g *LocalTitleGenerator) Name() string {
+	return "local"
+}
+
+func (g *LocalTitleGenerator) GenerateTitle(ctx context.Context, views []MessageView) (string, error) {
+	if len(views) == 0 {
+		return "", errors.New("empty conversation")
+	}
+	for _, view := range views {
+		text := strings.Join(strings.Fields(utils.StripCQCode(view.RawMessage)), " ")
+		if text == "" {
+			continue
+		}
+		return truncateRunes(fmt.Sprintf("%s：%s", view.Sender.Nickname, text), maxTitleLength), nil
+	}
+	// 没有文本消息时使用发言人和消息数
+	return truncateRunes(fmt.Sprintf("%s的%d条消息", views[0].Sender.Nickname, len(views)), maxTitleLength), nil
+}
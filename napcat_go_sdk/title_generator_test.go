@@ -0,0 +1,153 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testView(nickname, raw string) MessageView {
+	var view MessageView
+	view.Sender.Nickname = nickname
+	view.RawMessage = raw
+	return view
+}
+
+func TestLocalTitleGenerator(t *testing.T) {
+	generator := &LocalTitleGenerator{}
+	tests := []struct {
+		name  string
+		views []MessageView
+		want  string
+	}{
+		{
+			name:  "first text message",
+			views: []MessageView{testView("小明", "[CQ:image,file=a.jpg]"), testView("小红", "  今天   吃什么 ")},
+			want:  "小红：今天 吃什么",
+		},
+		{
+			name:  "truncated to max length",
+			views: []MessageView{testView("小明", strings.Repeat("哈", 50))},
+			want:  "小明：" + strings.Repeat("哈", maxTitleLength-3),
+		},
+		{
+			name:  "no text falls back to count",
+			views: []MessageView{testView("小明", "[CQ:image,file=a.jpg]"), testView("小红", "[CQ:face,id=1]")},
+			want:  "小明的2条消息",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generator.GenerateTitle(context.Background(), tt.views)
+			if err != nil {
+				t.Fatalf("GenerateTitle() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("GenerateTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := generator.GenerateTitle(context.Background(), nil); err == nil {
+		t.Error("GenerateTitle(nil) should fail")
+	}
+}
+
+// chatCompletionServer 模拟 OpenAI 兼容接口，handler 为空时返回 content
+func chatCompletionServer(t *testing.T, content string, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	if handler == nil {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/chat/completions" || r.Header.Get("Authorization") != "Bearer key" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"choices": []map[string]any{{"message": map[string]string{"content": content}}},
+			})
+		}
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFallbackTitleGenerator(t *testing.T) {
+	views := []MessageView{testView("小明", "葡萄在蹦迪")}
+	local := &LocalTitleGenerator{}
+
+	t.Run("openai success", func(t *testing.T) {
+		server := chatCompletionServer(t, "<think>想一想</think>\n“葡星撞地球”\n解释", nil)
+		generator := &FallbackTitleGenerator{
+			Generators: []TitleGenerator{&OpenAITitleGenerator{BaseURL: server.URL + "/", APIKey: "key"}, local},
+			Timeout:    time.Second,
+		}
+		got, err := generator.GenerateTitle(context.Background(), views)
+		if err != nil || got != "葡星撞地球" {
+			t.Errorf("GenerateTitle() = %q, %v", got, err)
+		}
+	})
+
+	t.Run("openai error falls back", func(t *testing.T) {
+		server := chatCompletionServer(t, "", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		})
+		generator := &FallbackTitleGenerator{
+			Generators: []TitleGenerator{&OpenAITitleGenerator{BaseURL: server.URL, APIKey: "key"}, local},
+			Timeout:    time.Second,
+		}
+		got, err := generator.GenerateTitle(context.Background(), views)
+		if err != nil || got != "小明：葡萄在蹦迪" {
+			t.Errorf("GenerateTitle() = %q, %v", got, err)
+		}
+	})
+
+	t.Run("slow generator does not starve fallbacks", func(t *testing.T) {
+		release := make(chan struct{})
+		server := chatCompletionServer(t, "", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		})
+		defer close(release)
+		generator := &FallbackTitleGenerator{
+			Generators: []TitleGenerator{
+				&OpenAITitleGenerator{BaseURL: server.URL, APIKey: "key"},
+				&LegacyTitleGenerator{URL: server.URL},
+				local,
+			},
+			Timeout: 50 * time.Millisecond,
+		}
+		// 调用方的超时足够所有生成器各自超时一次
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		got, err := generator.GenerateTitle(ctx, views)
+		if err != nil || got != "小明：葡萄在蹦迪" {
+			t.Errorf("GenerateTitle() = %q, %v", got, err)
+		}
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		generator := &FallbackTitleGenerator{Generators: []TitleGenerator{local}}
+		_, err := generator.GenerateTitle(context.Background(), nil)
+		if err == nil || !strings.Contains(err.Error(), "local") {
+			t.Errorf("GenerateTitle() error = %v, want error naming the generator", err)
+		}
+	})
+
+	t.Run("caller cancellation stops the chain", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		generator := &FallbackTitleGenerator{Generators: []TitleGenerator{local}}
+		_, err := generator.GenerateTitle(ctx, views)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("GenerateTitle() error = %v, want context.Canceled", err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"memento_backend/db"
+
+	"snail.local/snailllllll/utils"
+)
+
+// TitleJobType 生成聊天记录标题的任务类型
+const TitleJobType = "generate_title"
+
+// rebuildTitleLockTTL 重命名锁的有效期，覆盖排队等待和一次执行（任务租约10分钟）
+// 任务每次执行时续期，使锁在重试间隔内也保持有效
+const rebuildTitleLockTTL = 15 * time.Minute
+
+// RegisterTitleJobs 向任务队列注册标题生成任务
+func RegisterTitleJobs(queue *db.JobQueue) {
+	queue.Register(TitleJobType, func(ctx context.Context, job *db.Job) (string, error) {
+		forwardId := job.Payload["forward_id"]
+		// 由重命名发起的任务持有重命名锁
+		lockToken := job.Payload["lock_token"]
+		if lockToken != "" {
+			if err := utils.ExtendLock(rebuildTitleLockKey(forwardId), lockToken, rebuildTitleLockTTL); err != nil {
+				fmt.Printf("重命名锁续期失败 %s: %v\n", forwardId, err)
+			}
+		}
+
+		title, err := ProcessForwardViewsToDB(ctx, forwardId)
+		titleGenerations.Inc(metricResult(err))
+		// 成功或重试次数用尽时释放重命名锁
+		if lockToken != "" && (err == nil || job.Attempts >= job.MaxAttempts) {
+			utils.DeleteLock(rebuildTitleLockKey(forwardId), lockToken)
+		}
+		return title, err
+	})
+}
+
+// EnqueueTitleJob 添加标题生成任务，同一聊天记录已有未完成任务时不重复添加
+// 返回任务ID以及是否为新建的任务
+func EnqueueTitleJob(forwardId string) (string, bool, error) {
+	return enqueueTitleJob(forwardId, "")
+}
+
+// enqueueTitleJob 添加标题生成任务，lockToken 不为空时任务结束后释放对应的重命名锁
+func enqueueTitleJob(forwardId, lockToken string) (string, bool, error) {
+	payload := map[string]string{"forward_id": forwardId}
+	if lockToken != "" {
+		payload["lock_token"] = lockToken
+	}
+	job, created, err := db.GetJobQueue().Enqueue(context.Background(), TitleJobType, forwardId, payload)
+	if err != nil {
+		fmt.Printf("添加标题生成任务失败: %v\n", err)
+		return "", false, err
+	}
+	return job.ID.Hex(), created, nil
+}
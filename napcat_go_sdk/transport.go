@@ -0,0 +1,136 @@
+package napcat_go_sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 调用方没有指定 ctx 时等待响应的时间
+const defaultRequestTimeout = time.Minute
+
+// NapCat 的连接方式
+const (
+	ModeWebSocket        = "ws"         // 主动连接 NapCat 的正向WebSocket
+	ModeHttp             = "http"       // 通过 NapCat 的HTTP服务调用接口，不接收事件
+	ModeReverseWebSocket = "reverse_ws" // NapCat 连接本服务的反向WebSocket
+)
+
+// Transport 与 NapCat 通信的传输层
+type Transport interface {
+	// Send 调用接口并返回完整的响应帧，retcode 由调用方检查
+	Send(ctx context.Context, action Action, params any) ([]byte, error)
+	// IsConnected 当前是否可以调用接口
+	IsConnected() bool
+	// PendingRequests 已发送但还未收到响应的请求数量
+	PendingRequests() int
+	// Close 关闭传输层，之后的调用都会失败
+	Close() error
+}
+
+// Client 与传输方式无关的 NapCat 客户端，OneBot 接口定义在 actions.go
+type Client struct {
+	Transport
+}
+
+// NewClient 使用指定的传输层创建客户端
+func NewClient(transport Transport) *Client {
+	return &Client{Transport: transport}
+}
+
+var (
+	clientInstance *Client
+	clientMu       sync.RWMutex
+)
+
+// ConnectOptions 连接 NapCat 的参数
+type ConnectOptions struct {
+	Mode             string        // ws、http 或 reverse_ws
+	Addr             string        // NapCat 地址，多个账号的实例用逗号分隔，可写为 host:port
+	Port             uint          // Addr 中没有端口时使用的端口
+	Token            string        // access token
+	NotifyBots       []string      // 发送通知时优先使用的账号
+	FailoverCooldown time.Duration // 发送失败后暂停使用账号的时间
+}
+
+// Connect 按 mode 连接 NapCat，将所有账号注册到 GetBotRegistry 并设置为全局客户端
+// 返回的客户端按 NotifyBots 的顺序选择账号发送；ws 连接失败时在后台持续重连，
+// reverse_ws 的账号在连接到 GetEventServer 后注册，需要将其挂载到路由上
+func Connect(options ConnectOptions) (*Client, error) {
+	registry := GetBotRegistry()
+	registry.SetPriority(options.NotifyBots)
+	if options.FailoverCooldown > 0 {
+		registry.SetCooldown(options.FailoverCooldown)
+	}
+	client := NewClient(registry)
+	SetClient(client)
+
+	if options.Mode == ModeReverseWebSocket {
+		return client, nil
+	}
+
+	var errs []error
+	for _, addr := range strings.Split(options.Addr, ",") {
+		host, port, err := splitAddr(strings.TrimSpace(addr), options.Port)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var transport Transport
+		switch options.Mode {
+		case ModeWebSocket, "":
+			transport, err = StartWebSocketClient(host, port, &options.Token)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+			}
+		case ModeHttp:
+			transport = NewHttpClient(fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(int(port)))), &options.Token)
+		default:
+			return client, fmt.Errorf("unsupported napcat mode: %q", options.Mode)
+		}
+		if err := registry.Discover(NewClient(transport)); err != nil && transport.IsConnected() {
+			errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+		}
+	}
+	return client, errors.Join(errs...)
+}
+
+// splitAddr 解析 host 或 host:port
+func splitAddr(addr string, defaultPort uint) (string, uint, error) {
+	if addr == "" {
+		return "", 0, errors.New("empty napcat addr")
+	}
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		// 没有端口
+		return addr, defaultPort, nil
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid napcat addr %q: %w", addr, err)
+	}
+	return host, uint(port), nil
+}
+
+// SetClient 设置全局客户端
+func SetClient(client *Client) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	clientInstance = client
+}
+
+// GetClient 返回全局客户端，未初始化时返回错误
+func GetClient() (*Client, error) {
+	clientMu.RLock()
+	defer clientMu.RUnlock()
+	if clientInstance == nil {
+		return nil, fmt.Errorf("napcat client not initialized")
+	}
+	return clientInstance, nil
+}
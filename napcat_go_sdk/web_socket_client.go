@@ -1,23 +1,63 @@
 package napcat_go_sdk
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-var (
-	wsClientInstance   *WebSocketClient
-	globalWSClientOnce sync.Once
+const (
+	// 重连退避的初始间隔与最大间隔
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = time.Minute
+	// ping 发送间隔，超过 pongWait 未收到任何数据则认为连接已断开
+	pingInterval = 30 * time.Second
+	pongWait     = 75 * time.Second
+	// 单次写入的超时时间
+	writeWait = 10 * time.Second
 )
 
+// ErrNotConnected WebSocket 未连接，请求没有发出
+var ErrNotConnected = errors.New("websocket not connected")
+
+// ErrConnectionLost 等待响应时连接断开，请求可能已经发出
+var ErrConnectionLost = errors.New("websocket connection lost")
+
+// ErrClientClosed WebSocketClient 已被关闭
+var ErrClientClosed = errors.New("websocket client closed")
+
 type WebSocketClient struct {
+	connUrl          string
 	conn             *websocket.Conn  //websocket连接
+	connMu           sync.RWMutex     //保护conn
 	Handler          []HandlerMessage //消息处理器
+	Events           *EventRouter     //按事件类型分发的路由
 	responseChannels sync.Map         //等待响应的通道
+	writeMu          sync.Mutex       //串行化写入
+	done             chan struct{}    //关闭信号
+	closeOnce        sync.Once
+	cursor           eventCursor //最近分发的消息，重连后据此补发断线期间的消息
+}
+
+// wsResponse 等待通道中传递的响应，连接断开时 err 不为空
+type wsResponse struct {
+	data []byte
+	err  error
+}
+
+// ConnectionHandler 连接状态处理器
+// Handler 中同时实现了该接口的处理器会在连接建立和断开时收到通知
+type ConnectionHandler interface {
+	// OnConnect 连接建立（包括重连成功）
+	OnConnect(client *WebSocketClient)
+	// OnDisconnect 连接断开，err 为断开原因
+	OnDisconnect(client *WebSocketClient, err error)
 }
 
 func NewWebSocketClient(url string, port uint, token *string) (*WebSocketClient, error) {
@@ -29,99 +69,355 @@ func NewWebSocketClient(url string, port uint, token *string) (*WebSocketClient,
 		connUrl = fmt.Sprintf("ws://%s:%d?access_token=%s", url, port, *token)
 	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(connUrl, nil)
+	client := &WebSocketClient{
+		connUrl: connUrl,
+		Handler: make([]HandlerMessage, 0),
+		Events:  NewEventRouter(),
+		done:    make(chan struct{}),
+	}
+	err := client.dial()
+	return client, err
+}
+
+// dial 建立连接并启动心跳
+func (client *WebSocketClient) dial() error {
+	conn, _, err := websocket.DefaultDialer.Dial(client.connUrl, nil)
+	if err != nil {
+		return err
+	}
+	client.attach(conn)
+	return nil
+}
+
+// attach 使用新建立的连接并启动心跳，已有连接时先断开旧连接
+func (client *WebSocketClient) attach(conn *websocket.Conn) {
+	if old := client.currentConn(); old != nil {
+		client.disconnect(old, errors.New("replaced by new connection"))
+	}
+
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	client.connMu.Lock()
+	client.conn = conn
+	client.connMu.Unlock()
+
+	go client.ping(conn)
+}
+
+// ping 定时发送 ping 帧，用于探测已经失效但未关闭的连接
+func (client *WebSocketClient) ping(conn *websocket.Conn) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-client.done:
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(10 * time.Second)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// currentConn 获取当前连接，未连接时返回 nil
+func (client *WebSocketClient) currentConn() *websocket.Conn {
+	client.connMu.RLock()
+	defer client.connMu.RUnlock()
+	return client.conn
+}
+
+// IsConnected 当前是否已连接
+func (client *WebSocketClient) IsConnected() bool {
+	return client.currentConn() != nil
+}
 
-	return &WebSocketClient{conn: conn, Handler: make([]HandlerMessage, 0)}, err
+// Send 实现 Transport，调用接口并等待响应
+func (client *WebSocketClient) Send(ctx context.Context, action Action, params any) ([]byte, error) {
+	return client.SendMessageContext(ctx, Message[any]{Action: action, Params: params})
 }
 
+// SendMessage 发送请求并等待响应，最多等待 defaultRequestTimeout
 func (client *WebSocketClient) SendMessage(message Message[any]) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultRequestTimeout)
+	defer cancel()
+	response, err := client.SendMessageContext(ctx, message)
+	return string(response), err
+}
+
+// SendMessageContext 发送请求并等待响应，ctx 取消或到期时立即返回
+// 返回的是完整的响应帧，retcode 由调用方检查，需要类型化结果时使用 Call
+func (client *WebSocketClient) SendMessageContext(ctx context.Context, message Message[any]) ([]byte, error) {
 	msg := message.SendWebSocketMsg()
-	// 创建响应通道并存储到sync.Map中
+	// 创建响应通道并存储到sync.Map中，带缓冲避免读协程阻塞
+	// 通道只由读协程写入，不关闭；返回时删除，之后到达的响应直接丢弃
+	// 先注册再读取连接，之后断开时 failPending 一定能通知到这个请求
 	echo_id := message.Echo
-	responseChan := make(chan []byte)
+	responseChan := make(chan wsResponse, 1)
 	client.responseChannels.Store(echo_id, responseChan)
+	defer client.responseChannels.Delete(echo_id)
+
+	conn := client.currentConn()
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
 
-	err := client.conn.WriteJSON(msg)
+	if err := client.writeJSON(ctx, conn, msg); err != nil {
+		return nil, err
+	}
 
-	// 阻塞等待通道有数据写入，读取响应并关闭通道
-	select { // 阻塞等待通道有数据写入，超时时间设置为 200 秒
+	select {
 	case response := <-responseChan:
-		// 关闭通道
-		close(responseChan)
-		// 返回响应
-		return string(response), err
-	case <-time.After(200 * time.Second):
-		// 超时后关闭通道
-		close(responseChan)
-		// 返回超时错误
-		return "", fmt.Errorf("timeout")
+		return response.data, response.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %w", message.Action, ctx.Err())
+	case <-client.done:
+		return nil, ErrClientClosed
 	}
+}
+
+// writeJSON 串行写入一帧，gorilla/websocket 的连接不支持并发写
+func (client *WebSocketClient) writeJSON(ctx context.Context, conn *websocket.Conn, v interface{}) error {
+	client.writeMu.Lock()
+	defer client.writeMu.Unlock()
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(writeWait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetWriteDeadline(deadline)
+	if err := conn.WriteJSON(v); err != nil {
+		client.disconnect(conn, err)
+		return err
+	}
+	return nil
 }
 
 func (client *WebSocketClient) ReadMessage() (string, error) {
-	_, message, err := client.conn.ReadMessage()
-	var receiveMessage ReceiveMessage
-	err = json.Unmarshal(message, &receiveMessage)
+	conn := client.currentConn()
+	if conn == nil {
+		return "", ErrNotConnected
+	}
+	return client.readFrom(conn)
+}
+
+// readFrom 从指定连接读取一帧，响应交给等待中的请求，事件分发给处理器
+func (client *WebSocketClient) readFrom(conn *websocket.Conn) (string, error) {
+	_, message, err := conn.ReadMessage()
 	if err != nil {
-		var replyStatus apiResponse
-		err = json.Unmarshal(message, &replyStatus)
-		if err != nil {
-			return "", err
-		}
-		// 根据 echo 将响应发送回原始通道
-		if replyStatus.Echo != "" {
-			if v, ok := client.responseChannels.Load(replyStatus.Echo); ok {
-				responseChan := v.(chan []byte)
+		client.disconnect(conn, err)
+		return "", err
+	}
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+
+	var frame eventFrame
+	if err := json.Unmarshal(message, &frame); err != nil {
+		return "", err
+	}
+
+	// 没有 post_type 的是接口响应，根据 echo 将响应发送回原始通道
+	if frame.PostType == "" {
+		if frame.Echo != "" {
+			if v, ok := client.responseChannels.Load(frame.Echo); ok {
+				responseChan := v.(chan wsResponse)
 				select {
-				case responseChan <- message:
+				case responseChan <- wsResponse{data: message}:
 					// 成功写入通道
 				default:
-					// 通道已关闭，忽略写入操作
+					// 已有响应写入，忽略重复响应
 				}
-				return string(message), nil
 			}
 		}
+		return string(message), nil
 	}
-	if client.Handler != nil {
-		for _, handlerMessage := range client.Handler {
-			if handlerMessage != nil {
-				//异步执行处理器中对于消息的处理
-				go func() {
-					h := handlerMessage
-					h.HandleMessage(&receiveMessage)
-				}()
+
+	if err := client.dispatchEvent(&frame, message); err != nil {
+		return "", err
+	}
+	return string(message), nil
+
+}
+
+// dispatchEvent 将上报事件分发给消息处理器和事件路由
+func (client *WebSocketClient) dispatchEvent(frame *eventFrame, message []byte) error {
+	if frame.PostType == POST_MESSAGE && !client.cursor.mark(frame) {
+		// 重连补发时已经分发过
+		return nil
+	}
+	return dispatchEvent(client.Handler, client.Events, frame, message)
+}
+
+// dispatchEvent 将上报事件分发给处理器链和事件路由，WebSocket 和 HTTP 上报共用
+// 补发的历史消息只交给 HandleMessage 归档，不触发按来源分发的消息事件和事件路由，避免重复执行命令
+func dispatchEvent(handlers []HandlerMessage, events *EventRouter, frame *eventFrame, message []byte) error {
+	if frame.PostType == POST_MESSAGE {
+		var receiveMessage ReceiveMessage
+		if err := json.Unmarshal(message, &receiveMessage); err != nil {
+			return err
+		}
+		receiveMessage.Replayed = frame.Replayed
+		for _, handlerMessage := range handlers {
+			if handlerMessage == nil {
+				continue
+			}
+			//异步执行处理器中对于消息的处理
+			go handlerMessage.HandleMessage(&receiveMessage)
+
+			// 同时实现了 MessageHandlerEvent 的处理器按消息来源分发
+			if h, ok := handlerMessage.(MessageHandlerEvent); ok && !frame.Replayed {
+				switch receiveMessage.MessageType {
+				case PRIVATE:
+					go h.PrivateMessageEvent(&receiveMessage)
+				case GROUP:
+					go h.GroupMessageEvent(&receiveMessage)
+				}
 			}
 		}
 	}
 
-	return string(message), err
+	if !frame.Replayed {
+		events.Dispatch(frame, message)
+	}
+	return nil
+}
+
+// disconnect 处理连接断开：释放连接、让所有等待中的请求失败并通知处理器
+func (client *WebSocketClient) disconnect(conn *websocket.Conn, cause error) {
+	client.connMu.Lock()
+	if client.conn != conn {
+		// 该连接已被处理过
+		client.connMu.Unlock()
+		return
+	}
+	client.conn = nil
+	client.connMu.Unlock()
+	conn.Close()
 
+	fmt.Printf("WebSocket连接断开: %v\n", cause)
+	client.failPending(fmt.Errorf("%w: %v", ErrConnectionLost, cause))
+	for _, handler := range client.Handler {
+		if h, ok := handler.(ConnectionHandler); ok {
+			go h.OnDisconnect(client, cause)
+		}
+	}
 }
 
-// GetWebSocketClient 返回全局唯一的 WebSocketClient 实例
-func GetWebSocketClient(url string, port uint, token *string) (*WebSocketClient, error) {
-	var err error
-	globalWSClientOnce.Do(func() {
-		wsClientInstance, err = NewWebSocketClient(url, port, token)
-		wsClientInstance.Handler = append(wsClientInstance.Handler, &(BaseHandler{}))
-		// 启动WebSocket监听协程
-		go func() {
-			for {
-				// 接收消息
-				_, err := wsClientInstance.ReadMessage()
-				if err != nil {
-					continue
-				}
+// failPending 让所有等待响应的请求立即以 err 返回
+func (client *WebSocketClient) failPending(err error) {
+	client.responseChannels.Range(func(key, value interface{}) bool {
+		responseChan := value.(chan wsResponse)
+		select {
+		case responseChan <- wsResponse{err: err}:
+		default:
+		}
+		client.responseChannels.Delete(key)
+		return true
+	})
+}
+
+// reconnect 按指数退避重新建立连接，直到成功或客户端被关闭
+func (client *WebSocketClient) reconnect() bool {
+	backoff := reconnectMinBackoff
+	for attempt := 1; ; attempt++ {
+		// 加入随机抖动，避免与 NapCat 重启节奏同步
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+		fmt.Printf("WebSocket将在 %v 后进行第 %d 次重连\n", wait, attempt)
+		select {
+		case <-client.done:
+			return false
+		case <-time.After(wait):
+		}
+
+		if err := client.dial(); err != nil {
+			fmt.Printf("WebSocket重连失败: %v\n", err)
+			backoff *= 2
+			if backoff > reconnectMaxBackoff {
+				backoff = reconnectMaxBackoff
 			}
-		}()
+			continue
+		}
+
+		fmt.Printf("WebSocket重连成功\n")
+		client.notifyConnect()
+		go client.resume()
+		return true
+	}
+}
+
+// notifyConnect 通知处理器连接已建立
+func (client *WebSocketClient) notifyConnect() {
+	for _, handler := range client.Handler {
+		if h, ok := handler.(ConnectionHandler); ok {
+			go h.OnConnect(client)
+		}
+	}
+}
+
+// keepAlive 监听协程：持续读取消息，连接断开后自动重连
+func (client *WebSocketClient) keepAlive() {
+	for {
+		select {
+		case <-client.done:
+			return
+		default:
+		}
+
+		if !client.IsConnected() {
+			if !client.reconnect() {
+				return
+			}
+			continue
+		}
+
+		// 接收消息
+		if _, err := client.ReadMessage(); err != nil {
+			continue
+		}
+	}
+}
+
+// PendingRequests 已发送但还未收到响应的请求数量
+func (client *WebSocketClient) PendingRequests() int {
+	count := 0
+	client.responseChannels.Range(func(key, value any) bool {
+		count++
+		return true
 	})
-	return wsClientInstance, err
+	return count
+}
+
+// Close 关闭客户端：停止重连并关闭当前连接
+func (client *WebSocketClient) Close() error {
+	client.closeOnce.Do(func() {
+		close(client.done)
+	})
+
+	conn := client.currentConn()
+	if conn == nil {
+		return nil
+	}
+	deadline := time.Now().Add(time.Second)
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+	client.disconnect(conn, ErrClientClosed)
+	return nil
 }
 
-func GetExistWSClient()  (*WebSocketClient, error){
-	if wsClientInstance == nil {
-		return nil, fmt.Errorf("WebSocketClient not initialized")
+// StartWebSocketClient 连接 NapCat 并启动监听协程
+// 首次连接失败时仍会返回实例并在后台持续重连
+func StartWebSocketClient(url string, port uint, token *string) (*WebSocketClient, error) {
+	client, err := NewWebSocketClient(url, port, token)
+	client.Handler = append(client.Handler, &(BaseHandler{}))
+	if err == nil {
+		client.notifyConnect()
 	}
-	return wsClientInstance, nil
+	// 启动WebSocket监听协程
+	go client.keepAlive()
+	return client, err
 }
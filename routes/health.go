@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"memento_backend/db"
+	"memento_backend/lifecycle"
+
+	"github.com/gin-gonic/gin"
+	"snail.local/snailllllll/napcat_go_sdk"
+	"snail.local/snailllllll/utils"
+	"snail.local/snailllllll/utils/sms"
+)
+
+// 健康检查中单项检查的超时时间
+const healthCheckTimeout = 2 * time.Second
+
+// 检查结果的缓存时间，/healthz 和 /readyz 是公开接口，不能每次请求都访问外部依赖
+const healthCacheTTL = 5 * time.Second
+
+// healthCheck 单项检查结果
+type healthCheck struct {
+	Status    string `json:"status"` // ok 或 error
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+	Critical  bool   `json:"critical"` // 失败时服务不可用
+}
+
+// dependencyCheck 一项依赖检查
+type dependencyCheck struct {
+	critical bool
+	fn       func(ctx context.Context) error
+}
+
+// healthChecker 缓存最近一次的检查结果，同一时间只执行一轮检查
+type healthChecker struct {
+	checks map[string]dependencyCheck
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	results   map[string]healthCheck
+	healthy   bool
+}
+
+// newHealthChecker 只有 MongoDB 是关键依赖
+// NapCat 断开时仍可以提供查询服务，反向WebSocket模式下还需要先就绪才能等到 NapCat 连接
+// 短信网关默认不检查，需要时通过 sms.health_check 开启
+func newHealthChecker(napcatClient *napcat_go_sdk.Client) *healthChecker {
+	checks := map[string]dependencyCheck{
+		"mongodb": {true, db.Ping},
+		"napcat": {false, func(ctx context.Context) error {
+			if !napcatClient.IsConnected() {
+				return napcat_go_sdk.ErrNotConnected
+			}
+			return nil
+		}},
+	}
+	if utils.Config.SMS.HealthCheck {
+		checks["sms"] = dependencyCheck{false, sms.NewClient().Ping}
+	}
+	return &healthChecker{checks: checks}
+}
+
+// Check 返回缓存的结果，过期后重新检查，并发的请求等待同一轮检查完成
+func (h *healthChecker) Check() (map[string]healthCheck, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.results == nil || time.Since(h.checkedAt) >= healthCacheTTL {
+		// 不使用请求的 context，客户端断开不影响缓存的结果
+		h.results, h.healthy = runHealthChecks(context.Background(), h.checks)
+		h.checkedAt = time.Now()
+	}
+	return h.results, h.healthy
+}
+
+// SetupHealthRoutes 健康检查、就绪检查和监控指标（公开接口）
+func SetupHealthRoutes(router *gin.Engine, app *lifecycle.App, napcatClient *napcat_go_sdk.Client) {
+	checker := newHealthChecker(napcatClient)
+
+	// 存活检查：进程可以响应即返回200，附带各依赖的状态
+	router.GET("/healthz", func(c *gin.Context) {
+		checks, healthy := checker.Check()
+		status := "ok"
+		if !healthy {
+			status = "degraded"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":           status,
+			"ready":            app.Ready(),
+			"pending_requests": napcatClient.PendingRequests(),
+			"checks":           checks,
+		})
+	})
+
+	// 就绪检查：启动完成、没有在关闭且关键依赖可用时返回200，否则返回503
+	router.GET("/readyz", func(c *gin.Context) {
+		checks, healthy := checker.Check()
+		ready := app.Ready() && healthy
+		code, status := http.StatusOK, "ok"
+		if !ready {
+			code, status = http.StatusServiceUnavailable, "unavailable"
+		}
+		c.JSON(code, gin.H{
+			"status":           status,
+			"ready":            app.Ready(),
+			"shutting_down":    app.ShuttingDown(),
+			"pending_requests": napcatClient.PendingRequests(),
+			"checks":           checks,
+		})
+	})
+
+	// Prometheus 格式的监控指标
+	router.GET("/metrics", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := utils.WriteMetrics(c.Writer); err != nil {
+			c.Error(err)
+		}
+	})
+}
+
+// runHealthChecks 并发执行所有检查，返回结果以及关键依赖是否全部可用
+func runHealthChecks(ctx context.Context, checks map[string]dependencyCheck) (map[string]healthCheck, bool) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]healthCheck, len(checks))
+		healthy = true
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, critical bool, fn func(ctx context.Context) error) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := fn(checkCtx)
+			result := healthCheck{Status: "ok", LatencyMs: time.Since(start).Milliseconds(), Critical: critical}
+			if err != nil {
+				result.Status = "error"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+			if err != nil && critical {
+				healthy = false
+			}
+		}(name, check.critical, check.fn)
+	}
+	wg.Wait()
+	return results, healthy
+}
@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckerCachesResults(t *testing.T) {
+	var calls atomic.Int32
+	checker := &healthChecker{checks: map[string]dependencyCheck{
+		"slow": {false, func(ctx context.Context) error {
+			calls.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}},
+	}}
+
+	// 并发的请求只执行一轮检查
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checker.Check()
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("checks run %d times, want 1", calls.Load())
+	}
+
+	// 缓存过期后重新检查
+	checker.mu.Lock()
+	checker.checkedAt = time.Now().Add(-healthCacheTTL)
+	checker.mu.Unlock()
+	checker.Check()
+	if calls.Load() != 2 {
+		t.Errorf("checks run %d times after expiry, want 2", calls.Load())
+	}
+}
+
+func TestRunHealthChecks(t *testing.T) {
+	failing := func(ctx context.Context) error { return errors.New("down") }
+	ok := func(ctx context.Context) error { return nil }
+
+	results, healthy := runHealthChecks(context.Background(), map[string]dependencyCheck{
+		"critical": {true, ok},
+		"optional": {false, failing},
+	})
+	if !healthy {
+		t.Error("failed optional check made the service unhealthy")
+	}
+	if results["optional"].Status != "error" || results["optional"].Error != "down" {
+		t.Errorf("optional result = %+v", results["optional"])
+	}
+
+	if _, healthy := runHealthChecks(context.Background(), map[string]dependencyCheck{"critical": {true, failing}}); healthy {
+		t.Error("failed critical check should make the service unhealthy")
+	}
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"snail.local/snailllllll/napcat_go_sdk"
+)
+
+// SetupOneBotRoutes NapCat 事件上报入口，使用 napcat.token 鉴权（不使用用户token）
+// 反向WebSocket: ws://<host>/onebot/ws，HTTP上报: POST http://<host>/onebot/event
+func SetupOneBotRoutes(router *gin.Engine, server *napcat_go_sdk.EventServer) {
+	router.GET("/onebot/ws", gin.WrapF(server.ServeWebSocket))
+	router.POST("/onebot/event", gin.WrapF(server.ServeWebhook))
+}
@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"snail.local/snailllllll/napcat_go_sdk"
+)
+
+func TestOneBotRoutesRequireToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupOneBotRoutes(router, napcat_go_sdk.NewEventServer("secret"))
+
+	event := `{"post_type":"meta_event","meta_event_type":"heartbeat"}`
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{"webhook without credentials", http.MethodPost, "/onebot/event", nil, http.StatusUnauthorized},
+		{"webhook with bad signature", http.MethodPost, "/onebot/event", map[string]string{"X-Signature": "sha1=00"}, http.StatusUnauthorized},
+		{"webhook with token", http.MethodPost, "/onebot/event", map[string]string{"Authorization": "Bearer secret"}, http.StatusNoContent},
+		{"websocket without token", http.MethodGet, "/onebot/ws", map[string]string{"X-Self-ID": "10001"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(event))
+		for key, value := range tt.header {
+			r.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -2,18 +2,25 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"memento_backend/db"
+	"memento_backend/export"
 	"memento_backend/middleware"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"snail.local/snailllllll/napcat_go_sdk"
 	"snail.local/snailllllll/utils"
 	"snail.local/snailllllll/utils/sms"
@@ -21,12 +28,16 @@ import (
 )
 
 // SetupRoutes 配置所有路由
-func SetupRoutes(router *gin.Engine, userService *db.UserService, verificationService *verification.VerificationCodeService, wsClient *napcat_go_sdk.WebSocketClient) {
+func SetupRoutes(router *gin.Engine, userService *db.UserService, verificationService *verification.VerificationCodeService, napcatClient *napcat_go_sdk.Client) {
+	// 记录请求耗时
+	router.Use(middleware.Metrics())
+
 	// CORS 跨域中间件：允许跨域请求
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor, X-Total-Count, Retry-After")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusOK)
@@ -45,8 +56,14 @@ func SetupRoutes(router *gin.Engine, userService *db.UserService, verificationSe
 	// 用户管理路由
 	setupUserRoutes(router, userService)
 
+	// 登录会话路由
+	setupSessionRoutes(router)
+
 	// 工具路由
 	setupToolRoutes(router, verificationService)
+
+	// 后台任务路由
+	setupJobRoutes(router)
 }
 
 // 基础路由
@@ -58,10 +75,48 @@ func setupBasicRoutes(router *gin.Engine) {
 		})
 	})
 
-	// 图片查看接口
-	router.GET("/pic/:filename", func(c *gin.Context) {
-		filename := c.Param("filename")
-		filePath := filepath.Join(".", "pics", filename)
+	// 图片查看接口，filename 可以是QQ文件名或存储key
+	router.GET("/pic/:filename", middleware.OptionalAuth(), serveMedia("filename"))
+	// 媒体文件（图片、语音、视频、文件）查看接口，key 为消息段中的 media 字段
+	router.GET("/media/:key", middleware.OptionalAuth(), serveMedia("key"))
+}
+
+// serveMedia 从媒体存储读取文件，找不到时回退到 ./pics 目录
+// 文件出现在公开的记录中时可以匿名访问，否则需要登录并且能查看引用该文件的记录，或者带有有效的临时签名
+func serveMedia(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filename := c.Param(param)
+
+		// 先查找元数据，校验权限后再读取文件内容
+		media, err := db.GetMediaService().Find(c.Request.Context(), filename)
+		names := []string{filename}
+		if err == nil {
+			names = append(append(names, media.Key), media.Filenames...)
+		}
+		public, ok := authorizeMedia(c, filename, names)
+		if !ok {
+			return
+		}
+		// 内容寻址的文件不会变化，可以长期缓存；非公开的文件不允许共享缓存
+		if public {
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			c.Header("Cache-Control", "private, max-age=3600")
+		}
+
+		if media != nil {
+			reader, _, err := db.GetMediaService().Open(c.Request.Context(), media.Key)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
+				return
+			}
+			defer reader.Close()
+			c.DataFromReader(http.StatusOK, media.Size, media.MimeType, reader, nil)
+			return
+		}
+
+		// 兼容引入媒体存储之前直接保存在 ./pics 下的文件
+		filePath := filepath.Join(".", "pics", filepath.Base(filename))
 
 		// Check if file exists
 		if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -71,16 +126,78 @@ func setupBasicRoutes(router *gin.Engine) {
 
 		// Serve the file
 		c.File(filePath)
-	})
+	}
 }
 
+// authorizeMedia 检查当前请求能否读取媒体文件，失败时写入响应并返回 false
+// 不可见的文件与不存在的文件一样返回404
+func authorizeMedia(c *gin.Context, filename string, names []string) (public, ok bool) {
+	if utils.VerifyMediaSignature(filename, c.Query("expires"), c.Query("sig")) {
+		return false, true
+	}
+
+	var user *db.User
+	if _, err := middleware.GetUsernameFromContext(c); err == nil {
+		current, err := middleware.CurrentUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+			return false, false
+		}
+		if !current.GetRole().Can(db.PermReadMessages) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+			return false, false
+		}
+		user = current
+	}
+
+	public, err := db.NewForwardViewService().AuthorizeMedia(c.Request.Context(), names, user)
+	if err != nil {
+		if errors.Is(err, db.ErrForwardViewNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to authorize media"})
+		}
+		return false, false
+	}
+	return public, true
+}
+
+// forwardViewProjection 返回给客户端的聊天记录字段，不包含上传者QQ号和检索用的内部字段
+var forwardViewProjection = bson.M{"owner": 0, "search_text": 0, "search_version": 0, "media_refs": 0}
+
 // 消息相关路由
 func setupMessageRoutes(router *gin.Engine) {
+	// 通过分享链接查看聊天记录（公开接口）
+	router.GET("/shared/:token", func(c *gin.Context) {
+		id, ok := resolveShareToken(c)
+		if !ok {
+			return
+		}
+
+		objectID, _ := primitive.ObjectIDFromHex(id)
+		collection := db.Collection("message_db", "forward_views")
+		var message bson.M
+		if err := collection.FindOne(c.Request.Context(), bson.M{"_id": objectID}, options.FindOne().SetProjection(forwardViewProjection)).Decode(&message); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+		c.JSON(http.StatusOK, message)
+	})
+
+	// 通过分享链接导出聊天记录（公开接口）
+	router.GET("/shared/:token/export", func(c *gin.Context) {
+		id, ok := resolveShareToken(c)
+		if !ok {
+			return
+		}
+		writeExport(c, id)
+	})
+
 	// 创建需要鉴权的接口组
 	authGroup := router.Group("")
-	authGroup.Use(middleware.AuthMiddleware())
+	authGroup.Use(middleware.AuthMiddleware(), middleware.RequirePermission(db.PermReadMessages))
 	{
-		// 获取具体消息（需要鉴权）
+		// 获取具体消息（需要鉴权，只能查看可见的记录）
 		authGroup.GET("/messages/:id", func(c *gin.Context) {
 			// url 参数
 			id, err := primitive.ObjectIDFromHex(c.Param("id"))
@@ -88,10 +205,13 @@ func setupMessageRoutes(router *gin.Engine) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
 				return
 			}
+			if !authorizeForwardView(c, id.Hex(), false) {
+				return
+			}
 
 			collection := db.Collection("message_db", "forward_views")
 			var message bson.M
-			if err := collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&message); err != nil {
+			if err := collection.FindOne(c.Request.Context(), bson.M{"_id": id}, options.FindOne().SetProjection(forwardViewProjection)).Decode(&message); err != nil {
 				c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
 				return
 			}
@@ -99,106 +219,359 @@ func setupMessageRoutes(router *gin.Engine) {
 			c.JSON(http.StatusOK, message)
 		})
 
-		// 获取消息列表（需要鉴权）
+		// 导出聊天记录（需要鉴权），format 可选 html、md、json、zip
+		authGroup.GET("/messages/:id/export", func(c *gin.Context) {
+			if !authorizeForwardView(c, c.Param("id"), false) {
+				return
+			}
+			writeExport(c, c.Param("id"))
+		})
+
+		// 修改可见范围（上传者或管理员）
+		authGroup.PUT("/messages/:id/visibility", func(c *gin.Context) {
+			var request struct {
+				Visibility db.Visibility `json:"visibility" binding:"required"`
+			}
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			id := c.Param("id")
+			if !authorizeForwardView(c, id, true) {
+				return
+			}
+			if err := db.NewForwardViewService().SetVisibility(c.Request.Context(), id, request.Visibility); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "可见范围已更新", "id": id, "visibility": request.Visibility.Normalize()})
+		})
+
+		// 分享链接列表（上传者或管理员）
+		authGroup.GET("/messages/:id/shares", func(c *gin.Context) {
+			id := c.Param("id")
+			if !authorizeForwardView(c, id, true) {
+				return
+			}
+			links, err := db.NewShareLinkService().List(c.Request.Context(), id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query share links"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"shares": links, "count": len(links)})
+		})
+
+		// 创建分享链接（上传者或管理员），记录需要先设为 public；expires_in 为有效小时数
+		authGroup.POST("/messages/:id/shares", func(c *gin.Context) {
+			var request struct {
+				ExpiresIn int `json:"expires_in"`
+			}
+			if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			id := c.Param("id")
+			if !authorizeForwardView(c, id, true) {
+				return
+			}
+			visibility, err := db.NewForwardViewService().GetVisibility(c.Request.Context(), id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if visibility != db.VisibilityPublic {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "请先将可见范围设为 public"})
+				return
+			}
+
+			link, err := db.NewShareLinkService().Create(c.Request.Context(), id, c.GetString("username"), time.Duration(request.ExpiresIn)*time.Hour)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusCreated, gin.H{
+				"share": link,
+				"path":  "/shared/" + link.Token,
+			})
+		})
+
+		// 撤销分享链接（上传者或管理员）
+		authGroup.DELETE("/messages/:id/shares/:share_id", func(c *gin.Context) {
+			id := c.Param("id")
+			if !authorizeForwardView(c, id, true) {
+				return
+			}
+			if err := db.NewShareLinkService().Revoke(c.Request.Context(), id, c.Param("share_id")); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "分享链接已撤销"})
+		})
+
+		// 获取消息列表（需要鉴权），支持游标分页、排序和筛选
 		authGroup.GET("/message_list", func(c *gin.Context) {
-			collection := db.Collection("message_db", "forward_views")
-			cursor, err := collection.Find(context.Background(), bson.M{})
+			query, err := parseForwardViewQuery(c)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query messages"})
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
 
-			var messages []bson.M
-			if err := cursor.All(context.Background(), &messages); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode messages"})
+			projection := bson.M{"title": 1, "sender": 1, "count": 1}
+			messages, nextCursor, total, err := db.NewForwardViewService().List(c.Request.Context(), query, projection)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query messages"})
 				return
 			}
 
-			// 只返回title和id字段
-			var result []map[string]interface{}
-			for i, msg := range messages {
-				title, ok := msg["title"] // 使用双返回值形式获取map值，可以安全判断字段是否存在
-				if !ok || title == nil || title == "" {
-					title = fmt.Sprintf("聊天%d", i+1) //未没有标题的聊天使用序号作为标题
-				}
+			// 只返回列表展示需要的字段
+			result := make([]map[string]interface{}, 0, len(messages))
+			for _, msg := range messages {
 				result = append(result, map[string]interface{}{
-					"id":    msg["_id"],
-					"title": title,
+					"id":         msg["_id"],
+					"title":      forwardViewTitle(msg),
+					"sender":     msg["sender"],
+					"count":      msg["count"],
+					"created_at": forwardViewCreatedAt(msg),
 				})
 			}
 
+			setPageHeaders(c, nextCursor, total)
 			c.JSON(http.StatusOK, result)
 		})
 
-		// 获取全部消息 deprecated（需要鉴权）
+		// 全文检索聊天记录（需要鉴权）
+		authGroup.GET("/search", func(c *gin.Context) {
+			query := strings.TrimSpace(c.Query("q"))
+			if query == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "query parameter q required"})
+				return
+			}
+
+			limit, err := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+			if err != nil || limit <= 0 || limit > 100 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+				return
+			}
+
+			viewer, _ := middleware.GetUserFromContext(c)
+			results, err := db.NewSearchService().Search(c.Request.Context(), query, limit, viewer)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search messages"})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"query":   query,
+				"results": results,
+				"count":   len(results),
+			})
+		})
+
+		// 获取全部消息 deprecated（需要鉴权），与 /message_list 使用相同的分页参数
 		authGroup.GET("/messages", func(c *gin.Context) {
-			collection := db.Collection("message_db", "forward_views")
-			cursor, err := collection.Find(context.Background(), bson.M{})
+			query, err := parseForwardViewQuery(c)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query messages"})
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
 
-			var messages []bson.M
-			if err := cursor.All(context.Background(), &messages); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode messages"})
+			messages, nextCursor, total, err := db.NewForwardViewService().List(c.Request.Context(), query, forwardViewProjection)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query messages"})
 				return
 			}
 
+			setPageHeaders(c, nextCursor, total)
 			c.JSON(http.StatusOK, messages)
 		})
 	}
 }
 
-// 用户管理路由
-func setupUserRoutes(router *gin.Engine, userService *db.UserService) {
-	// 创建用户
-	router.POST("/users", func(c *gin.Context) {
-		var user db.User
-		if err := c.ShouldBindJSON(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
+// authorizeForwardView 检查当前用户能否查看（manage 为 true 时能否管理）指定记录，失败时写入错误响应
+func authorizeForwardView(c *gin.Context, id string, manage bool) bool {
+	user, err := middleware.CurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		return false
+	}
+
+	err = db.NewForwardViewService().Authorize(c.Request.Context(), id, user, manage)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, db.ErrForwardViewNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+	case errors.Is(err, db.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+	return false
+}
+
+// resolveShareToken 校验分享链接，返回对应的记录ID，失败时写入错误响应
+func resolveShareToken(c *gin.Context) (string, bool) {
+	id, err := db.NewShareLinkService().Resolve(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		if errors.Is(err, db.ErrShareLinkInvalid) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve share link"})
 		}
+		return "", false
+	}
+	return id, true
+}
+
+// writeExport 按 format 参数导出聊天记录，调用前需要完成权限校验
+func writeExport(c *gin.Context, id string) {
+	format, err := export.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		if err := userService.CreateUser(c.Request.Context(), &user); err != nil {
+	result, err := export.Load(c.Request.Context(), id, format)
+	if err != nil {
+		if errors.Is(err, export.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		} else if errors.Is(err, export.ErrTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "聊天记录中的媒体文件过多，无法导出"})
+		} else {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
 		}
+		return
+	}
 
-		c.JSON(http.StatusCreated, gin.H{
-			"message": "用户创建成功",
-			"user":    user,
-		})
-	})
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": result.Filename(format)})
+	c.Header("Content-Disposition", disposition)
+	c.Header("Content-Type", format.ContentType())
+	c.Status(http.StatusOK)
+	if err := result.Write(c.Writer, format); err != nil {
+		log.Printf("导出聊天记录失败 %s: %v", id, err)
+	}
+}
+
+// 分页参数默认值与上限
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// parseForwardViewQuery 解析聊天记录列表的分页、排序和筛选参数
+//
+//	cursor    上一页响应头 X-Next-Cursor 的值
+//	limit     每页数量，默认50，最大200
+//	order     asc/desc，按创建时间排序，默认desc
+//	sender    上传者
+//	from/to   创建时间范围，RFC3339 或 2006-01-02
+//	min_count/max_count 消息数量范围
+func parseForwardViewQuery(c *gin.Context) (db.ForwardViewQuery, error) {
+	query := db.ForwardViewQuery{
+		Cursor: c.Query("cursor"),
+		Sender: c.Query("sender"),
+	}
+	// 只返回当前用户可见的记录
+	if user, err := middleware.GetUserFromContext(c); err == nil {
+		query.Viewer = user
+	}
+
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)), 10, 64)
+	if err != nil || limit <= 0 || limit > maxPageSize {
+		return query, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	query.Limit = limit
+
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		query.Asc = true
+	case "desc":
+	default:
+		return query, fmt.Errorf("order must be asc or desc")
+	}
 
-	// 获取所有用户
-	router.GET("/users", func(c *gin.Context) {
-		users, err := userService.GetAllUsers(c.Request.Context())
+	for name, target := range map[string]**time.Time{"from": &query.From, "to": &query.To} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		t, err := parseQueryTime(value)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return query, fmt.Errorf("invalid %s: %s", name, value)
 		}
+		*target = &t
+	}
 
-		// 只返回id和name字段
-		var simpleUsers []map[string]interface{}
-		for _, user := range users {
-			simpleUsers = append(simpleUsers, map[string]interface{}{
-				"id":   user.ID.Hex(),
-				"name": user.Name,
-			})
+	for name, target := range map[string]**int64{"min_count": &query.MinCount, "max_count": &query.MaxCount} {
+		value := c.Query(name)
+		if value == "" {
+			continue
 		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("invalid %s: %s", name, value)
+		}
+		*target = &n
+	}
 
-		c.JSON(http.StatusOK, gin.H{
-			"users": simpleUsers,
-			"count": len(simpleUsers),
-		})
-	})
+	return query, nil
+}
+
+// parseQueryTime 解析 RFC3339 或日期格式的时间
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// setPageHeaders 通过响应头返回分页信息，保持响应体格式不变
+func setPageHeaders(c *gin.Context, nextCursor string, total int64) {
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	if nextCursor != "" {
+		c.Header("X-Next-Cursor", nextCursor)
+	}
+}
+
+// forwardViewCreatedAt 从ObjectID中取出创建时间
+func forwardViewCreatedAt(msg bson.M) time.Time {
+	if id, ok := msg["_id"].(primitive.ObjectID); ok {
+		return id.Timestamp()
+	}
+	return time.Time{}
+}
 
+// forwardViewTitle 获取标题，没有标题时使用创建时间作为稳定的默认标题
+func forwardViewTitle(msg bson.M) string {
+	if title, ok := msg["title"].(string); ok && title != "" {
+		return title
+	}
+	return fmt.Sprintf("聊天 %s", forwardViewCreatedAt(msg).Local().Format("2006-01-02 15:04"))
+}
+
+// 用户管理路由
+func setupUserRoutes(router *gin.Engine, userService *db.UserService) {
 	// 创建需要鉴权的用户接口组
 	authUserGroup := router.Group("")
 	authUserGroup.Use(middleware.AuthMiddleware())
 	{
-		// 根据用户名获取用户（需要鉴权）
+		// 当前登录用户（需要鉴权）
+		authUserGroup.GET("/users/me", func(c *gin.Context) {
+			user, err := middleware.CurrentUser(c)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{
+				"user":        user,
+				"role":        user.GetRole(),
+				"permissions": user.GetRole().Permissions(),
+			})
+		})
+
+		// 根据用户名获取用户（本人或管理员）
 		authUserGroup.GET("/users/name/:name", func(c *gin.Context) {
 			name := c.Param("name")
 			user, err := userService.GetUserByName(c.Request.Context(), name)
@@ -206,10 +579,13 @@ func setupUserRoutes(router *gin.Engine, userService *db.UserService) {
 				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 				return
 			}
+			if !requireSelfOrAdmin(c, user) {
+				return
+			}
 			c.JSON(http.StatusOK, user)
 		})
 
-		// 根据ID获取用户（需要鉴权）
+		// 根据ID获取用户（本人或管理员）
 		authUserGroup.GET("/users/:id", func(c *gin.Context) {
 			id := c.Param("id")
 			user, err := userService.GetUserByID(c.Request.Context(), id)
@@ -217,17 +593,45 @@ func setupUserRoutes(router *gin.Engine, userService *db.UserService) {
 				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 				return
 			}
+			if !requireSelfOrAdmin(c, user) {
+				return
+			}
 			c.JSON(http.StatusOK, user)
 		})
 
-		// 更新用户（需要鉴权）
+		// 更新用户（本人或管理员）
+		// 本人只能修改 db.SelfEditableUserFields，拥有用户管理权限时可以修改 db.ManagedUserFields
 		authUserGroup.PUT("/users/:id", func(c *gin.Context) {
 			id := c.Param("id")
-			var updateData map[string]interface{}
-			if err := c.ShouldBindJSON(&updateData); err != nil {
+			user, err := userService.GetUserByID(c.Request.Context(), id)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			if !requireSelfOrAdmin(c, user) {
+				return
+			}
+
+			current, _ := middleware.CurrentUser(c)
+			allowed := db.SelfEditableUserFields
+			if current.GetRole().Can(db.PermManageUsers) {
+				allowed = db.ManagedUserFields
+			}
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
+			updateData, err := db.ParseUserUpdate(body, allowed)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "allowed_fields": allowed})
+				return
+			}
+			// 避免管理员误操作后没有管理员
+			if updateData.Role != nil && current.ID == user.ID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "不能修改自己的角色"})
+				return
+			}
 
 			if err := userService.UpdateUser(c.Request.Context(), id, updateData); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -236,10 +640,62 @@ func setupUserRoutes(router *gin.Engine, userService *db.UserService) {
 
 			c.JSON(http.StatusOK, gin.H{"message": "用户更新成功"})
 		})
+	}
+
+	// 用户管理接口（需要管理员权限）
+	adminGroup := router.Group("")
+	adminGroup.Use(middleware.AuthMiddleware(), middleware.RequirePermission(db.PermManageUsers))
+	{
+		// 创建用户
+		adminGroup.POST("/users", func(c *gin.Context) {
+			var user db.User
+			if err := c.ShouldBindJSON(&user); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			if err := userService.CreateUser(c.Request.Context(), &user); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusCreated, gin.H{
+				"message": "用户创建成功",
+				"user":    user,
+			})
+		})
 
-		// 删除用户（需要鉴权）
-		authUserGroup.DELETE("/users/:id", func(c *gin.Context) {
+		// 获取所有用户
+		adminGroup.GET("/users", func(c *gin.Context) {
+			users, err := userService.GetAllUsers(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			// 只返回id、name和角色
+			simpleUsers := make([]map[string]interface{}, 0, len(users))
+			for _, user := range users {
+				simpleUsers = append(simpleUsers, map[string]interface{}{
+					"id":   user.ID.Hex(),
+					"name": user.Name,
+					"role": user.GetRole(),
+				})
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"users": simpleUsers,
+				"count": len(simpleUsers),
+			})
+		})
+
+		// 删除用户，不能删除自己
+		adminGroup.DELETE("/users/:id", func(c *gin.Context) {
 			id := c.Param("id")
+			if current, err := middleware.CurrentUser(c); err == nil && current.ID.Hex() == id {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "不能删除自己"})
+				return
+			}
 			if err := userService.DeleteUser(c.Request.Context(), id); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
@@ -249,10 +705,73 @@ func setupUserRoutes(router *gin.Engine, userService *db.UserService) {
 	}
 }
 
+// requireSelfOrAdmin 只允许本人或管理员访问用户信息，不满足时写入403响应
+func requireSelfOrAdmin(c *gin.Context, user *db.User) bool {
+	current, err := middleware.CurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		return false
+	}
+	if current.ID != user.ID && !current.GetRole().Can(db.PermManageUsers) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "权限不足", "permission": db.PermManageUsers})
+		return false
+	}
+	return true
+}
+
+// 登录会话路由
+func setupSessionRoutes(router *gin.Engine) {
+	authGroup := router.Group("")
+	authGroup.Use(middleware.AuthMiddleware())
+	{
+		// 当前用户的登录会话列表（需要鉴权）
+		authGroup.GET("/sessions", func(c *gin.Context) {
+			sessions, err := db.NewTokenService().ListSessions(c.Request.Context(), c.GetString("username"), c.GetString("token"))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query sessions"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"sessions": sessions, "count": len(sessions)})
+		})
+
+		// 撤销指定会话（需要鉴权）
+		authGroup.DELETE("/sessions/:id", func(c *gin.Context) {
+			if err := db.NewTokenService().RevokeSession(c.Request.Context(), c.GetString("username"), c.Param("id")); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "会话已撤销"})
+		})
+
+		// 撤销全部会话（需要鉴权），keep_current=true 时保留当前会话
+		authGroup.DELETE("/sessions", func(c *gin.Context) {
+			exceptToken := ""
+			if c.Query("keep_current") == "true" {
+				exceptToken = c.GetString("token")
+			}
+			count, err := db.NewTokenService().RevokeAllSessions(c.Request.Context(), c.GetString("username"), exceptToken)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "会话已全部撤销", "count": count})
+		})
+
+		// 退出登录，撤销当前会话（需要鉴权）
+		authGroup.POST("/logout", func(c *gin.Context) {
+			if err := db.NewTokenService().DeleteToken(c.Request.Context(), c.GetString("token")); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+		})
+	}
+}
+
 // 工具路由
 func setupToolRoutes(router *gin.Engine, verificationService *verification.VerificationCodeService) {
 	// 申请验证码（公开接口）
-	router.POST("/verification/code", func(c *gin.Context) {
+	router.POST("/verification/code", middleware.RateLimit("verification_code"), func(c *gin.Context) {
 		var request struct {
 			Name    string `json:"name" binding:"required"`
 			Channel string `json:"channel" binding:"required,oneof=qq phone"`
@@ -298,7 +817,14 @@ func setupToolRoutes(router *gin.Engine, verificationService *verification.Verif
 		}
 
 		// 校验验证码
-		isValid, err := verificationService.VerifyCode(c.Request.Context(), request.Name, request.Channel, request.Code)
+		isValid, err := verificationService.VerifyCode(c.Request.Context(), request.Name, request.Channel, request.Code, c.ClientIP())
+		if errors.Is(err, verification.ErrTooManyAttempts) {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"message": err.Error(),
+				"valid":   false,
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"message": "验证过程出错",
@@ -314,7 +840,7 @@ func setupToolRoutes(router *gin.Engine, verificationService *verification.Verif
 			defer cancel()
 
 			tokenService := db.NewTokenService()
-			userToken, err := tokenService.GenerateUserToken(ctx, request.Name, request.Channel)
+			userToken, err := tokenService.GenerateUserToken(ctx, request.Name, request.Channel, c.ClientIP(), c.Request.UserAgent())
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"message": "生成token失败",
@@ -338,7 +864,7 @@ func setupToolRoutes(router *gin.Engine, verificationService *verification.Verif
 	})
 
 	// SMS电池信息查询接口
-	router.GET("/sms/battery", func(c *gin.Context) {
+	router.GET("/sms/battery", middleware.RateLimit("sms_battery"), func(c *gin.Context) {
 		// 导入sms包
 		smsClient := sms.NewClient()
 
@@ -358,17 +884,21 @@ func setupToolRoutes(router *gin.Engine, verificationService *verification.Verif
 
 	// 创建需要鉴权的接口组
 	authGroup := router.Group("")
-	authGroup.Use(middleware.AuthMiddleware())
+	authGroup.Use(middleware.AuthMiddleware(), middleware.RequirePermission(db.PermWriteMessages))
 	{
 		// 重新生成指定 id 的forward_view 的 title（需要鉴权）
-		authGroup.GET("/rebuild_title/:id", func(c *gin.Context) {
+		authGroup.GET("/rebuild_title/:id", middleware.RateLimit("rebuild_title"), func(c *gin.Context) {
 			id := c.Param("id")
 			username := c.GetString("username")
+			if !authorizeForwardView(c, id, false) {
+				return
+			}
 
-			err := napcat_go_sdk.Rebuild_title(id, username)
+			jobId, err := napcat_go_sdk.Rebuild_title(id, username)
 			if err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{
-					"error": err.Error(),
+					"error":  err.Error(),
+					"job_id": jobId,
 				})
 				return
 			}
@@ -377,6 +907,7 @@ func setupToolRoutes(router *gin.Engine, verificationService *verification.Verif
 				"message": fmt.Sprintf("对话 %s 的重命名任务已成功发起", id),
 				"user":    username,
 				"id":      id,
+				"job_id":  jobId,
 			})
 		})
 
@@ -388,11 +919,21 @@ func setupToolRoutes(router *gin.Engine, verificationService *verification.Verif
 			username := c.GetString("username")
 			channel := c.GetString("channel")
 
+			// 私有记录只有上传者和管理员可以推送
+			visibility, err := db.NewForwardViewService().GetVisibility(c.Request.Context(), id)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+				return
+			}
+			if !authorizeForwardView(c, id, visibility == db.VisibilityPrivate) {
+				return
+			}
+
 			// 记录操作日志
 			log.Printf("用户 %s (渠道: %s) 正在推送消息到QQ，ID: %s", username, channel, id)
 
 			// 调用SDK函数
-			err := napcat_go_sdk.PushMessageViewToQQ(id)
+			err = napcat_go_sdk.PushMessageViewToQQ(id)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": fmt.Sprintf("推送消息失败: %v", err),
@@ -402,7 +943,7 @@ func setupToolRoutes(router *gin.Engine, verificationService *verification.Verif
 
 			// 发送推送通知到群
 			title, err := napcat_go_sdk.GetMessageViewTitle(id)
-			napcat_go_sdk.PushQQInform(&title, &utils.Config.InformGroup, &username)
+			napcat_go_sdk.PushQQInform(&title, &utils.Config.NapCat.InformGroup, &username)
 
 			c.JSON(http.StatusOK, gin.H{
 				"message": "消息推送成功",
@@ -412,3 +953,57 @@ func setupToolRoutes(router *gin.Engine, verificationService *verification.Verif
 		})
 	}
 }
+
+// 后台任务路由
+func setupJobRoutes(router *gin.Engine) {
+	authGroup := router.Group("")
+	authGroup.Use(middleware.AuthMiddleware(), middleware.RequirePermission(db.PermManageJobs))
+	{
+		// 任务列表，可按 state、type 筛选（需要鉴权）
+		authGroup.GET("/jobs", func(c *gin.Context) {
+			limit, err := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+			if err != nil || limit <= 0 || limit > maxPageSize {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxPageSize)})
+				return
+			}
+
+			queue := db.GetJobQueue()
+			jobs, err := queue.ListJobs(c.Request.Context(), db.JobState(c.Query("state")), c.Query("type"), limit)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query jobs"})
+				return
+			}
+			counts, err := queue.CountJobs(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count jobs"})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"jobs":   jobs,
+				"count":  len(jobs),
+				"states": counts,
+			})
+		})
+
+		// 任务详情（需要鉴权）
+		authGroup.GET("/jobs/:id", func(c *gin.Context) {
+			job, err := db.GetJobQueue().GetJob(c.Request.Context(), c.Param("id"))
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, job)
+		})
+
+		// 重试失败的任务（需要鉴权）
+		authGroup.POST("/jobs/:id/retry", func(c *gin.Context) {
+			id := c.Param("id")
+			if err := db.GetJobQueue().RetryJob(c.Request.Context(), id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "任务已重新加入队列", "id": id})
+		})
+	}
+}
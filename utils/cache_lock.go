@@ -1,109 +1,171 @@
 package utils
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"sync"
 	"time"
 )
 
-// cacheLock 本地内存缓存锁实现
-type cacheLock struct {
-	mu    sync.Mutex
-	locks map[string]int64 // 存储锁的过期时间戳
+// ErrLocked 锁已存在且未过期
+var ErrLocked = errors.New("lock already exists and is not expired")
+
+// ErrLockLost 锁已过期或已被其他持有者获取
+var ErrLockLost = errors.New("lock expired or held by another owner")
+
+// Locker 带过期时间的锁，每次上锁返回一个随机 token，只有持有 token 的一方能续期和释放
+// 多个实例部署时需要使用共享的实现（如 db.MongoLocker），否则锁只在本进程内有效
+type Locker interface {
+	// TryLock 锁不存在或已过期时上锁并返回 token，否则返回 ErrLocked
+	TryLock(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// Exists 锁是否存在且未过期
+	Exists(ctx context.Context, key string) (bool, error)
+	// Extend 将 token 持有的锁的过期时间延长为 ttl 之后，锁已过期或被他人持有时返回 ErrLockLost
+	Extend(ctx context.Context, key, token string, ttl time.Duration) error
+	// Unlock 释放 token 持有的锁，锁不存在或已被他人持有时不返回错误
+	Unlock(ctx context.Context, key, token string) error
 }
 
 var (
-	instance *cacheLock
-	once     sync.Once
+	lockerMu sync.RWMutex
+	locker   Locker = NewMemoryLocker()
 )
 
-// initCacheLock 初始化缓存锁单例
-func initCacheLock() {
-	once.Do(func() {
-		instance = &cacheLock{
-			locks: make(map[string]int64),
-		}
-	})
+// SetLocker 替换包级函数使用的锁实现，应在启动时调用
+func SetLocker(l Locker) {
+	lockerMu.Lock()
+	defer lockerMu.Unlock()
+	locker = l
 }
 
-// SetLock 创建并返回一个锁对象
-func SetLock(key string, ttl time.Duration) *cacheLock {
-	initCacheLock()
-	return &cacheLock{}
+// GetLocker 返回当前使用的锁实现
+func GetLocker() Locker {
+	lockerMu.RLock()
+	defer lockerMu.RUnlock()
+	return locker
+}
+
+// NewLockToken 生成锁的持有者 token
+func NewLockToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
 }
 
-// LockExists 检查锁是否存在且未过期（包级函数）
+// LockExists 检查锁是否存在且未过期（包级函数），查询失败时视为存在
 func LockExists(key string) bool {
-	initCacheLock()
-	return instance.lockExists(key)
+	exists, err := GetLocker().Exists(context.Background(), key)
+	return exists || err != nil
 }
 
-// DeleteLock 删除指定锁（包级函数）
-func DeleteLock(key string) {
-	initCacheLock()
-	instance.deleteLock(key)
+// DeleteLock 释放 token 持有的锁（包级函数）
+func DeleteLock(key, token string) {
+	_ = GetLocker().Unlock(context.Background(), key, token)
 }
 
-// TryLock 尝试获取锁，如果锁不存在或已过期则成功上锁，否则返回错误
-func TryLock(key string, ttl time.Duration) error {
-	initCacheLock()
-	return instance.tryLock(key, ttl)
+// ExtendLock 延长 token 持有的锁（包级函数）
+func ExtendLock(key, token string, ttl time.Duration) error {
+	return GetLocker().Extend(context.Background(), key, token, ttl)
 }
 
-// setLock 设置锁并指定过期时间（私有方法）
-func (c *cacheLock) setLock(key string, ttl time.Duration) {
+// TryLock 尝试获取锁，如果锁不存在或已过期则成功上锁并返回 token，否则返回错误
+func TryLock(key string, ttl time.Duration) (string, error) {
+	return GetLocker().TryLock(context.Background(), key, ttl)
+}
+
+// memoryLockSweepSize 锁数量超过该值时上锁前清理过期的锁
+const memoryLockSweepSize = 1024
+
+// memoryLock 内存锁的持有者和过期时间
+type memoryLock struct {
+	token    string
+	expireAt time.Time
+}
+
+// MemoryLocker 本地内存锁实现，只在单个进程内有效
+type MemoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]memoryLock
+}
+
+// NewMemoryLocker 创建内存锁
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		locks: make(map[string]memoryLock),
+	}
+}
+
+// TryLock 原子性的检查并设置锁
+func (c *MemoryLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (string, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// 计算过期时间戳（毫秒）
-	expireAt := time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
-	c.locks[key] = expireAt
+	// 检查锁是否存在且未过期
+	now := time.Now()
+	if lock, exists := c.locks[key]; exists && !now.After(lock.expireAt) {
+		return "", ErrLocked
+	}
+
+	// 只检查过的键会被清理，锁较多时顺带清理过期的锁
+	if len(c.locks) >= memoryLockSweepSize {
+		for k, lock := range c.locks {
+			if now.After(lock.expireAt) {
+				delete(c.locks, k)
+			}
+		}
+	}
+
+	// 锁不存在或已过期，设置新锁
+	token := NewLockToken()
+	c.locks[key] = memoryLock{token: token, expireAt: now.Add(ttl)}
+	return token, nil
 }
 
-// lockExists 检查锁是否存在且未过期（私有方法）
-func (c *cacheLock) lockExists(key string) bool {
+// Exists 检查锁是否存在且未过期
+func (c *MemoryLocker) Exists(ctx context.Context, key string) (bool, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	// 检查键是否存在
-	expireAt, exists := c.locks[key]
+	lock, exists := c.locks[key]
 	if !exists {
-		return false
+		return false, nil
 	}
 
 	// 检查是否已过期
-	currentTime := time.Now().UnixNano() / int64(time.Millisecond)
-	if currentTime > expireAt {
+	if time.Now().After(lock.expireAt) {
 		// 自动清理过期锁
 		delete(c.locks, key)
-		return false
+		return false, nil
 	}
-	return true
+	return true, nil
 }
 
-// deleteLock 删除指定锁（私有方法）
-func (c *cacheLock) deleteLock(key string) {
+// Extend 延长自己持有的锁
+func (c *MemoryLocker) Extend(ctx context.Context, key, token string, ttl time.Duration) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	delete(c.locks, key)
+
+	now := time.Now()
+	lock, exists := c.locks[key]
+	if !exists || lock.token != token || now.After(lock.expireAt) {
+		return ErrLockLost
+	}
+	lock.expireAt = now.Add(ttl)
+	c.locks[key] = lock
+	return nil
 }
 
-// tryLock 原子性的检查并设置锁（私有方法）
-func (c *cacheLock) tryLock(key string, ttl time.Duration) error {
+// Unlock 释放自己持有的锁
+func (c *MemoryLocker) Unlock(ctx context.Context, key, token string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-
-	// 检查锁是否存在且未过期
-	expireAt, exists := c.locks[key]
-	currentTime := time.Now().UnixNano() / int64(time.Millisecond)
-
-	if exists && currentTime <= expireAt {
-		return errors.New("lock already exists and is not expired")
+	if lock, exists := c.locks[key]; exists && lock.token == token {
+		delete(c.locks, key)
 	}
-
-	// 锁不存在或已过期，设置新锁
-	expireAt = time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
-	c.locks[key] = expireAt
-
 	return nil
 }
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryLocker(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+
+	token, err := l.TryLock(ctx, "job", time.Minute)
+	if err != nil || token == "" {
+		t.Fatalf("TryLock() = %q, %v", token, err)
+	}
+	if _, err := l.TryLock(ctx, "job", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second TryLock() error = %v, want ErrLocked", err)
+	}
+	if exists, _ := l.Exists(ctx, "job"); !exists {
+		t.Fatal("Exists() = false while locked")
+	}
+
+	// 其他持有者的 token 不能续期或释放
+	if err := l.Extend(ctx, "job", "other", time.Minute); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Extend() with wrong token error = %v, want ErrLockLost", err)
+	}
+	l.Unlock(ctx, "job", "other")
+	if exists, _ := l.Exists(ctx, "job"); !exists {
+		t.Fatal("Unlock() with wrong token released the lock")
+	}
+
+	if err := l.Extend(ctx, "job", token, time.Minute); err != nil {
+		t.Errorf("Extend() error = %v", err)
+	}
+	l.Unlock(ctx, "job", token)
+	if exists, _ := l.Exists(ctx, "job"); exists {
+		t.Fatal("Unlock() did not release the lock")
+	}
+}
+
+func TestMemoryLockerExpiry(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+
+	first, err := l.TryLock(ctx, "job", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if err := l.Extend(ctx, "job", first, time.Minute); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Extend() after expiry error = %v, want ErrLockLost", err)
+	}
+	second, err := l.TryLock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock() after expiry error = %v", err)
+	}
+	if second == first {
+		t.Fatal("TryLock() reused the previous token")
+	}
+
+	// 过期的持有者释放时不能删除新的锁
+	l.Unlock(ctx, "job", first)
+	if exists, _ := l.Exists(ctx, "job"); !exists {
+		t.Error("stale Unlock() released the new owner's lock")
+	}
+}
+
+func TestMemoryLockerConcurrent(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	acquired := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := l.TryLock(ctx, "job", time.Minute); err == nil {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if acquired != 1 {
+		t.Errorf("acquired = %d, want 1", acquired)
+	}
+}
+
+func TestMemoryLockerSweep(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLocker()
+	for i := 0; i < memoryLockSweepSize; i++ {
+		if _, err := l.TryLock(ctx, fmt.Sprintf("expired-%d", i), -time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := l.TryLock(ctx, "live", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.locks) != 1 {
+		t.Errorf("len(locks) = %d after sweep, want 1", len(l.locks))
+	}
+}
@@ -1,46 +1,523 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
-// 全局配置结构体
-var Config struct {
-	Token       string
-	AdminUIN    string
-	Text        string
-	Addr        string
-	DBURI       string
-	DBUsername  string
-	DBPassword  string
-	LLMAPIKey   string
-	Port        string
-	InformGroup string
-	APIHost     string
+// minSecretKeyLength server.secret_key 的最小长度
+const minSecretKeyLength = 16
+
+// AppConfig 应用配置
+//
+// 加载顺序：默认值 → 配置文件 → 环境对应的配置文件 → .env 和环境变量，后加载的覆盖先加载的。
+// 字段标签：env 为覆盖该项的环境变量；required 为 true 时必须配置，为环境名时只在该环境下必须配置；
+// secret 为 true 时 --print-config 隐藏该项。
+type AppConfig struct {
+	Profile   string          `yaml:"profile" toml:"profile" env:"APP_PROFILE"` // 运行环境：dev 或 prod
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	NapCat    NapCatConfig    `yaml:"napcat" toml:"napcat"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	Title     TitleConfig     `yaml:"title" toml:"title"`
+	Media     MediaConfig     `yaml:"media" toml:"media"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	SMS       SMSConfig       `yaml:"sms" toml:"sms"`
+}
+
+// ServerConfig HTTP服务
+type ServerConfig struct {
+	Port      string `yaml:"port" toml:"port" env:"PORT"`
+	APIHost   string `yaml:"api_host" toml:"api_host" env:"API_HOST"`                                     // 对外访问的地址，用于生成图片链接
+	SecretKey string `yaml:"secret_key" toml:"secret_key" env:"SECRET_KEY" required:"true" secret:"true"` // token和验证码哈希使用的密钥，至少16个字符
+
+	ShutdownTimeout int `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"` // 关闭时等待请求和任务结束的时间，单位秒
+
+	// 信任的反向代理IP或CIDR，逗号分隔；只有来自这些地址的请求才按 X-Forwarded-For 识别客户端IP，为空时不信任任何代理
+	TrustedProxies string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// TrustedProxyList 信任的反向代理列表
+func (c ServerConfig) TrustedProxyList() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(c.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// NapCatConfig NapCat（OneBot）连接和通知
+type NapCatConfig struct {
+	Mode        string `yaml:"mode" toml:"mode" env:"NAPCAT_MODE"` // ws、http 或 reverse_ws
+	Addr        string `yaml:"addr" toml:"addr" env:"ADDR"`        // ws 和 http 模式下必填，多个账号的实例用逗号分隔，可写为 host:port
+	Port        int    `yaml:"port" toml:"port" env:"NAPCAT_PORT"`
+	Token       string `yaml:"token" toml:"token" env:"TOKEN" secret:"true"`
+	AdminUIN    string `yaml:"admin_uin" toml:"admin_uin" env:"ADMIN_UIN" required:"true"`
+	InformGroup string `yaml:"inform_group" toml:"inform_group" env:"INFORM_GROUP"` // 通知群号
+	Text        string `yaml:"text" toml:"text" env:"TEXT"`                         // 启动时发给管理员的消息
+
+	NotifyBots       string `yaml:"notify_bots" toml:"notify_bots" env:"NAPCAT_NOTIFY_BOTS"`                   // 发送通知优先使用的 bot 账号，逗号分隔，按顺序切换
+	FailoverCooldown int    `yaml:"failover_cooldown" toml:"failover_cooldown" env:"NAPCAT_FAILOVER_COOLDOWN"` // 账号发送失败（如被风控）后暂停使用的时间，单位秒
+}
+
+// NotifyBotList 返回 NotifyBots 中的账号
+func (c NapCatConfig) NotifyBotList() []string {
+	var selfIds []string
+	for _, selfId := range strings.Split(c.NotifyBots, ",") {
+		if selfId = strings.TrimSpace(selfId); selfId != "" {
+			selfIds = append(selfIds, selfId)
+		}
+	}
+	return selfIds
+}
+
+// DatabaseConfig MongoDB
+type DatabaseConfig struct {
+	URI      string `yaml:"uri" toml:"uri" env:"DB_URI" required:"true" secret:"true"`
+	Username string `yaml:"username" toml:"username" env:"DB_USERNAME"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true"`
+}
+
+// TitleConfig 标题生成
+type TitleConfig struct {
+	Generators string `yaml:"generators" toml:"generators" env:"TITLE_GENERATORS"` // 标题生成器顺序，逗号分隔：openai、legacy、local
+	LLMAPIKey  string `yaml:"llm_api_key" toml:"llm_api_key" env:"LLM_APIKEY" secret:"true"`
+	LLMBaseURL string `yaml:"llm_base_url" toml:"llm_base_url" env:"LLM_BASE_URL"` // OpenAI 兼容接口地址
+	LLMModel   string `yaml:"llm_model" toml:"llm_model" env:"LLM_MODEL"`          // 模型名称
+	APIURL     string `yaml:"api_url" toml:"api_url" env:"TITLE_API_URL"`          // 旧版 ainame.py 服务地址，使用 legacy 时必填
+}
+
+// defaultTitleGenerators 默认的标题生成器顺序
+const defaultTitleGenerators = "openai,local"
+
+// GeneratorNames 标题生成器名称，忽略空项，没有配置任何生成器时使用默认顺序
+func (c TitleConfig) GeneratorNames() []string {
+	var names []string
+	for _, name := range strings.Split(c.Generators, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return strings.Split(defaultTitleGenerators, ",")
+	}
+	return names
+}
+
+// MediaConfig 媒体存储
+type MediaConfig struct {
+	Store string   `yaml:"store" toml:"store" env:"MEDIA_STORE"` // local 或 s3
+	Dir   string   `yaml:"dir" toml:"dir" env:"MEDIA_DIR"`       // 本地存储目录
+	S3    S3Config `yaml:"s3" toml:"s3"`
+
+	Download string `yaml:"download" toml:"download" env:"MEDIA_DOWNLOAD"` // 收到消息时保存的消息段类型，逗号分隔：image、record、video、file
+	MaxSize  int    `yaml:"max_size" toml:"max_size" env:"MEDIA_MAX_SIZE"` // 单个文件大小上限，单位MB，超过时不保存
 }
 
+// DownloadTypes 收到消息时保存的消息段类型
+func (c MediaConfig) DownloadTypes() []string {
+	var types []string
+	for _, t := range strings.Split(c.Download, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// MaxBytes 单个文件大小上限，单位字节
+func (c MediaConfig) MaxBytes() int64 {
+	return int64(c.MaxSize) << 20
+}
+
+// S3Config S3 兼容的对象存储
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint" toml:"endpoint" env:"S3_ENDPOINT"`
+	Region    string `yaml:"region" toml:"region" env:"S3_REGION"`
+	Bucket    string `yaml:"bucket" toml:"bucket" env:"S3_BUCKET"`
+	AccessKey string `yaml:"access_key" toml:"access_key" env:"S3_ACCESS_KEY"`
+	SecretKey string `yaml:"secret_key" toml:"secret_key" env:"S3_SECRET_KEY" secret:"true"`
+}
+
+// RateLimitConfig 限流
+type RateLimitConfig struct {
+	Policies string `yaml:"policies" toml:"policies" env:"RATE_LIMITS"` // 限流策略，格式见 ParseRateLimitPolicies
+	Store    string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE"`  // memory 或 mongo
+}
+
+// SMSConfig 短信网关
+type SMSConfig struct {
+	BaseURL    string `yaml:"base_url" toml:"base_url" env:"SMS_BASE_URL"`
+	Secret     string `yaml:"secret" toml:"secret" env:"SMS_SECRET" secret:"true"`
+	Encryption string `yaml:"encryption" toml:"encryption" env:"SMS_ENCRYPTION"` // plain、rsa 或 sm4
+	PublicKey  string `yaml:"public_key" toml:"public_key" env:"SMS_PUBLIC_KEY"`
+	PrivateKey string `yaml:"private_key" toml:"private_key" env:"SMS_PRIVATE_KEY" secret:"true"`
+	SM4Key     string `yaml:"sm4_key" toml:"sm4_key" env:"SMS_SM4_KEY" secret:"true"`
+	Timeout    int    `yaml:"timeout" toml:"timeout" env:"SMS_TIMEOUT"` // 请求超时，单位秒
+
+	HealthCheck bool `yaml:"health_check" toml:"health_check" env:"SMS_HEALTH_CHECK"` // 健康检查是否访问短信网关
+}
+
+// 全局配置
+var Config = DefaultConfig()
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() AppConfig {
+	return AppConfig{
+		Profile: "dev",
+		Server: ServerConfig{
+			Port:            "8080",
+			ShutdownTimeout: 30,
+		},
+		NapCat: NapCatConfig{
+			Mode:             "ws",
+			Port:             3001,
+			FailoverCooldown: 600,
+		},
+		Title: TitleConfig{
+			Generators: defaultTitleGenerators,
+			LLMBaseURL: "https://api-inference.modelscope.cn/v1/",
+			LLMModel:   "deepseek-ai/DeepSeek-R1-0528",
+		},
+		Media: MediaConfig{
+			Store:    "local",
+			Dir:      "./pics",
+			Download: "image,record,video,file",
+			MaxSize:  50,
+		},
+		RateLimit: RateLimitConfig{
+			Policies: defaultRateLimits,
+			Store:    "memory",
+		},
+		SMS: SMSConfig{
+			BaseURL:    "http://localhost:5000",
+			Encryption: "plain",
+			Timeout:    30,
+		},
+	}
+}
+
+// ConfigOptions 配置加载选项，为空时从环境变量 CONFIG_FILE、APP_PROFILE 读取
+type ConfigOptions struct {
+	File    string // 配置文件路径，未指定时依次查找 config.yaml、config.yml、config.toml
+	Profile string // 运行环境，会额外加载同目录下的 config.<profile>.yaml 等文件
+}
+
+// defaultConfigFiles 未指定配置文件时查找的文件
+var defaultConfigFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
 // LoadConfig 加载配置并初始化全局Config
 func LoadConfig() error {
+	return LoadConfigWithOptions(ConfigOptions{})
+}
+
+// LoadConfigWithOptions 按选项加载配置，校验失败时返回所有错误
+func LoadConfigWithOptions(opts ConfigOptions) error {
 	_ = godotenv.Load() // 加载.env文件
 
-	// 初始化全局配置
-	Config.Token = os.Getenv("TOKEN")
-	Config.AdminUIN = os.Getenv("ADMIN_UIN")
-	Config.Text = os.Getenv("TEXT")
-	Config.Addr = os.Getenv("ADDR")
-	Config.DBURI = os.Getenv("DB_URI")
-	Config.DBUsername = os.Getenv("DB_USERNAME")
-	Config.DBPassword = os.Getenv("DB_PASSWORD")
-	Config.LLMAPIKey = os.Getenv("LLM_APIKEY")
-	Config.Port = os.Getenv("PORT")
-	Config.InformGroup = os.Getenv("INFORM_GROUP")
-	Config.APIHost = os.Getenv("API_HOST")
+	cfg := DefaultConfig()
+
+	file := opts.File
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	explicit := file != ""
+	if !explicit {
+		for _, name := range defaultConfigFiles {
+			if _, err := os.Stat(name); err == nil {
+				file = name
+				break
+			}
+		}
+	}
+	// 指定的配置文件不存在时，只要有对应运行环境的配置文件也可以启动
+	var missing error
+	if file != "" {
+		if err := decodeConfigFile(file, &cfg); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if explicit {
+				missing = err
+			}
+		}
+	}
 
+	// 运行环境：参数 > 环境变量 > 配置文件
+	profile := opts.Profile
+	if profile == "" {
+		profile = os.Getenv("APP_PROFILE")
+	}
+	if profile == "" {
+		profile = cfg.Profile
+	}
+	if profile != "" {
+		// 没有基础配置文件时按默认文件名查找 config.<profile>.yaml 等文件
+		bases := defaultConfigFiles
+		if file != "" {
+			bases = []string{file}
+		}
+		for _, base := range bases {
+			ext := filepath.Ext(base)
+			err := decodeConfigFile(strings.TrimSuffix(base, ext)+"."+profile+ext, &cfg)
+			if err == nil {
+				missing = nil
+				break
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	if missing != nil {
+		return missing
+	}
+
+	envErr := applyEnv(reflect.ValueOf(&cfg).Elem())
+	cfg.Profile = profile
+
+	if err := errors.Join(envErr, cfg.Validate()); err != nil {
+		return err
+	}
+
+	Config = cfg
+	policies, _ := ParseRateLimitPolicies(Config.RateLimit.Policies)
+	SetRateLimitPolicies(policies)
+	return nil
+}
+
+// decodeConfigFile 按扩展名解析 YAML 或 TOML 配置文件，文件中未出现的项保持原值
+func decodeConfigFile(path string, cfg *AppConfig) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+		}
+	case ".toml":
+		decoder := toml.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(cfg); err != nil {
+			var strictErr *toml.StrictMissingError
+			if errors.As(err, &strictErr) {
+				return fmt.Errorf("配置文件 %s 包含未知的配置项:\n%s", path, strictErr.String())
+			}
+			return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s", path)
+	}
 	return nil
 }
 
+// applyEnv 用 env 标签对应的环境变量覆盖配置
+func applyEnv(v reflect.Value) error {
+	var errs []error
+	walkConfig(v, "", func(field reflect.StructField, value reflect.Value, path string) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		raw, exists := os.LookupEnv(name)
+		if !exists {
+			return
+		}
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString(raw)
+		case reflect.Int:
+			n, err := strconv.Atoi(strings.TrimSpace(raw))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("环境变量 %s 必须是整数: %q", name, raw))
+				return
+			}
+			value.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(strings.TrimSpace(raw))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("环境变量 %s 必须是布尔值: %q", name, raw))
+				return
+			}
+			value.SetBool(b)
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// walkConfig 遍历配置的所有叶子字段，path 为配置文件中的键，如 napcat.addr
+func walkConfig(v reflect.Value, prefix string, fn func(field reflect.StructField, value reflect.Value, path string)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if field.Type.Kind() == reflect.Struct {
+			walkConfig(v.Field(i), path, fn)
+			continue
+		}
+		fn(field, v.Field(i), path)
+	}
+}
+
+// Validate 校验配置，返回所有不合法的项
+func (c *AppConfig) Validate() error {
+	var errs []error
+
+	switch c.Profile {
+	case "dev", "prod":
+	default:
+		errs = append(errs, fmt.Errorf("profile 必须是 dev 或 prod: %q", c.Profile))
+	}
+
+	walkConfig(reflect.ValueOf(c).Elem(), "", func(field reflect.StructField, value reflect.Value, path string) {
+		required := field.Tag.Get("required")
+		if required != "true" && required != c.Profile {
+			return
+		}
+		if value.IsZero() {
+			if env := field.Tag.Get("env"); env != "" {
+				errs = append(errs, fmt.Errorf("缺少必需配置 %s（环境变量 %s）", path, env))
+			} else {
+				errs = append(errs, fmt.Errorf("缺少必需配置 %s", path))
+			}
+		}
+	})
+
+	if n := len(c.Server.SecretKey); n > 0 && n < minSecretKeyLength {
+		errs = append(errs, fmt.Errorf("server.secret_key 至少需要%d个字符: 当前%d个", minSecretKeyLength, n))
+	}
+	for _, proxy := range c.Server.TrustedProxyList() {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies 包含无效的IP或CIDR: %q", proxy))
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("server.shutdown_timeout 必须大于0: %d", c.Server.ShutdownTimeout))
+	}
+	switch c.NapCat.Mode {
+	case "ws", "http":
+		if c.NapCat.Addr == "" {
+			errs = append(errs, fmt.Errorf("napcat.mode 为 %s 时必须配置 napcat.addr", c.NapCat.Mode))
+		}
+	case "reverse_ws":
+		if c.NapCat.Token == "" {
+			errs = append(errs, errors.New("napcat.mode 为 reverse_ws 时必须配置 napcat.token"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("napcat.mode 必须是 ws、http 或 reverse_ws: %q", c.NapCat.Mode))
+	}
+	for _, selfId := range c.NapCat.NotifyBotList() {
+		if _, err := strconv.ParseInt(selfId, 10, 64); err != nil {
+			errs = append(errs, fmt.Errorf("napcat.notify_bots 包含无效的QQ号: %q", selfId))
+		}
+	}
+	if c.NapCat.FailoverCooldown <= 0 {
+		errs = append(errs, fmt.Errorf("napcat.failover_cooldown 必须大于0: %d", c.NapCat.FailoverCooldown))
+	}
+	if c.NapCat.Port <= 0 || c.NapCat.Port > 65535 {
+		errs = append(errs, fmt.Errorf("napcat.port 无效: %d", c.NapCat.Port))
+	}
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port <= 0 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port 无效: %q", c.Server.Port))
+	}
+
+	for _, name := range c.Title.GeneratorNames() {
+		switch name {
+		case "openai", "local":
+		case "legacy":
+			if c.Title.APIURL == "" {
+				errs = append(errs, errors.New("title.generators 包含 legacy 时必须配置 title.api_url"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("title.generators 包含未知的生成器: %q", name))
+		}
+	}
+
+	switch c.Media.Store {
+	case "local":
+	case "s3":
+		if c.Media.S3.Endpoint == "" || c.Media.S3.Bucket == "" {
+			errs = append(errs, errors.New("media.store 为 s3 时必须配置 media.s3.endpoint 和 media.s3.bucket"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("media.store 必须是 local 或 s3: %q", c.Media.Store))
+	}
+
+	for _, t := range c.Media.DownloadTypes() {
+		switch t {
+		case "image", "record", "video", "file":
+		default:
+			errs = append(errs, fmt.Errorf("media.download 包含未知的类型: %q", t))
+		}
+	}
+	if c.Media.MaxSize <= 0 {
+		errs = append(errs, fmt.Errorf("media.max_size 必须大于0: %d", c.Media.MaxSize))
+	}
+
+	switch c.RateLimit.Store {
+	case "memory", "mongo":
+	default:
+		errs = append(errs, fmt.Errorf("rate_limit.store 必须是 memory 或 mongo: %q", c.RateLimit.Store))
+	}
+	if _, err := ParseRateLimitPolicies(c.RateLimit.Policies); err != nil {
+		errs = append(errs, fmt.Errorf("rate_limit.policies: %w", err))
+	}
+
+	switch c.SMS.Encryption {
+	case "plain", "rsa", "sm4":
+	default:
+		errs = append(errs, fmt.Errorf("sms.encryption 必须是 plain、rsa 或 sm4: %q", c.SMS.Encryption))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Redacted 返回隐藏了密钥等敏感项的配置副本
+func (c AppConfig) Redacted() AppConfig {
+	walkConfig(reflect.ValueOf(&c).Elem(), "", func(field reflect.StructField, value reflect.Value, path string) {
+		if field.Tag.Get("secret") == "true" && value.Kind() == reflect.String && value.String() != "" {
+			value.SetString("******")
+		}
+	})
+	return c
+}
+
+// PrintConfig 以 YAML 格式输出当前配置，敏感项已隐藏
+func PrintConfig(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(Config.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
 // GetConfig 获取配置值（兼容旧版）
 func GetConfig(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// cqCodePattern 匹配 raw_message 中的 CQ 码，如 [CQ:image,file=xxx]
+var cqCodePattern = regexp.MustCompile(`\[CQ:[^\]]*\]`)
+
+// StripCQCode 去掉CQ码，只保留文本
+func StripCQCode(raw string) string {
+	return strings.TrimSpace(cqCodePattern.ReplaceAllString(raw, " "))
+}
+
+// CQSegment 从 raw_message 中解析出的消息段，文本的 Type 为 text，内容在 Data["text"] 中
+type CQSegment struct {
+	Type string
+	Data map[string]string
+}
+
+// cqUnescaper CQ码中的转义字符
+var cqUnescaper = strings.NewReplacer("&#44;", ",", "&#91;", "[", "&#93;", "]", "&amp;", "&")
+
+// ParseCQCode 将 raw_message 解析为文本和CQ码消息段，用于没有结构化消息段的历史数据
+func ParseCQCode(raw string) []CQSegment {
+	var segments []CQSegment
+	appendText := func(text string) {
+		if text != "" {
+			segments = append(segments, CQSegment{Type: "text", Data: map[string]string{"text": cqUnescaper.Replace(text)}})
+		}
+	}
+
+	pos := 0
+	for _, loc := range cqCodePattern.FindAllStringIndex(raw, -1) {
+		appendText(raw[pos:loc[0]])
+		pos = loc[1]
+
+		// 去掉 [CQ: 和 ]
+		fields := strings.Split(raw[loc[0]+4:loc[1]-1], ",")
+		segment := CQSegment{Type: fields[0], Data: make(map[string]string)}
+		for _, field := range fields[1:] {
+			if key, value, ok := strings.Cut(field, "="); ok {
+				segment.Data[key] = cqUnescaper.Replace(value)
+			}
+		}
+		segments = append(segments, segment)
+	}
+	appendText(raw[pos:])
+	return segments
+}
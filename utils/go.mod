@@ -2,5 +2,10 @@ module snail.local/snailllllll/utils
 
 go 1.24.2
 
-require github.com/joho/godotenv v1.5.1
+require (
+	github.com/joho/godotenv v1.5.1
+	github.com/pelletier/go-toml/v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 replace snail.local/snailllllll/napcat_go_sdk => ./napcat_go_sdk
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrMediaNotFound 媒体文件不存在
+var ErrMediaNotFound = errors.New("media not found")
+
+// ErrMediaTooLarge 媒体文件超过大小上限
+var ErrMediaTooLarge = errors.New("media too large")
+
+// MediaStore 媒体文件存储，key 为内容的 SHA-256 加扩展名
+type MediaStore interface {
+	// Name 存储名称，用于日志
+	Name() string
+	// Put 保存文件，相同 key 重复保存时覆盖
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get 读取文件，不存在时返回 ErrMediaNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists 文件是否存在
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// NewMediaStoreFromConfig 根据 MEDIA_STORE 配置创建存储：local（默认）或 s3
+func NewMediaStoreFromConfig() (MediaStore, error) {
+	switch Config.Media.Store {
+	case "", "local":
+		return &LocalMediaStore{Dir: Config.Media.Dir}, nil
+	case "s3":
+		if Config.Media.S3.Endpoint == "" || Config.Media.S3.Bucket == "" {
+			return nil, errors.New("media.s3.endpoint 和 media.s3.bucket 不能为空")
+		}
+		return NewS3MediaStore(Config.Media.S3.Endpoint, Config.Media.S3.Region, Config.Media.S3.Bucket, Config.Media.S3.AccessKey, Config.Media.S3.SecretKey), nil
+	default:
+		return nil, fmt.Errorf("未知的媒体存储类型: %s", Config.Media.Store)
+	}
+}
+
+// LocalMediaStore 本地文件系统存储
+// 文件按 key 的前两个字符分目录保存，避免单个目录下文件过多
+type LocalMediaStore struct {
+	Dir string
+}
+
+func (s *LocalMediaStore) Name() string {
+	return "local"
+}
+
+// path 返回 key 对应的文件路径
+func (s *LocalMediaStore) path(key string) (string, error) {
+	if len(key) < 2 || key != filepath.Base(key) {
+		return "", fmt.Errorf("无效的媒体key: %s", key)
+	}
+	return filepath.Join(s.Dir, key[:2], key), nil
+}
+
+func (s *LocalMediaStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+
+	// 先写临时文件再重命名，避免读到写了一半的文件
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalMediaStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrMediaNotFound
+	}
+	return file, err
+}
+
+func (s *LocalMediaStore) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 简单的 Prometheus 文本格式指标，只实现计数器、直方图和按需读取的仪表
+
+// DefaultBuckets HTTP延迟直方图的默认分桶，单位秒
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric 可以输出为 Prometheus 文本格式的指标
+type metric interface {
+	metricName() string
+	write(w *bufio.Writer)
+}
+
+var (
+	metricsMu sync.RWMutex
+	metrics   = map[string]metric{}
+)
+
+// register 注册指标，同名指标重复注册时 panic
+func register(m metric) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if _, exists := metrics[m.metricName()]; exists {
+		panic("指标重复注册: " + m.metricName())
+	}
+	metrics[m.metricName()] = m
+}
+
+// WriteMetrics 以 Prometheus 文本格式输出所有指标
+func WriteMetrics(w io.Writer) error {
+	metricsMu.RLock()
+	list := make([]metric, 0, len(metrics))
+	for _, m := range metrics {
+		list = append(list, m)
+	}
+	metricsMu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].metricName() < list[j].metricName() })
+
+	buf := bufio.NewWriter(w)
+	for _, m := range list {
+		m.write(buf)
+	}
+	return buf.Flush()
+}
+
+// labelSet 一组标签值及其在 Prometheus 中的文本形式
+type labelSet struct {
+	values []string
+	text   string
+}
+
+// newLabelSet 校验标签值数量并生成 {a="x",b="y"}
+func newLabelSet(names, values []string) labelSet {
+	if len(names) != len(values) {
+		panic(fmt.Sprintf("标签数量不匹配: 需要 %d 个，实际 %d 个", len(names), len(values)))
+	}
+	if len(names) == 0 {
+		return labelSet{}
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return labelSet{values: values, text: "{" + strings.Join(pairs, ",") + "}"}
+}
+
+// withLabel 在已有标签后追加一个标签，用于直方图的 le
+func (l labelSet) withLabel(name, value string) string {
+	pair := name + `="` + escapeLabel(value) + `"`
+	if l.text == "" {
+		return "{" + pair + "}"
+	}
+	return l.text[:len(l.text)-1] + "," + pair + "}"
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels labelSet
+	value  float64
+}
+
+// NewCounter 创建并注册计数器
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: map[string]*counterValue{}}
+	register(c)
+	return c
+}
+
+// Inc 计数加1，标签值按创建时的标签顺序传入
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add 计数增加 v，v 不能为负
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.values[key]
+	if !ok {
+		value = &counterValue{labels: newLabelSet(c.labels, labelValues)}
+		c.values[key] = value
+	}
+	value.value += v
+}
+
+func (c *Counter) metricName() string { return c.name }
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		value := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, value.labels.text, formatFloat(value.value))
+	}
+}
+
+// Histogram 直方图
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels labelSet
+	counts []uint64 // 每个分桶的累计数量
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram 创建并注册直方图，buckets 为递增的分桶上界
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, values: map[string]*histogramValue{}}
+	register(h)
+	return h
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogramValue{labels: newLabelSet(h.labels, labelValues), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = value
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			value.counts[i]++
+		}
+	}
+	value.count++
+	value.sum += v
+}
+
+func (h *Histogram) metricName() string { return h.name }
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		value := h.values[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, value.labels.withLabel("le", formatFloat(upper)), value.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, value.labels.withLabel("le", "+Inf"), value.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, value.labels.text, formatFloat(value.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, value.labels.text, value.count)
+	}
+}
+
+// GaugeFunc 输出时调用函数读取当前值的仪表
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewGaugeFunc 创建并注册仪表
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) metricName() string { return g.name }
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// render 输出单个指标
+func render(m metric) string {
+	var sb strings.Builder
+	w := bufio.NewWriter(&sb)
+	m.write(w)
+	w.Flush()
+	return sb.String()
+}
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_counter_total", "test counter", "method", "path")
+	c.Inc("GET", "/a")
+	c.Add(2, "GET", "/a")
+	c.Add(-1, "GET", "/a")
+	c.Inc("POST", `/"b"`)
+
+	want := `# HELP test_counter_total test counter
+# TYPE test_counter_total counter
+test_counter_total{method="GET",path="/a"} 3
+test_counter_total{method="POST",path="/\"b\""} 1
+`
+	if got := render(c); got != want {
+		t.Errorf("counter output:\n%s\nwant:\n%s", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with wrong label count should panic")
+		}
+	}()
+	c.Inc("GET")
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "test histogram", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	want := `# HELP test_duration_seconds test histogram
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{le="0.1"} 1
+test_duration_seconds_bucket{le="1"} 2
+test_duration_seconds_bucket{le="+Inf"} 3
+test_duration_seconds_sum 2.55
+test_duration_seconds_count 3
+`
+	if got := render(h); got != want {
+		t.Errorf("histogram output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	NewGaugeFunc("test_gauge", "test gauge", func() float64 { return 42 })
+
+	var sb strings.Builder
+	if err := WriteMetrics(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "test_gauge 42\n") {
+		t.Errorf("WriteMetrics() missing gauge:\n%s", sb.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate registration should panic")
+		}
+	}()
+	NewGaugeFunc("test_gauge", "test gauge", func() float64 { return 0 })
+}
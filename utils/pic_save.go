@@ -4,10 +4,12 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // 定义响应数据结构
@@ -22,6 +24,7 @@ type PicResponse struct {
 }
 
 // 保存Base64图片到本地文件
+// Deprecated: 使用 db.MediaService 按内容去重保存
 func SaveBase64ToFile(jsonStr, filename string) error {
 	// 如果outputPath为空，设置为当前目录下的pics文件夹
 	// todo: 存储路径从配置设置
@@ -62,36 +65,64 @@ func SaveBase64ToFile(jsonStr, filename string) error {
 	return nil
 }
 
-// DownloadImageFromURL downloads an image from the given URL and saves it to a file
-func DownloadImageFromURL(url, filename string) error {
+// DownloadBytes 下载URL内容
+func DownloadBytes(url string) ([]byte, error) {
+	return DownloadBytesLimit(url, 0)
+}
+
+// DownloadBytesLimit 下载URL内容，limit 大于0时超过该字节数返回 ErrMediaTooLarge
+func DownloadBytesLimit(url string, limit int64) ([]byte, error) {
 	// 替换 https协议到 http
-	if url[:5] == "https" {
+	if strings.HasPrefix(url, "https") {
 		url = url[:4] + url[5:]
 	}
-	fmt.Printf("开始下载图片: %s\n", url)
-	// If filename is empty, use a default name
-	if filename == "" {
-		filename = "downloaded_image.png"
-	}
-
-	outputPath := filepath.Join(".", "pics", filename)
+	fmt.Printf("开始下载: %s\n", url)
 
 	// Make HTTP GET request
 	resp, err := http.Get(url)
 	if err != nil {
-		return fmt.Errorf("HTTP请求失败: %v", err)
+		return nil, fmt.Errorf("HTTP请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP请求返回非200状态码: %s", resp.Status)
+		return nil, fmt.Errorf("HTTP请求返回非200状态码: %s", resp.Status)
+	}
+
+	if limit > 0 && resp.ContentLength > limit {
+		return nil, ErrMediaTooLarge
+	}
+	var body io.Reader = resp.Body
+	if limit > 0 {
+		// 没有 Content-Length 时多读一个字节判断是否超限
+		body = io.LimitReader(resp.Body, limit+1)
 	}
 
 	// Read response body
-	data, err := ioutil.ReadAll(resp.Body)
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应数据失败: %v", err)
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, ErrMediaTooLarge
+	}
+	return data, nil
+}
+
+// DownloadImageFromURL downloads an image from the given URL and saves it to a file
+// Deprecated: 使用 db.MediaService 按内容去重保存
+func DownloadImageFromURL(url, filename string) error {
+	// If filename is empty, use a default name
+	if filename == "" {
+		filename = "downloaded_image.png"
+	}
+
+	outputPath := filepath.Join(".", "pics", filename)
+
+	data, err := DownloadBytes(url)
 	if err != nil {
-		return fmt.Errorf("读取响应数据失败: %v", err)
+		return err
 	}
 
 	// Ensure output directory exists
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadBytesLimit(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// 分块传输时没有 Content-Length
+			w.Write([]byte(body[:50]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(body[50:]))
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/", "/chunked"} {
+		data, err := DownloadBytesLimit(server.URL+path, 100)
+		if err != nil || len(data) != 100 {
+			t.Errorf("DownloadBytesLimit(%s, 100) = %d bytes, %v", path, len(data), err)
+		}
+		if _, err := DownloadBytesLimit(server.URL+path, 99); !errors.Is(err, ErrMediaTooLarge) {
+			t.Errorf("DownloadBytesLimit(%s, 99) error = %v, want ErrMediaTooLarge", path, err)
+		}
+	}
+
+	data, err := DownloadBytes(server.URL)
+	if err != nil || len(data) != 100 {
+		t.Errorf("DownloadBytes() = %d bytes, %v", len(data), err)
+	}
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitKey 限流的统计维度
+type RateLimitKey string
+
+const (
+	RateLimitByIP    RateLimitKey = "ip"    // 按客户端IP
+	RateLimitByUser  RateLimitKey = "user"  // 按登录用户，未登录时按IP
+	RateLimitByRoute RateLimitKey = "route" // 按接口，所有调用方共享
+)
+
+// RateLimitPolicy 令牌桶限流策略
+// 桶容量为 Burst，每 Period 补充 Limit 个令牌
+type RateLimitPolicy struct {
+	Name   string
+	Key    RateLimitKey
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// Rate 每秒补充的令牌数
+func (p RateLimitPolicy) Rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// String 配置格式的策略描述
+func (p RateLimitPolicy) String() string {
+	return fmt.Sprintf("%s=%s:%d/%s:%d", p.Name, p.Key, p.Limit, p.Period, p.Burst)
+}
+
+// defaultRateLimits 未配置 RATE_LIMITS 时使用的策略
+const defaultRateLimits = "sms_battery=ip:6/m,rebuild_title=user:10/h:3,verification_code=ip:10/h:3"
+
+var (
+	rateLimitMu       sync.RWMutex
+	rateLimitPolicies map[string]RateLimitPolicy
+	rateLimitStore    RateLimitStore = NewMemoryRateLimitStore()
+)
+
+// ParseRateLimitPolicies 解析限流策略配置
+// 格式为逗号分隔的 名称=维度:次数/周期[:突发]，周期为 s、m、h、d 或 time.Duration 格式，
+// 例如 sms_battery=ip:6/m,rebuild_title=user:10/h:3；突发省略时等于次数
+func ParseRateLimitPolicies(spec string) (map[string]RateLimitPolicy, error) {
+	policies := make(map[string]RateLimitPolicy)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		policy, err := parseRateLimitPolicy(item)
+		if err != nil {
+			return nil, err
+		}
+		policies[policy.Name] = policy
+	}
+	return policies, nil
+}
+
+func parseRateLimitPolicy(item string) (RateLimitPolicy, error) {
+	name, rule, ok := strings.Cut(item, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return RateLimitPolicy{}, fmt.Errorf("限流策略格式错误: %s", item)
+	}
+
+	parts := strings.Split(strings.TrimSpace(rule), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return RateLimitPolicy{}, fmt.Errorf("限流策略 %s 格式错误: %s", name, rule)
+	}
+
+	policy := RateLimitPolicy{Name: name, Key: RateLimitKey(parts[0])}
+	switch policy.Key {
+	case RateLimitByIP, RateLimitByUser, RateLimitByRoute:
+	default:
+		return RateLimitPolicy{}, fmt.Errorf("限流策略 %s 的维度无效: %s", name, parts[0])
+	}
+
+	limit, period, ok := strings.Cut(parts[1], "/")
+	if !ok {
+		return RateLimitPolicy{}, fmt.Errorf("限流策略 %s 缺少周期: %s", name, parts[1])
+	}
+	var err error
+	if policy.Limit, err = strconv.Atoi(limit); err != nil || policy.Limit <= 0 {
+		return RateLimitPolicy{}, fmt.Errorf("限流策略 %s 的次数无效: %s", name, limit)
+	}
+	if policy.Period, err = parseRatePeriod(period); err != nil {
+		return RateLimitPolicy{}, fmt.Errorf("限流策略 %s 的周期无效: %s", name, period)
+	}
+
+	policy.Burst = policy.Limit
+	if len(parts) == 3 {
+		if policy.Burst, err = strconv.Atoi(parts[2]); err != nil || policy.Burst <= 0 {
+			return RateLimitPolicy{}, fmt.Errorf("限流策略 %s 的突发值无效: %s", name, parts[2])
+		}
+	}
+	return policy, nil
+}
+
+func parseRatePeriod(period string) (time.Duration, error) {
+	switch period {
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	case "d":
+		return 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(period)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("周期必须大于0")
+	}
+	return d, err
+}
+
+// SetRateLimitPolicies 替换限流策略
+func SetRateLimitPolicies(policies map[string]RateLimitPolicy) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	rateLimitPolicies = policies
+}
+
+// GetRateLimitPolicy 按名称获取限流策略
+func GetRateLimitPolicy(name string) (RateLimitPolicy, bool) {
+	rateLimitMu.RLock()
+	defer rateLimitMu.RUnlock()
+	policy, ok := rateLimitPolicies[name]
+	return policy, ok
+}
+
+// RateLimitStore 令牌桶存储
+// 多个实例部署时需要使用共享的实现（如 db.MongoRateLimitStore），否则每个实例单独计数
+type RateLimitStore interface {
+	// Take 从 key 对应的桶中取一个令牌，桶不存在时按满桶创建
+	// 令牌不足时返回 false 和需要等待的时间
+	Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error)
+}
+
+// SetRateLimitStore 替换限流使用的存储，应在启动时调用
+func SetRateLimitStore(store RateLimitStore) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	rateLimitStore = store
+}
+
+// GetRateLimitStore 返回当前使用的限流存储
+func GetRateLimitStore() RateLimitStore {
+	rateLimitMu.RLock()
+	defer rateLimitMu.RUnlock()
+	return rateLimitStore
+}
+
+// RetryAfter 令牌数不足1时，按补充速度计算需要等待的时间
+func RetryAfter(tokens, rate float64) time.Duration {
+	if tokens >= 1 || rate <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - tokens) / rate * float64(time.Second)))
+}
+
+// memoryBucket 内存中的令牌桶
+type memoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time // 桶补满的时间，之后可以删除
+}
+
+// MemoryRateLimitStore 本地内存令牌桶，只在单个进程内有效
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore 创建内存令牌桶存储
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*memoryBucket),
+	}
+}
+
+// Take 从桶中取一个令牌
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(burst), updatedAt: now}
+		s.buckets[key] = bucket
+	}
+
+	// 按经过的时间补充令牌
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.updatedAt).Seconds()*rate)
+	bucket.updatedAt = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	bucket.fullAt = now.Add(time.Duration((float64(burst) - bucket.tokens) / rate * float64(time.Second)))
+	return allowed, RetryAfter(bucket.tokens, rate), nil
+}
+
+// sweep 每分钟清理一次已经补满的桶，满桶和不存在的桶等价
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, bucket := range s.buckets {
+		if now.After(bucket.fullAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitPolicies(t *testing.T) {
+	policies, err := ParseRateLimitPolicies(" sms_battery=ip:6/m , rebuild_title=user:10/h:3,export=route:5/30s,,daily=user:100/d")
+	if err != nil {
+		t.Fatalf("ParseRateLimitPolicies() error = %v", err)
+	}
+	want := map[string]RateLimitPolicy{
+		"sms_battery":   {Name: "sms_battery", Key: RateLimitByIP, Limit: 6, Period: time.Minute, Burst: 6},
+		"rebuild_title": {Name: "rebuild_title", Key: RateLimitByUser, Limit: 10, Period: time.Hour, Burst: 3},
+		"export":        {Name: "export", Key: RateLimitByRoute, Limit: 5, Period: 30 * time.Second, Burst: 5},
+		"daily":         {Name: "daily", Key: RateLimitByUser, Limit: 100, Period: 24 * time.Hour, Burst: 100},
+	}
+	if len(policies) != len(want) {
+		t.Fatalf("ParseRateLimitPolicies() = %v", policies)
+	}
+	for name, policy := range want {
+		if policies[name] != policy {
+			t.Errorf("policy %s = %+v, want %+v", name, policies[name], policy)
+		}
+	}
+
+	if _, err := ParseRateLimitPolicies(defaultRateLimits); err != nil {
+		t.Errorf("default policies invalid: %v", err)
+	}
+
+	for _, spec := range []string{
+		"nameonly",
+		"=ip:1/m",
+		"a=ip",
+		"a=ip:1",
+		"a=host:1/m",
+		"a=ip:0/m",
+		"a=ip:x/m",
+		"a=ip:1/week",
+		"a=ip:1/-1s",
+		"a=ip:1/m:0",
+		"a=ip:1/m:3:4",
+	} {
+		if _, err := ParseRateLimitPolicies(spec); err == nil {
+			t.Errorf("ParseRateLimitPolicies(%q) should fail", spec)
+		}
+	}
+}
+
+func TestRateLimitPolicyString(t *testing.T) {
+	policy := RateLimitPolicy{Name: "a", Key: RateLimitByIP, Limit: 6, Period: time.Minute, Burst: 2}
+	if policy.Rate() != 0.1 {
+		t.Errorf("Rate() = %v, want 0.1", policy.Rate())
+	}
+	parsed, err := ParseRateLimitPolicies(policy.String())
+	if err != nil || parsed["a"] != policy {
+		t.Errorf("round trip of %s = %+v, %v", policy, parsed["a"], err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if got := RetryAfter(1, 1); got != 0 {
+		t.Errorf("RetryAfter(1, 1) = %v, want 0", got)
+	}
+	if got := RetryAfter(0.5, 0.1); got != 5*time.Second {
+		t.Errorf("RetryAfter(0.5, 0.1) = %v, want 5s", got)
+	}
+	if got := RetryAfter(0, 0); got != 0 {
+		t.Errorf("RetryAfter(0, 0) = %v, want 0", got)
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRateLimitStore()
+	// 每秒补充1000个令牌，便于测试补充
+	rate, burst := 1000.0, 3
+
+	for i := 0; i < burst; i++ {
+		if ok, _, err := store.Take(ctx, "a", 0.001, burst); !ok || err != nil {
+			t.Fatalf("Take() #%d = %v, %v", i, ok, err)
+		}
+	}
+	ok, retryAfter, _ := store.Take(ctx, "a", 0.001, burst)
+	if ok || retryAfter <= 0 {
+		t.Errorf("Take() on empty bucket = %v, retry after %v", ok, retryAfter)
+	}
+	// 不同的 key 使用独立的桶
+	if ok, _, _ := store.Take(ctx, "b", 0.001, burst); !ok {
+		t.Error("Take() on another key should succeed")
+	}
+
+	for i := 0; i < burst; i++ {
+		store.Take(ctx, "c", rate, burst)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if ok, _, _ := store.Take(ctx, "c", rate, burst); !ok {
+		t.Error("Take() after refill should succeed")
+	}
+}
+
+func TestMemoryRateLimitStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRateLimitStore()
+	store.Take(ctx, "a", 1000, 1)
+	time.Sleep(5 * time.Millisecond)
+
+	// 桶补满后在下一次清理时删除
+	store.lastSweep = time.Time{}
+	store.Take(ctx, "b", 1000, 1)
+	if _, ok := store.buckets["a"]; ok {
+		t.Error("full bucket was not swept")
+	}
+	if _, ok := store.buckets["b"]; !ok {
+		t.Error("active bucket was swept")
+	}
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// s3Stub 内存中的 S3 兼容服务，只实现路径风格的 PUT、GET、HEAD
+type s3Stub struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+	puts    int
+}
+
+func newS3Stub(t *testing.T, bucket, accessKey string) (*s3Stub, *httptest.Server) {
+	t.Helper()
+	stub := &s3Stub{objects: make(map[string][]byte), types: make(map[string]string)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+accessKey+"/") || r.Header.Get("X-Amz-Date") == "" {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return
+		}
+		key, ok := strings.CutPrefix(r.URL.Path, "/"+bucket+"/")
+		if !ok {
+			http.Error(w, "NoSuchBucket", http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+			http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+			return
+		}
+
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			stub.objects[key] = body
+			stub.types[key] = r.Header.Get("Content-Type")
+			stub.puts++
+		case http.MethodGet, http.MethodHead:
+			data, ok := stub.objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", stub.types[key])
+			if r.Method == http.MethodGet {
+				w.Write(data)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return stub, server
+}
+
+func TestS3MediaStoreRoundTrip(t *testing.T) {
+	stub, server := newS3Stub(t, "memes", "ak")
+	store := NewS3MediaStore(server.URL+"/", "", "memes", "ak", "sk")
+	ctx := context.Background()
+	key := "abc.png"
+
+	exists, err := store.Exists(ctx, key)
+	if err != nil || exists {
+		t.Fatalf("Exists() before Put = %v, %v", exists, err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrMediaNotFound) {
+		t.Fatalf("Get() before Put error = %v, want ErrMediaNotFound", err)
+	}
+
+	if err := store.Put(ctx, key, []byte("png data"), "image/png"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if stub.types[key] != "image/png" {
+		t.Errorf("stored content type = %q", stub.types[key])
+	}
+
+	exists, err = store.Exists(ctx, key)
+	if err != nil || !exists {
+		t.Fatalf("Exists() after Put = %v, %v", exists, err)
+	}
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+	if string(data) != "png data" {
+		t.Errorf("Get() = %q", data)
+	}
+}
+
+func TestS3MediaStoreRejected(t *testing.T) {
+	_, server := newS3Stub(t, "memes", "ak")
+	store := NewS3MediaStore(server.URL, "", "memes", "wrong", "sk")
+	if err := store.Put(context.Background(), "abc.png", []byte("x"), ""); err == nil {
+		t.Error("Put() with wrong credentials should fail")
+	}
+	if _, err := store.Exists(context.Background(), "abc.png"); err == nil {
+		t.Error("Exists() with wrong credentials should fail")
+	}
+}
+
+func TestLocalMediaStore(t *testing.T) {
+	store := &LocalMediaStore{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "ab12.gif", []byte("gif"), "image/gif"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	exists, err := store.Exists(ctx, "ab12.gif")
+	if err != nil || !exists {
+		t.Fatalf("Exists() = %v, %v", exists, err)
+	}
+	reader, err := store.Get(ctx, "ab12.gif")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "gif" {
+		t.Errorf("Get() = %q", data)
+	}
+
+	if _, err := store.Get(ctx, "cd34.gif"); !errors.Is(err, ErrMediaNotFound) {
+		t.Errorf("Get() missing error = %v, want ErrMediaNotFound", err)
+	}
+	for _, key := range []string{"", "a", "../etc/passwd", "ab/cd"} {
+		if err := store.Put(ctx, key, []byte("x"), ""); err == nil {
+			t.Errorf("Put(%q) should be rejected", key)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HashSecret 计算token、验证码等凭据的 HMAC-SHA256，数据库中只保存该值
+// 密钥为 SECRET_KEY（所有环境下必填），修改后已有的token全部失效
+func HashSecret(value string) string {
+	mac := hmac.New(sha256.New, []byte(Config.Server.SecretKey))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SecretEqual 以常量时间比较两个哈希值
+func SecretEqual(a, b string) bool {
+	return hmac.Equal([]byte(a), []byte(b))
+}
+
+// SignMediaQuery 生成媒体文件的临时访问参数，用于推送到QQ时由 NapCat 匿名下载图片
+func SignMediaQuery(name string, ttl time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	return url.Values{"expires": {expires}, "sig": {HashSecret("media:" + name + ":" + expires)}}.Encode()
+}
+
+// VerifyMediaSignature 校验 SignMediaQuery 生成的参数是否有效且未过期
+func VerifyMediaSignature(name, expires, sig string) bool {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	return SecretEqual(HashSecret("media:"+name+":"+expires), sig)
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMediaSignature(t *testing.T) {
+	old := Config.Server.SecretKey
+	Config.Server.SecretKey = "0123456789abcdef"
+	t.Cleanup(func() { Config.Server.SecretKey = old })
+
+	query, err := url.ParseQuery(SignMediaQuery("abc.jpg", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires, sig := query.Get("expires"), query.Get("sig")
+	if !VerifyMediaSignature("abc.jpg", expires, sig) {
+		t.Error("valid signature rejected")
+	}
+	if VerifyMediaSignature("other.jpg", expires, sig) {
+		t.Error("signature accepted for another file")
+	}
+	later := strconv.FormatInt(time.Now().Add(2*time.Hour).Unix(), 10)
+	if VerifyMediaSignature("abc.jpg", later, sig) {
+		t.Error("signature accepted with a modified expiry")
+	}
+	if VerifyMediaSignature("abc.jpg", "", "") {
+		t.Error("empty signature accepted")
+	}
+
+	expired, _ := url.ParseQuery(SignMediaQuery("abc.jpg", -time.Minute))
+	if VerifyMediaSignature("abc.jpg", expired.Get("expires"), expired.Get("sig")) {
+		t.Error("expired signature accepted")
+	}
+}
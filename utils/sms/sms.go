@@ -2,6 +2,7 @@ package sms
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
@@ -10,7 +11,6 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"strconv"
 	"time"
 
 	"snail.local/snailllllll/utils"
@@ -50,28 +50,17 @@ type Client struct {
 // NewClient 创建新的SMS客户端
 func NewClient() *Client {
 	return &Client{
-		baseURL:    utils.GetConfig("SMS_BASE_URL", "http://localhost:5000"),
-		secret:     utils.GetConfig("SMS_SECRET", ""),
-		encryption: utils.GetConfig("SMS_ENCRYPTION", "plain"),
-		publicKey:  utils.GetConfig("SMS_PUBLIC_KEY", ""),
-		privateKey: utils.GetConfig("SMS_PRIVATE_KEY", ""),
-		sm4Key:     utils.GetConfig("SMS_SM4_KEY", ""),
-		timeout:    time.Duration(parseInt(utils.GetConfig("SMS_TIMEOUT", "30"))) * time.Second,
+		baseURL:    utils.Config.SMS.BaseURL,
+		secret:     utils.Config.SMS.Secret,
+		encryption: utils.Config.SMS.Encryption,
+		publicKey:  utils.Config.SMS.PublicKey,
+		privateKey: utils.Config.SMS.PrivateKey,
+		sm4Key:     utils.Config.SMS.SM4Key,
+		timeout:    time.Duration(utils.Config.SMS.Timeout) * time.Second,
 		httpClient: &http.Client{},
 	}
 }
 
-// parseInt 解析字符串为整数
-func parseInt(s string) int {
-	if s == "" {
-		return 0
-	}
-	if val, err := strconv.Atoi(s); err == nil {
-		return val
-	}
-	return 0
-}
-
 // Request 请求结构
 type Request struct {
 	Data      interface{} `json:"data"`
@@ -419,6 +408,20 @@ func (c *Client) AddContact(phoneNumbers, name string) error {
 	return err
 }
 
+// Ping 检查短信网关是否可以访问，收到任何HTTP响应都视为可访问
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL, nil)
+	if err != nil {
+		return fmt.Errorf("create request failed: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
 // QueryBattery 查询电池信息
 func (c *Client) QueryBattery() (*BatteryInfo, error) {
 	resp, err := c.doRequest("POST", "/battery/query", map[string]interface{}{})
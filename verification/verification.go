@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"memento_backend/db"
@@ -18,12 +19,45 @@ import (
 	"snail.local/snailllllll/utils"
 )
 
+const (
+	// 单个验证码允许的错误次数，达到后验证码作废
+	maxCodeAttempts = 5
+	// 统计失败次数的时间窗口
+	attemptWindow = 15 * time.Minute
+	// 时间窗口内同一用户名允许的失败次数
+	maxNameFailures = 10
+	// 时间窗口内同一IP允许的失败次数
+	maxIPFailures = 20
+	// 时间窗口内同一IP对同一用户名允许的失败次数
+	maxNameIPFailures = 5
+	// 验证记录保留时间
+	attemptRetention = 7 * 24 * time.Hour
+)
+
+// codesSent 按渠道统计发出的验证码
+var codesSent = utils.NewCounter("memento_verification_codes_sent_total", "发出的验证码数量", "channel")
+
+// ErrTooManyAttempts 失败次数过多，暂时禁止验证
+var ErrTooManyAttempts = errors.New("验证失败次数过多，请稍后再试")
+
+// VerificationAttempt 验证记录，用于限制失败次数和审计
+type VerificationAttempt struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name      string             `bson:"name" json:"name"`
+	Channel   string             `bson:"channel" json:"channel"`
+	IP        string             `bson:"ip" json:"ip"`
+	Success   bool               `bson:"success" json:"success"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"` // 失败原因：mismatch、locked（被限制的请求，不计入失败次数）
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
 // VerificationCode 验证码结构体
 type VerificationCode struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	Name      string             `bson:"name" json:"name"`
 	Channel   string             `bson:"channel" json:"channel"`
-	Code      string             `bson:"code" json:"code"`
+	CodeHash  string             `bson:"code_hash" json:"-"`       // 验证码的HMAC，不保存明文
+	Attempts  int                `bson:"attempts" json:"attempts"` // 错误次数
 	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 }
@@ -31,6 +65,7 @@ type VerificationCode struct {
 // VerificationCodeService 验证码服务
 type VerificationCodeService struct {
 	collection  *mongo.Collection
+	attempts    *mongo.Collection
 	userService *db.UserService
 }
 
@@ -38,6 +73,7 @@ type VerificationCodeService struct {
 func NewVerificationCodeService() *VerificationCodeService {
 	return &VerificationCodeService{
 		collection:  db.Collection("message_db", "verification_codes"),
+		attempts:    db.Collection("message_db", "verification_attempts"),
 		userService: db.NewUserService(),
 	}
 }
@@ -58,13 +94,13 @@ func (s *VerificationCodeService) GenerateVerificationCode(ctx context.Context,
 	lockKey := fmt.Sprintf("verification_lock_%s_%s", name, channel)
 
 	// 使用TryLock尝试获取锁，如果锁已存在则直接返回错误
-	err := utils.TryLock(lockKey, lockTimeout)
+	lockToken, err := utils.TryLock(lockKey, lockTimeout)
 	if err != nil {
 		return "", errors.New("操作过于频繁，请稍后再试")
 	}
 
 	// 注意：这里不立即释放锁，锁会在TTL时间后自动过期
-	// 如果需要手动释放锁，可以在适当的时候调用 utils.DeleteLock(lockKey)
+	// 如果需要手动释放锁，可以在适当的时候调用 utils.DeleteLock(lockKey, lockToken)
 
 	// 生成6位验证码
 	code := fmt.Sprintf("%06d", utils.GenerateRandomNumber(100000, 999999))
@@ -76,7 +112,7 @@ func (s *VerificationCodeService) GenerateVerificationCode(ctx context.Context,
 	verificationCode := &VerificationCode{
 		Name:      name,
 		Channel:   channel,
-		Code:      code,
+		CodeHash:  hashCode(name, channel, code),
 		ExpiresAt: expiresAt,
 		CreatedAt: time.Now(),
 	}
@@ -85,7 +121,7 @@ func (s *VerificationCodeService) GenerateVerificationCode(ctx context.Context,
 	_, err = s.collection.InsertOne(ctx, verificationCode)
 	if err != nil {
 		// 如果数据库操作失败，可以选择手动释放锁
-		utils.DeleteLock(lockKey)
+		utils.DeleteLock(lockKey, lockToken)
 		return "", fmt.Errorf("创建验证码失败: %v", err)
 	}
 
@@ -93,7 +129,7 @@ func (s *VerificationCodeService) GenerateVerificationCode(ctx context.Context,
 	user, err := s.userService.GetUserByName(ctx, name)
 	if err != nil {
 		// 如果获取用户信息失败，可以选择手动释放锁
-		utils.DeleteLock(lockKey)
+		utils.DeleteLock(lockKey, lockToken)
 		return "", fmt.Errorf("获取用户信息失败: %v", err)
 	}
 	message := fmt.Sprintf("【翻旧账】您的验证码是：%s，有效期 15分钟，请勿泄露给他人。", code)
@@ -102,8 +138,9 @@ func (s *VerificationCodeService) GenerateVerificationCode(ctx context.Context,
 	if channel == "qq" {
 		// 发送验证码到QQ
 		if user.QQ != "" {
-			ws, _ := napcat_go_sdk.GetExistWSClient()
-			napcat_go_sdk.SingleTextMessage(&message, &user.QQ, ws)
+			client, _ := napcat_go_sdk.GetClient()
+			napcat_go_sdk.SingleTextMessage(&message, &user.QQ, client)
+			codesSent.Inc(channel)
 		}
 	} else {
 		// 发送验证码到手机
@@ -113,6 +150,8 @@ func (s *VerificationCodeService) GenerateVerificationCode(ctx context.Context,
 			if err != nil {
 				// 记录错误但不中断流程
 				fmt.Printf("发送短信失败: %v", err)
+			} else {
+				codesSent.Inc(channel)
 			}
 		}
 	}
@@ -120,31 +159,152 @@ func (s *VerificationCodeService) GenerateVerificationCode(ctx context.Context,
 	return code, nil
 }
 
+// hashCode 计算验证码的HMAC，包含用户名和渠道，相同验证码在不同用户间的哈希不同
+func hashCode(name, channel, code string) string {
+	return utils.HashSecret(name + ":" + channel + ":" + code)
+}
+
 // VerifyCode 验证验证码
-func (s *VerificationCodeService) VerifyCode(ctx context.Context, name, channel, code string) (bool, error) {
+// 比较之前先原子地占用每个验证码的一次尝试机会，并发请求也不能超过单个验证码的错误次数上限；
+// 用户名、IP 或两者组合在时间窗口内失败次数过多时返回 ErrTooManyAttempts
+func (s *VerificationCodeService) VerifyCode(ctx context.Context, name, channel, code, ip string) (bool, error) {
+	if err := s.checkAttempts(ctx, name, ip); err != nil {
+		if errors.Is(err, ErrTooManyAttempts) {
+			s.recordAttempt(ctx, name, channel, ip, false, "locked")
+		}
+		return false, err
+	}
+
 	filter := bson.M{
 		"name":       name,
 		"channel":    channel,
-		"code":       code,
+		"code_hash":  bson.M{"$exists": true},
 		"expires_at": bson.M{"$gt": time.Now()},
 	}
-
-	var verificationCode VerificationCode
-	err := s.collection.FindOne(ctx, filter).Decode(&verificationCode)
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return false, nil
+		return false, err
+	}
+	var codes []VerificationCode
+	if err := cursor.All(ctx, &codes); err != nil {
+		return false, err
+	}
+
+	hash := hashCode(name, channel, code)
+	for _, candidate := range codes {
+		verificationCode, err := s.reserveAttempt(ctx, candidate.ID)
+		if err != nil {
+			return false, err
+		}
+		if verificationCode == nil || !utils.SecretEqual(verificationCode.CodeHash, hash) {
+			continue
 		}
+
+		// 验证成功后删除验证码，并发的正确请求只有一个能删除成功
+		result, err := s.collection.DeleteOne(ctx, bson.M{"_id": verificationCode.ID})
+		if err != nil {
+			return false, err
+		}
+		if result.DeletedCount == 0 {
+			break
+		}
+		s.recordAttempt(ctx, name, channel, ip, true, "")
+		return true, nil
+	}
+
+	s.recordAttempt(ctx, name, channel, ip, false, "mismatch")
+	// 删除尝试次数用尽的验证码
+	if _, err := s.collection.DeleteMany(ctx, bson.M{"name": name, "channel": channel, "attempts": bson.M{"$gte": maxCodeAttempts}}); err != nil {
 		return false, err
 	}
+	return false, nil
+}
 
-	// 验证成功后删除验证码
-	_, err = s.collection.DeleteOne(ctx, bson.M{"_id": verificationCode.ID})
+// reserveAttempt 在尝试次数未用尽时原子地占用一次，返回占用后的验证码；次数已用尽或验证码不存在时返回 nil
+func (s *VerificationCodeService) reserveAttempt(ctx context.Context, id primitive.ObjectID) (*VerificationCode, error) {
+	filter := bson.M{
+		"_id":        id,
+		"attempts":   bson.M{"$lt": maxCodeAttempts},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	var verificationCode VerificationCode
+	err := s.collection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"attempts": 1}}).Decode(&verificationCode)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	return &verificationCode, nil
+}
 
-	return true, nil
+// checkAttempts 检查用户名、IP 以及两者组合在时间窗口内的失败次数，被限制的请求不计入
+func (s *VerificationCodeService) checkAttempts(ctx context.Context, name, ip string) error {
+	since := time.Now().Add(-attemptWindow)
+	failures := func(filter bson.M) (int64, error) {
+		filter["success"] = false
+		filter["reason"] = bson.M{"$ne": "locked"}
+		filter["created_at"] = bson.M{"$gt": since}
+		return s.attempts.CountDocuments(ctx, filter)
+	}
+
+	count, err := failures(bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if count >= maxNameFailures {
+		return ErrTooManyAttempts
+	}
+
+	if ip == "" {
+		return nil
+	}
+	count, err = failures(bson.M{"name": name, "ip": ip})
+	if err != nil {
+		return err
+	}
+	if count >= maxNameIPFailures {
+		return ErrTooManyAttempts
+	}
+	count, err = failures(bson.M{"ip": ip})
+	if err != nil {
+		return err
+	}
+	if count >= maxIPFailures {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+// recordAttempt 保存验证记录，失败不影响验证结果
+func (s *VerificationCodeService) recordAttempt(ctx context.Context, name, channel, ip string, success bool, reason string) {
+	attempt := VerificationAttempt{
+		Name:      name,
+		Channel:   channel,
+		IP:        ip,
+		Success:   success,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if _, err := s.attempts.InsertOne(ctx, attempt); err != nil {
+		fmt.Printf("保存验证记录失败: %v\n", err)
+	}
+	if !success {
+		log.Printf("验证码校验失败: name=%s channel=%s ip=%s reason=%s", name, channel, ip, reason)
+	}
+}
+
+// DeletePlaintextCodes 删除明文保存验证码的旧记录，返回删除数量
+// 验证码有效期只有几分钟，不做迁移，用户重新获取即可
+func (s *VerificationCodeService) DeletePlaintextCodes(ctx context.Context) (int64, error) {
+	result, err := s.collection.DeleteMany(ctx, bson.M{"$or": []bson.M{
+		{"code": bson.M{"$exists": true}},
+		{"code_hash": bson.M{"$exists": false}},
+	}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
 }
 
 // CreateIndexes 创建索引
@@ -159,6 +319,25 @@ func (s *VerificationCodeService) CreateIndexes(ctx context.Context) error {
 		},
 	}
 
-	_, err := s.collection.Indexes().CreateMany(ctx, indexes)
+	if _, err := s.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	attemptIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "name", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "ip", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "name", Value: 1}, {Key: "ip", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys:    bson.M{"created_at": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(attemptRetention.Seconds())),
+		},
+	}
+	_, err := s.attempts.Indexes().CreateMany(ctx, attemptIndexes)
 	return err
 }
@@ -0,0 +1,143 @@
+package verification
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"memento_backend/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"snail.local/snailllllll/utils"
+)
+
+func TestHashCode(t *testing.T) {
+	old := utils.Config.Server.SecretKey
+	utils.Config.Server.SecretKey = "0123456789abcdef"
+	t.Cleanup(func() { utils.Config.Server.SecretKey = old })
+
+	hash := hashCode("alice", "qq", "123456")
+	if hash != hashCode("alice", "qq", "123456") {
+		t.Error("hashCode() is not deterministic")
+	}
+	for _, other := range []string{
+		hashCode("bob", "qq", "123456"),
+		hashCode("alice", "sms", "123456"),
+		hashCode("alice", "qq", "654321"),
+	} {
+		if other == hash {
+			t.Error("hashCode() collides across name, channel or code")
+		}
+	}
+}
+
+// newTestService 需要 MongoDB，通过 MONGO_TEST_URI 指定
+func newTestService(t *testing.T) (*VerificationCodeService, string) {
+	t.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI 未设置")
+	}
+	if db.Client == nil {
+		if err := db.Init(uri); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewVerificationCodeService()
+	name := "test-" + primitive.NewObjectID().Hex()
+	t.Cleanup(func() {
+		ctx := context.Background()
+		s.collection.DeleteMany(ctx, bson.M{"name": name})
+		s.attempts.DeleteMany(ctx, bson.M{"name": name})
+	})
+	return s, name
+}
+
+func insertCode(t *testing.T, s *VerificationCodeService, name, code string, attempts int) {
+	t.Helper()
+	_, err := s.collection.InsertOne(context.Background(), VerificationCode{
+		Name:      name,
+		Channel:   "qq",
+		CodeHash:  hashCode(name, "qq", code),
+		Attempts:  attempts,
+		ExpiresAt: time.Now().Add(5 * time.Minute),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyCodeConcurrentGuesses(t *testing.T) {
+	s, name := newTestService(t)
+	// 只剩一次尝试机会时，并发请求中只有一个能比较验证码
+	insertCode(t, s, name, "123456", maxCodeAttempts-1)
+
+	var wg sync.WaitGroup
+	var successes atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := s.VerifyCode(context.Background(), name, "qq", "123456", "")
+			if err != nil {
+				t.Errorf("VerifyCode() error = %v", err)
+			}
+			if ok {
+				successes.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if successes.Load() != 1 {
+		t.Errorf("successes = %d, want 1", successes.Load())
+	}
+}
+
+func TestVerifyCodeExhausted(t *testing.T) {
+	s, name := newTestService(t)
+	insertCode(t, s, name, "123456", 0)
+	ctx := context.Background()
+
+	for i := 0; i < maxCodeAttempts; i++ {
+		if ok, err := s.VerifyCode(ctx, name, "qq", "000000", ""); ok || err != nil {
+			t.Fatalf("wrong code VerifyCode() = %v, %v", ok, err)
+		}
+	}
+	// 尝试次数用尽后正确的验证码也失效
+	if ok, err := s.VerifyCode(ctx, name, "qq", "123456", ""); ok || err != nil {
+		t.Errorf("exhausted VerifyCode() = %v, %v", ok, err)
+	}
+}
+
+func TestVerifyCodeLockedAttemptsNotCounted(t *testing.T) {
+	s, name := newTestService(t)
+	ctx := context.Background()
+	ip := "192.0.2.1"
+
+	for i := 0; i < maxNameIPFailures; i++ {
+		s.recordAttempt(ctx, name, "qq", ip, false, "mismatch")
+	}
+	if _, err := s.VerifyCode(ctx, name, "qq", "123456", ip); err != ErrTooManyAttempts {
+		t.Fatalf("VerifyCode() error = %v, want ErrTooManyAttempts", err)
+	}
+	// 其他IP不受同一用户名和IP组合的限制
+	insertCode(t, s, name, "123456", 0)
+	if ok, err := s.VerifyCode(ctx, name, "qq", "123456", "192.0.2.2"); !ok || err != nil {
+		t.Errorf("VerifyCode() from another IP = %v, %v", ok, err)
+	}
+
+	// 被限制的请求不计入失败次数
+	s.attempts.DeleteMany(ctx, bson.M{"name": name})
+	for i := 0; i < maxNameFailures; i++ {
+		s.recordAttempt(ctx, name, "qq", ip, false, "locked")
+	}
+	insertCode(t, s, name, "654321", 0)
+	if ok, err := s.VerifyCode(ctx, name, "qq", "654321", ip); !ok || err != nil {
+		t.Errorf("VerifyCode() after locked attempts = %v, %v", ok, err)
+	}
+}